@@ -1,3 +1,5 @@
+import { useAuthStore } from "../stores/auth";
+
 export const urlToWss = (url: string): string => {
   // secure
   if (url.startsWith("https://")) {
@@ -7,3 +9,32 @@ export const urlToWss = (url: string): string => {
   // insecure
   return url.replace(/^http:\/\//, "ws://");
 };
+
+// websockets and images can't set headers, the session is passed in the query
+export const withAccessToken = (url: string): string => {
+  const authStore = useAuthStore();
+  if (!authStore.token) {
+    return url;
+  }
+  const separator = url.includes("?") ? "&" : "?";
+  return `${url}${separator}access_token=${encodeURIComponent(authStore.token)}`;
+};
+
+// fetch with the session, an expired session logs out so the router shows
+// the login page again
+export const apiFetch = async (
+  url: string,
+  init: RequestInit = {}
+): Promise<Response> => {
+  const authStore = useAuthStore();
+  const headers = new Headers(init.headers);
+  if (authStore.token) {
+    headers.set("authorization", `Bearer ${authStore.token}`);
+  }
+
+  const res = await fetch(url, { ...init, headers, credentials: "include" });
+  if (res.status === 401) {
+    authStore.$reset();
+  }
+  return res;
+};
@@ -9,8 +9,10 @@ import { createApp } from "vue";
 import { createRouter, createWebHistory } from "vue-router";
 import App from "./App.vue";
 import ChatPage from "./pages/chat.vue";
+import LoginPage from "./pages/login.vue";
 import SettingsPage from "./pages/settings.vue";
 import StreamInfoPage from "./pages/streamInfo.vue";
+import { useAuthStore } from "./stores/auth";
 import "./style.css";
 
 const routes = [
@@ -40,6 +42,12 @@ const routes = [
   },
 
   // internal routes
+  {
+    path: "/login",
+    name: "login",
+    component: LoginPage,
+    meta: { hidden: true, public: true },
+  },
   {
     path: "/oauth/twitch",
     name: "oauth",
@@ -57,5 +65,13 @@ const router = createRouter({
 const pinia = createPinia();
 pinia.use(piniaPersistedState);
 
+// every page but the login needs a session
+router.beforeEach((to) => {
+  const authStore = useAuthStore();
+  if (!to.meta.public && !authStore.loggedIn) {
+    return { name: "login", query: { redirect: to.fullPath } };
+  }
+});
+
 // init app
 createApp(App).use(pinia).use(router).mount("#app");
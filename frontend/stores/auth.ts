@@ -0,0 +1,34 @@
+import { defineStore } from "pinia";
+import type { LoginResponse, Role } from "../types";
+
+export type Auth = {
+  token: string;
+  username: string;
+  role: Role | "";
+  expiresAt: string;
+};
+
+export const useAuthStore = defineStore("auth", {
+  persist: true,
+  state: (): Auth => ({
+    token: "",
+    username: "",
+    role: "",
+    expiresAt: "",
+  }),
+  getters: {
+    loggedIn: (state) =>
+      state.token !== "" &&
+      (state.expiresAt === "" || new Date(state.expiresAt) > new Date()),
+  },
+  actions: {
+    setSession(session: LoginResponse) {
+      this.$patch({
+        token: session.token,
+        username: session.username,
+        role: session.role,
+        expiresAt: session.expires_at,
+      });
+    },
+  },
+});
@@ -9,6 +9,22 @@ type User = {
   youtube_member: boolean;
 };
 
+export type Role = "viewer" | "moderator" | "owner";
+
+// log in with an API user, the server password (no username) or the admin token
+export type LoginRequest = {
+  username?: string;
+  password?: string;
+  token?: string;
+};
+
+export type LoginResponse = {
+  token: string;
+  username: string;
+  role: Role;
+  expires_at: string;
+};
+
 export type AdminWSMessage = {
   id: string;
   body: string;
@@ -22,16 +38,148 @@ export type AdminWSMessage = {
   published_at: string;
 };
 
+export type AdminWSEvent = {
+  type: "auth_state";
+  platform: Platform;
+  identity?: string;
+  valid: boolean;
+  error?: string;
+};
+
+export type TwitchAuthStatus = {
+  isValid: boolean;
+  identity: string;
+  login?: string;
+  user_id?: string;
+  scopes: string[];
+  expires_at?: string;
+  missing_scopes: Record<string, string[]>;
+  relogin: boolean;
+};
+
 export type Category = {
   id: string;
   name: string;
   image_url: string;
 };
 
+// presets are listed in the stored order, see PUT /api/stream-info-presets/order
 export type StreamInfoPreset = {
   id: string;
   name: string;
+  group?: string;
+  favorite?: boolean;
   title: string;
   category: Category;
   tags: string[];
+  // unset fields are left as they are when applying, only the listed labels
+  // are changed
+  broadcasterLanguage?: string;
+  delay?: number;
+  contentClassificationLabels?: ContentClassificationLabel[];
+  isBrandedContent?: boolean;
+  schedule?: PresetSchedule;
+  // set by the server when the preset is applied
+  lastApplied?: string;
+};
+
+// GET /api/stream-info
+export type ChannelInformation = {
+  broadcaster_id: string;
+  broadcaster_login: string;
+  broadcaster_name: string;
+  broadcaster_language: string;
+  title: string;
+  game_id: string;
+  game_name: string;
+  tags: string[];
+  delay: number;
+  content_classification_labels: string[];
+  is_branded_content: boolean;
+};
+
+export type ContentClassificationLabel = {
+  id: string;
+  enabled: boolean;
+};
+
+// body of a 400 when saving a preset, field is a path like "tags[2]"
+export type PresetValidationError = {
+  message: string;
+  errors: { field: string; message: string }[];
+};
+
+// exactly one of cron, at or afterOnline is set
+export type PresetSchedule = {
+  enabled: boolean;
+  cron?: string;
+  at?: string;
+  afterOnline?: string;
+};
+
+export type ScheduleRun = {
+  at: string;
+  success: boolean;
+  error?: string;
+};
+
+export type Schedule = {
+  presetId: string;
+  presetName: string;
+  schedule: PresetSchedule;
+  nextRun: string | null;
+  lastRun: ScheduleRun | null;
+};
+
+// challenges map a name to its start date, YYYY-MM-DD
+export type TemplatesConfig = {
+  variables: Record<string, string>;
+  challenges: Record<string, string>;
+  streamCount: number;
+};
+
+export type PresetPreview = {
+  title: string;
+  tags: string[];
+  titleLength: number;
+  maxLength: number;
+  valid: boolean;
+  errors: string[];
+};
+
+// before and after are read from Twitch around the change, after is null if
+// that failed
+export type StreamInfoHistoryEntry = {
+  id: string;
+  time: string;
+  actor: string;
+  action: string;
+  target?: string;
+  before: ChannelInformation;
+  after: ChannelInformation | null;
+};
+
+// GET /api/stream-info-presets/export, as JSON or YAML
+export type PresetBundle = {
+  version: number;
+  exportedAt: string;
+  presets: StreamInfoPreset[];
+};
+
+export type PresetImportResult = {
+  id: string;
+  name: string;
+  result: "created" | "skipped" | "overwritten" | "duplicated";
+};
+
+export type PresetImportResponse = {
+  results: PresetImportResult[];
+  presets: StreamInfoPreset[];
+};
+
+// a tag preset is on while the channel has all of its tags
+export type TagPreset = {
+  id: string;
+  name: string;
+  tags: string[];
 };
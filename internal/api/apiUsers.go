@@ -0,0 +1,170 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type APIUserRequest struct {
+	Username string      `json:"username"`
+	Password string      `json:"password"`
+	Role     config.Role `json:"role"`
+}
+
+type APIUserResponse struct {
+	Username string      `json:"username"`
+	Role     config.Role `json:"role"`
+}
+
+// findUser returns the configured API user with the given name
+func findUser(username string) *config.APIUser {
+	for i := range config.Cfg.Users {
+		user := &config.Cfg.Users[i]
+		if strings.EqualFold(user.Username, username) {
+			return user
+		}
+	}
+	return nil
+}
+
+// deleteUserSessions logs a user out everywhere
+func deleteUserSessions(username string) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	for token, sess := range sessions {
+		if strings.EqualFold(sess.Username, username) {
+			delete(sessions, token)
+		}
+	}
+}
+
+func listUsers() []APIUserResponse {
+	users := []APIUserResponse{}
+	for _, user := range config.Cfg.Users {
+		users = append(users, APIUserResponse{
+			Username: user.Username,
+			Role:     user.Role,
+		})
+	}
+	return users
+}
+
+func (h *Handler) APIUsersGet(ctx echo.Context) error {
+	return ctx.JSON(200, listUsers())
+}
+
+func (h *Handler) APIUserPost(ctx echo.Context) error {
+	// unmarshal request
+	body := new(APIUserRequest)
+	if err := ctx.Bind(body); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal request body")
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	// validate body
+	if body.Username == "" || strings.EqualFold(body.Username, adminUsername) {
+		return echo.NewHTTPError(400, "invalid username")
+	}
+	if findUser(body.Username) != nil {
+		return echo.NewHTTPError(409, "user already exists")
+	}
+	if !body.Role.Valid() {
+		return echo.NewHTTPError(400, "invalid role")
+	}
+	if len(body.Password) < 8 {
+		return echo.NewHTTPError(400, "password must be at least 8 characters")
+	}
+
+	// hash password
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to hash password")
+		return echo.NewHTTPError(500, "failed to hash password")
+	}
+
+	// save
+	config.Cfg.Users = append(config.Cfg.Users, config.APIUser{
+		Username:     body.Username,
+		PasswordHash: string(hash),
+		Role:         body.Role,
+	})
+	if err := config.SetConfigValue("users", config.Cfg.Users); err != nil {
+		log.Error().Err(err).Msg("failed to persist users")
+		return echo.NewHTTPError(500, "failed to save users")
+	}
+
+	return ctx.JSON(200, listUsers())
+}
+
+func (h *Handler) APIUserPut(ctx echo.Context) error {
+	// find user in config
+	user := findUser(ctx.Param("name"))
+	if user == nil {
+		return echo.NewHTTPError(404, "user not found")
+	}
+
+	// unmarshal request
+	body := new(APIUserRequest)
+	if err := ctx.Bind(body); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal request body")
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	// update role and password if given
+	if body.Role != "" {
+		if !body.Role.Valid() {
+			return echo.NewHTTPError(400, "invalid role")
+		}
+		user.Role = body.Role
+	}
+	if body.Password != "" {
+		if len(body.Password) < 8 {
+			return echo.NewHTTPError(400, "password must be at least 8 characters")
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to hash password")
+			return echo.NewHTTPError(500, "failed to hash password")
+		}
+		user.PasswordHash = string(hash)
+	}
+
+	// persist and force a new login with the updated role
+	if err := config.SetConfigValue("users", config.Cfg.Users); err != nil {
+		log.Error().Err(err).Msg("failed to persist users")
+		return echo.NewHTTPError(500, "failed to save users")
+	}
+	deleteUserSessions(user.Username)
+
+	return ctx.JSON(200, listUsers())
+}
+
+func (h *Handler) APIUserDelete(ctx echo.Context) error {
+	// find the index of the user to delete
+	username := ctx.Param("name")
+	userIndex := -1
+	for i, user := range config.Cfg.Users {
+		if strings.EqualFold(user.Username, username) {
+			userIndex = i
+			break
+		}
+	}
+	if userIndex == -1 {
+		return echo.NewHTTPError(404, "user not found")
+	}
+
+	// remove the user and their sessions
+	config.Cfg.Users = append(config.Cfg.Users[:userIndex], config.Cfg.Users[userIndex+1:]...)
+	if err := config.SetConfigValue("users", config.Cfg.Users); err != nil {
+		log.Error().Err(err).Msg("failed to persist users")
+		return echo.NewHTTPError(500, "failed to save users")
+	}
+	deleteUserSessions(username)
+
+	return ctx.JSON(200, listUsers())
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/audit"
+	"github.com/rs/zerolog/log"
+)
+
+// auditAction records who performed a moderation or channel management action
+func auditAction(ctx echo.Context, action string, target string, params map[string]any, err error) {
+	auditActionBy(actor(ctx), action, target, params, err)
+}
+
+// auditActionBy records an action not triggered by a request, e.g. by the
+// scheduler
+func auditActionBy(actorName string, action string, target string, params map[string]any, err error) {
+	entry := audit.Entry{
+		Actor:      actorName,
+		Action:     action,
+		Target:     target,
+		Parameters: params,
+		Success:    err == nil,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if err := audit.Append(entry); err != nil {
+		log.Error().Err(err).Str("action", action).Msg("failed to write audit log")
+	}
+}
+
+// parseTimeParam reads an optional RFC3339 query param
+func parseTimeParam(ctx echo.Context, name string) (time.Time, error) {
+	raw := ctx.QueryParam(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	value, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, echo.NewHTTPError(400, "invalid "+name+" param")
+	}
+	return value, nil
+}
+
+func (h *Handler) AuditGet(ctx echo.Context) error {
+	since, err := parseTimeParam(ctx, "since")
+	if err != nil {
+		return err
+	}
+	until, err := parseTimeParam(ctx, "until")
+	if err != nil {
+		return err
+	}
+	limit, err := parseIntParam(ctx, "limit", 100)
+	if err != nil {
+		return err
+	}
+
+	entries, err := audit.Query(audit.Filter{
+		Actor:  ctx.QueryParam("actor"),
+		Action: ctx.QueryParam("action"),
+		Target: ctx.QueryParam("target"),
+		Since:  since,
+		Until:  until,
+		Limit:  limit,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read audit log")
+		return echo.NewHTTPError(500, "failed to read audit log")
+	}
+
+	return ctx.JSON(200, entries)
+}
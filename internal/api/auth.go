@@ -3,6 +3,8 @@ package api
 import (
 	"io"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/nullvt/stream-admin/internal/config"
@@ -12,17 +14,157 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func (h *Handler) TwitchLogin(ctx echo.Context) error {
-	scopes := []string{
+const oauthStateTTL = 10 * time.Minute
+
+// twitchScopes is the scope set requested when logging in as each identity.
+// The broadcaster keeps the chat scopes as chat falls back to it without a bot.
+var twitchScopes = map[string][]string{
+	helpers.TwitchBroadcaster: {
 		"user:bot",
 		"user:read:chat",
+		"user:write:chat",
 		"moderator:manage:chat_messages",
 		"channel:manage:broadcast",
 		"moderator:manage:banned_users",
+	},
+	helpers.TwitchBot: {
+		"user:bot",
+		"user:read:chat",
+		"user:write:chat",
+		"moderator:manage:chat_messages",
+		"moderator:manage:banned_users",
+	},
+}
+
+// twitchFeature is a feature using the Twitch API and the scopes it needs
+type twitchFeature struct {
+	Name     string
+	Identity string
+	Scopes   []string
+}
+
+// twitchFeatures lists the scopes each feature needs from the identity it
+// acts as, keep twitchScopes in sync when adding features
+var twitchFeatures = []twitchFeature{
+	{Name: "chat", Identity: helpers.TwitchBot, Scopes: []string{"user:read:chat"}},
+	{Name: "message_delete", Identity: helpers.TwitchBot, Scopes: []string{"moderator:manage:chat_messages"}},
+	{Name: "ban", Identity: helpers.TwitchBot, Scopes: []string{"moderator:manage:banned_users"}},
+	{Name: "stream_info", Identity: helpers.TwitchBroadcaster, Scopes: []string{"channel:manage:broadcast"}},
+}
+
+type oauthState struct {
+	Identity  string
+	ExpiresAt time.Time
+}
+
+var (
+	oauthStates   = map[string]oauthState{}
+	oauthStatesMu sync.Mutex
+)
+
+type TwitchIdentityResponse struct {
+	Identity  string    `json:"identity"`
+	Connected bool      `json:"connected"`
+	UserID    string    `json:"user_id,omitempty"`
+	Login     string    `json:"login,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+type TwitchAuthValidResponse struct {
+	IsValid   bool       `json:"isValid"`
+	Identity  string     `json:"identity"`
+	Login     string     `json:"login,omitempty"`
+	UserID    string     `json:"user_id,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// MissingScopes maps each feature to the scopes it lacks
+	MissingScopes map[string][]string `json:"missing_scopes"`
+	Relogin       bool                `json:"relogin"`
+}
+
+type TwitchClientSecretRequest struct {
+	ClientSecret string `json:"client_secret"`
+}
+
+func twitchRedirectURL() string {
+	return config.Cfg.Server.BaseURL + "/oauth/twitch"
+}
+
+// identityParam reads the Twitch identity from the route, the routes without
+// one act on the broadcaster
+func identityParam(ctx echo.Context) (string, error) {
+	identity := ctx.Param("identity")
+	if identity == "" {
+		return helpers.TwitchBroadcaster, nil
+	}
+	if !helpers.ValidTwitchIdentity(identity) {
+		return "", echo.NewHTTPError(404, "unknown identity")
+	}
+	return identity, nil
+}
+
+// newOAuthState generates a state value for an OAuth login, remembering
+// which identity is logging in
+func newOAuthState(identity string) (string, error) {
+	state, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	oauthStatesMu.Lock()
+	defer oauthStatesMu.Unlock()
+	for existing, oldState := range oauthStates {
+		if time.Now().After(oldState.ExpiresAt) {
+			delete(oauthStates, existing)
+		}
+	}
+	oauthStates[state] = oauthState{
+		Identity:  identity,
+		ExpiresAt: time.Now().Add(oauthStateTTL),
+	}
+
+	return state, nil
+}
+
+// consumeOAuthState checks a state was issued by us and returns its identity,
+// each can only be used once
+func consumeOAuthState(state string) (string, bool) {
+	oauthStatesMu.Lock()
+	defer oauthStatesMu.Unlock()
+
+	issued, ok := oauthStates[state]
+	delete(oauthStates, state)
+	return issued.Identity, ok && time.Now().Before(issued.ExpiresAt)
+}
+
+func (h *Handler) TwitchLogin(ctx echo.Context) error {
+	identity, err := identityParam(ctx)
+	if err != nil {
+		return err
+	}
+	scopes := twitchScopes[identity]
+
+	// use the authorization code flow when a client secret is configured
+	responseType := "token"
+	clientSecret, err := secrets.Get("twitch_client_secret")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get twitch client secret from secrets")
+		return echo.NewHTTPError(500, "Failed to get twitch client secret")
+	}
+	if clientSecret != "" {
+		responseType = "code"
+	}
+
+	// state protects the callback against CSRF
+	state, err := newOAuthState(identity)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate OAuth state")
+		return echo.NewHTTPError(500, "Failed to generate OAuth state")
 	}
 
-	redirectURL := config.Cfg.Server.BaseURL + "/oauth/twitch"
-	url, err := twitch.OAuthLogin(config.Cfg.Twitch.ClientID, redirectURL, scopes)
+	url, err := twitch.OAuthLogin(config.Cfg.Twitch.ClientID, twitchRedirectURL(), scopes, responseType, state)
 	if err != nil {
 		return echo.NewHTTPError(500, err)
 	}
@@ -38,36 +180,50 @@ func (h *Handler) TwitchCallback(ctx echo.Context) error {
 	}
 	body := string(rawBody)
 
-	// parse the auth token
-	authToken, err := twitch.OAuthCallback(body)
+	// parse the auth token or code
+	params, err := twitch.OAuthCallback(body)
 	if err != nil {
 		return ctx.JSON(http.StatusBadRequest, err)
 	}
+	identity, ok := consumeOAuthState(params.State)
+	if !ok {
+		return echo.NewHTTPError(400, "invalid OAuth state")
+	}
+
+	// exchange the code for tokens
+	token := twitch.Token{AccessToken: params.AccessToken, Scopes: params.Scopes}
+	if params.Code != "" {
+		clientSecret, err := secrets.Get("twitch_client_secret")
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get twitch client secret from secrets")
+			return echo.NewHTTPError(500, "Failed to get twitch client secret")
+		}
+		token, err = twitch.ExchangeCode(config.Cfg.Twitch.ClientID, clientSecret, params.Code, twitchRedirectURL())
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to exchange OAuth code")
+			return echo.NewHTTPError(500, "Failed to exchange OAuth code")
+		}
+	}
 
 	// store the auth token
-	if err := secrets.Set("twitch_token", authToken); err != nil {
+	if err := (helpers.TwitchTokenStore{Identity: identity}).SaveToken(token); err != nil {
 		log.Error().Err(err).Msg("Failed to persist token")
 		return echo.NewHTTPError(500, "Failed to persist token")
 	}
 
 	// get extended user info
-	twitchAuth, err := helpers.GetTwitchAuth()
-	if err != nil {
-		return echo.NewHTTPError(500, "failed to load twitch auth")
+	twitchAuth := twitch.AuthConfig{
+		ClientID:  config.Cfg.Twitch.ClientID,
+		AuthToken: token.AccessToken,
 	}
-	userInfo, err := twitch.GetUsers(twitchAuth, []string{})
+	userInfo, err := twitch.NewClient(twitchAuth).GetUsers(ctx.Request().Context(), []string{})
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get UserInfo for authToken")
 		return echo.NewHTTPError(500, "Failed to get UserInfo")
 	}
 
 	// persist user info
-	userJson, err := userInfo[0].MarshalString()
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to marshal UserInfo to string")
-		return echo.NewHTTPError(500, "Failed to persist UserInfo")
-	}
-	if err := secrets.Set("twitch_user", userJson); err != nil {
+	if err := helpers.SetTwitchUser(identity, &userInfo[0]); err != nil {
 		log.Error().Err(err).Msg("Failed to persist UserInfo")
 		return echo.NewHTTPError(500, "Failed to persist UserInfo")
 	}
@@ -75,33 +231,151 @@ func (h *Handler) TwitchCallback(ctx echo.Context) error {
 	return ctx.NoContent(200)
 }
 
+// servedFeatures returns the features acting as an identity, the bot's
+// features fall back to the broadcaster while no bot is connected
+func servedFeatures(identity string) ([]twitchFeature, error) {
+	botConnected := true
+	if identity == helpers.TwitchBroadcaster {
+		botToken, err := (helpers.TwitchTokenStore{Identity: helpers.TwitchBot}).LoadToken()
+		if err != nil {
+			return nil, err
+		}
+		botConnected = botToken.AccessToken != ""
+	}
+
+	features := []twitchFeature{}
+	for _, feature := range twitchFeatures {
+		if feature.Identity == identity || (feature.Identity == helpers.TwitchBot && !botConnected) {
+			features = append(features, feature)
+		}
+	}
+	return features, nil
+}
+
 func (h *Handler) TwitchValidateAuth(ctx echo.Context) error {
-	token, err := secrets.Get("twitch_token")
+	identity := helpers.TwitchBroadcaster
+	if ctx.QueryParam("identity") != "" {
+		identity = ctx.QueryParam("identity")
+		if !helpers.ValidTwitchIdentity(identity) {
+			return echo.NewHTTPError(400, "unknown identity")
+		}
+	}
+
+	tokenStore := helpers.TwitchTokenStore{Identity: identity}
+	token, err := tokenStore.LoadToken()
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get twitch token from secrets")
 		return echo.NewHTTPError(500, "Failed to get twitch token from secrets")
 	}
-	if token == "" {
-		ctx.JSON(200, map[string]bool{"isValid": false})
+	res := TwitchAuthValidResponse{
+		Identity:      identity,
+		Scopes:        []string{},
+		MissingScopes: map[string][]string{},
+	}
+	if token.AccessToken == "" {
+		return ctx.JSON(200, res)
 	}
 
 	// init validation request
-	isValid, err := twitch.OAuthValidateToken(token)
+	validation, err := twitch.OAuthValidateToken(token.AccessToken)
 	if err != nil {
-		return echo.NewHTTPError(500, err)
+		log.Error().Err(err).Msg("Failed to validate twitch token")
+		return echo.NewHTTPError(500, "Failed to validate twitch token")
+	}
+	res.IsValid = validation.Valid
+	if !validation.Valid {
+		res.Relogin = true
+		return ctx.JSON(200, res)
 	}
-	return ctx.JSON(200, map[string]bool{"isValid": isValid})
+	res.Login = validation.Login
+	res.UserID = validation.UserID
+	res.Scopes = validation.Scopes
+	if validation.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(validation.ExpiresIn) * time.Second).UTC()
+		res.ExpiresAt = &expiresAt
+	}
+
+	// compare the granted scopes against what each feature needs
+	features, err := servedFeatures(identity)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get twitch token from secrets")
+		return echo.NewHTTPError(500, "Failed to get twitch token from secrets")
+	}
+	for _, feature := range features {
+		for _, scope := range feature.Scopes {
+			if !validation.HasScope(scope) {
+				res.MissingScopes[feature.Name] = append(res.MissingScopes[feature.Name], scope)
+			}
+		}
+	}
+	res.Relogin = len(res.MissingScopes) > 0
+
+	return ctx.JSON(200, res)
 }
 
 func (h *Handler) TwitchLogout(ctx echo.Context) error {
-	if err := secrets.Set("twitch_token", ""); err != nil {
+	identity, err := identityParam(ctx)
+	if err != nil {
+		return err
+	}
+	err = (helpers.TwitchTokenStore{Identity: identity}).SaveToken(twitch.Token{})
+	auditAction(ctx, "twitch.logout", identity, nil, err)
+	if err != nil {
 		log.Error().Err(err).Msg("Failed to persist token")
 		return echo.NewHTTPError(500, "Failed to persist token")
 	}
-	if err := secrets.Set("twitch_user", ""); err != nil {
+	if err := helpers.SetTwitchUser(identity, nil); err != nil {
 		log.Error().Err(err).Msg("Failed to persist UserInfo")
 		return echo.NewHTTPError(500, "Failed to persist UserInfo")
 	}
 
 	return ctx.JSON(204, nil)
 }
+
+func (h *Handler) TwitchClientSecretPut(ctx echo.Context) error {
+	// unmarshal request
+	body := new(TwitchClientSecretRequest)
+	if err := ctx.Bind(body); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal request body")
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	if err := secrets.Set("twitch_client_secret", body.ClientSecret); err != nil {
+		log.Error().Err(err).Msg("Failed to persist client secret")
+		return echo.NewHTTPError(500, "Failed to persist client secret")
+	}
+
+	return ctx.NoContent(204)
+}
+
+func (h *Handler) TwitchIdentitiesGet(ctx echo.Context) error {
+	identities := []TwitchIdentityResponse{}
+	for _, identity := range helpers.TwitchIdentities {
+		token, err := (helpers.TwitchTokenStore{Identity: identity}).LoadToken()
+		if err != nil {
+			log.Error().Err(err).Str("identity", identity).Msg("Failed to load twitch token")
+			return echo.NewHTTPError(500, "Failed to load twitch token")
+		}
+		user, err := helpers.GetTwitchUser(identity)
+		if err != nil {
+			return echo.NewHTTPError(500, "Failed to load UserInfo")
+		}
+
+		res := TwitchIdentityResponse{
+			Identity:  identity,
+			Connected: token.AccessToken != "",
+			Scopes:    token.Scopes,
+			ExpiresAt: token.ExpiresAt,
+		}
+		if res.Scopes == nil {
+			res.Scopes = []string{}
+		}
+		if user != nil {
+			res.UserID = user.ID
+			res.Login = user.Login
+		}
+		identities = append(identities, res)
+	}
+
+	return ctx.JSON(200, identities)
+}
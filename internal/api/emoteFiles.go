@@ -0,0 +1,102 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// URLs carrying the content version never change, anything else has to be
+	// revalidated. Emotes require auth so shared caches must not store them.
+	emoteImmutableCacheControl  = "private, max-age=31536000, immutable"
+	emoteRevalidateCacheControl = "private, no-cache"
+)
+
+type emoteFileHash struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+var (
+	emoteHashes   = map[string]emoteFileHash{}
+	emoteHashesMu sync.Mutex
+)
+
+// emoteFileETag returns a strong ETag derived from the file content. Hashes are
+// cached until the file size or modification time changes.
+func emoteFileETag(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	emoteHashesMu.Lock()
+	cached, ok := emoteHashes[path]
+	emoteHashesMu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.etag, nil
+	}
+
+	// hash the file content
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(hash.Sum(nil))[:32])
+
+	emoteHashesMu.Lock()
+	emoteHashes[path] = emoteFileHash{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		etag:    etag,
+	}
+	emoteHashesMu.Unlock()
+
+	return etag, nil
+}
+
+// etagMatches checks an If-None-Match header value against an ETag
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// emoteFileVersion returns the content version of a file for use in URLs, or
+// an empty string if the file can't be read
+func emoteFileVersion(path string) string {
+	etag, err := emoteFileETag(path)
+	if err != nil {
+		return ""
+	}
+	return strings.Trim(etag, `"`)
+}
+
+// setEmoteCacheHeaders sets the ETag and only allows long-term caching when
+// the requested version matches the served content
+func setEmoteCacheHeaders(ctx echo.Context, etag string) {
+	cacheControl := emoteRevalidateCacheControl
+	if version := ctx.QueryParam("v"); version != "" && version == strings.Trim(etag, `"`) {
+		cacheControl = emoteImmutableCacheControl
+	}
+	ctx.Response().Header().Set(echo.HeaderCacheControl, cacheControl)
+	ctx.Response().Header().Set("ETag", etag)
+}
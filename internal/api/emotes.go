@@ -1,18 +1,150 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/nullvt/stream-admin/internal/config"
 	"github.com/nullvt/stream-admin/internal/helpers"
+	"github.com/nullvt/stream-admin/internal/livechat"
 	"github.com/nullvt/stream-admin/internal/livechat/twitch"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	emotesDefaultLimit = 50
+	emotesMaxLimit     = 500
+	emoteBundleMaxSize = 200
+)
+
+type EmoteResponse struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name"`
+	Platform    livechat.Platform    `json:"platform"`
+	Segment     string               `json:"segment"`
+	SegmentName string               `json:"segment_name"`
+	MimeType    string               `json:"mimetype"`
+	Animated    bool                 `json:"animated"`
+	Access      livechat.EmoteAccess `json:"access"`
+	URL         string               `json:"url"`
+	Variants    []EmoteVariant       `json:"variants"`
+}
+
+type EmoteVariant struct {
+	Scale string `json:"scale"`
+	Theme string `json:"theme"`
+	URL   string `json:"url"`
+}
+
+type EmoteListResponse struct {
+	Data   []EmoteResponse `json:"data"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+func newEmoteResponse(emote livechat.Emote) EmoteResponse {
+	segmentName := config.Cfg.EmotesWhitelist[emote.Segment]
+	if segmentName == "" {
+		segmentName = emote.Segment
+	}
+
+	// URLs carry the content version so they can be cached until it changes
+	url := "/api/emotes/" + emote.ID
+	variants := []EmoteVariant{}
+	for _, variant := range emote.Variants {
+		variantURL := url + "?scale=" + variant.Scale + "&theme=" + variant.Theme
+		if version := emoteFileVersion(variant.FilePath); version != "" {
+			variantURL += "&v=" + version
+		}
+		variants = append(variants, EmoteVariant{
+			Scale: variant.Scale,
+			Theme: variant.Theme,
+			URL:   variantURL,
+		})
+	}
+	if version := emoteFileVersion(emote.FilePath); version != "" {
+		url += "?v=" + version
+	}
+
+	return EmoteResponse{
+		ID:          emote.ID,
+		Name:        emote.Name,
+		Platform:    emote.Platform,
+		Segment:     emote.Segment,
+		SegmentName: segmentName,
+		MimeType:    emote.MimeType,
+		Animated:    emote.Animated,
+		Access:      emote.Access,
+		URL:         url,
+		Variants:    variants,
+	}
+}
+
+// parseIntParam reads an optional non-negative integer query param
+func parseIntParam(ctx echo.Context, name string, fallback int) (int, error) {
+	raw := ctx.QueryParam(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, echo.NewHTTPError(400, "invalid "+name+" param")
+	}
+	return value, nil
+}
+
+func (h *Handler) ListEmotes(ctx echo.Context) error {
+	// build filter from query params
+	filter := livechat.EmoteFilter{
+		Platform: livechat.Platform(ctx.QueryParam("platform")),
+		Segment:  ctx.QueryParam("segment"),
+		Prefix:   ctx.QueryParam("prefix"),
+	}
+	if animated := ctx.QueryParam("animated"); animated != "" {
+		value, err := strconv.ParseBool(animated)
+		if err != nil {
+			return echo.NewHTTPError(400, "invalid animated param")
+		}
+		filter.Animated = &value
+	}
+
+	// pagination
+	limit, err := parseIntParam(ctx, "limit", emotesDefaultLimit)
+	if err != nil {
+		return err
+	}
+	if limit == 0 || limit > emotesMaxLimit {
+		limit = emotesMaxLimit
+	}
+	offset, err := parseIntParam(ctx, "offset", 0)
+	if err != nil {
+		return err
+	}
+
+	// filter and paginate
+	emotes := h.emotesCache.Filter(filter)
+	res := EmoteListResponse{
+		Data:   []EmoteResponse{},
+		Total:  len(emotes),
+		Limit:  limit,
+		Offset: offset,
+	}
+	for i := offset; i < len(emotes) && i < offset+limit; i++ {
+		res.Data = append(res.Data, newEmoteResponse(emotes[i]))
+	}
+
+	return ctx.JSON(200, res)
+}
+
 func (h *Handler) GetEmote(ctx echo.Context) error {
 	// lookup ID in cache index
 	emoteID := ctx.Param("id")
@@ -21,14 +153,161 @@ func (h *Handler) GetEmote(ctx echo.Context) error {
 		return echo.NewHTTPError(404)
 	}
 
+	// select the closest variant to the requested scale and theme
+	variant := emote.Variant(ctx.QueryParam("scale"), ctx.QueryParam("theme"))
+
 	// load file
-	if _, err := os.Stat(emote.FilePath); os.IsNotExist(err) {
+	if _, err := os.Stat(variant.FilePath); os.IsNotExist(err) {
 		log.Error().Err(err).Msg("emote file does not exist")
 		return echo.NewHTTPError(404, "file not found")
 	}
+	etag, err := emoteFileETag(variant.FilePath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to hash emote file")
+		return echo.NewHTTPError(500, "failed to read emote file")
+	}
+
+	setEmoteCacheHeaders(ctx, etag)
+	if etagMatches(ctx.Request().Header.Get("If-None-Match"), etag) {
+		return ctx.NoContent(304)
+	}
 
 	// read the file content
-	return ctx.File(emote.FilePath)
+	file, err := os.Open(variant.FilePath)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to open emote file")
+		return echo.NewHTTPError(500, "failed to read emote file")
+	}
+	defer file.Close()
+
+	return ctx.Stream(200, variant.MimeType, file)
+}
+
+type EmoteBundleItem struct {
+	MimeType string `json:"mimetype"`
+	Data     []byte `json:"data"`
+}
+
+func (h *Handler) GetEmoteBundle(ctx echo.Context) error {
+	// read requested IDs
+	ids := strings.Split(ctx.QueryParam("ids"), ",")
+	if ctx.QueryParam("ids") == "" {
+		return echo.NewHTTPError(400, "ids param required")
+	}
+	if len(ids) > emoteBundleMaxSize {
+		return echo.NewHTTPError(400, fmt.Sprintf("a bundle can contain at most %d emotes", emoteBundleMaxSize))
+	}
+	scale := ctx.QueryParam("scale")
+	theme := ctx.QueryParam("theme")
+
+	// collect the files, the bundle ETag covers every emote in it
+	bundle := map[string]EmoteBundleItem{}
+	paths := map[string]string{}
+	hash := sha256.New()
+	for _, id := range ids {
+		emote := h.emotesCache.FindByID(strings.TrimSpace(id))
+		if emote == nil {
+			continue
+		}
+		variant := emote.Variant(scale, theme)
+		etag, err := emoteFileETag(variant.FilePath)
+		if err != nil {
+			log.Error().Err(err).Str("id", emote.ID).Msg("failed to hash emote file")
+			continue
+		}
+		hash.Write([]byte(emote.ID + etag))
+		paths[emote.ID] = variant.FilePath
+		bundle[emote.ID] = EmoteBundleItem{MimeType: variant.MimeType}
+	}
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(hash.Sum(nil))[:32])
+
+	setEmoteCacheHeaders(ctx, etag)
+	if etagMatches(ctx.Request().Header.Get("If-None-Match"), etag) {
+		return ctx.NoContent(304)
+	}
+
+	// read the file contents
+	for id, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Error().Err(err).Str("id", id).Msg("failed to read emote file")
+			delete(bundle, id)
+			continue
+		}
+		item := bundle[id]
+		item.Data = data
+		bundle[id] = item
+	}
+
+	return ctx.JSON(200, bundle)
+}
+
+// parseStatsWindow converts a window param into the start of the window.
+// Accepts "session", "all" or a duration such as "24h" or "7d".
+func parseStatsWindow(window string, sessionStart time.Time) (time.Time, error) {
+	switch window {
+	case "", "all":
+		return time.Time{}, nil
+	case "session":
+		return sessionStart, nil
+	}
+
+	// time.ParseDuration does not support days
+	if days, ok := strings.CutSuffix(window, "d"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil || count <= 0 {
+			return time.Time{}, echo.NewHTTPError(400, "invalid window param")
+		}
+		return time.Now().UTC().AddDate(0, 0, -count), nil
+	}
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return time.Time{}, echo.NewHTTPError(400, "invalid window param")
+	}
+	return time.Now().UTC().Add(-duration), nil
+}
+
+func (h *Handler) EmoteStatsGet(ctx echo.Context) error {
+	since, err := parseStatsWindow(ctx.QueryParam("window"), h.emoteStats.Session())
+	if err != nil {
+		return err
+	}
+	limit, err := parseIntParam(ctx, "limit", 10)
+	if err != nil {
+		return err
+	}
+	chatters := false
+	if raw := ctx.QueryParam("chatters"); raw != "" {
+		if chatters, err = strconv.ParseBool(raw); err != nil {
+			return echo.NewHTTPError(400, "invalid chatters param")
+		}
+	}
+
+	result := h.emoteStats.Query(livechat.EmoteStatsQuery{
+		Since:    since,
+		Platform: livechat.Platform(ctx.QueryParam("platform")),
+		Limit:    limit,
+		Chatters: chatters,
+	})
+
+	return ctx.JSON(200, result)
+}
+
+func (h *Handler) EmotesGC(ctx echo.Context) error {
+	// reconcile the index with the files on disk
+	report, err := h.emotesCache.GC(livechat.EmoteCacheDir, livechat.EmoteIndexFile)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to garbage collect emote cache")
+		return echo.NewHTTPError(500, "failed to garbage collect emote cache")
+	}
+
+	// persist the updated index
+	if err := h.emotesCache.SaveToFile(livechat.EmoteIndexFile); err != nil {
+		log.Error().Err(err).Msg("failed to save emote cache index")
+		return echo.NewHTTPError(500, "failed to save emote cache index")
+	}
+
+	return ctx.JSON(200, report)
 }
 
 func (h *Handler) EmoteWhitelistGet(ctx echo.Context) error {
@@ -54,7 +333,7 @@ func (h *Handler) EmoteWhitelistPost(ctx echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(500, "failed to load twitch auth")
 	}
-	users, err := twitch.GetUsers(twitchAuth, []string{strings.ToLower(channelName)})
+	users, err := twitch.NewClient(twitchAuth).GetUsers(ctx.Request().Context(), []string{strings.ToLower(channelName)})
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get twitch users")
 		return echo.NewHTTPError(500, "failed to get twitch users")
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/livechat"
+)
+
+func TestGetEmoteCaching(t *testing.T) {
+	newTestAPI(t)
+	path := filepath.Join(t.TempDir(), "kappa.png")
+	if err := os.WriteFile(path, []byte("first"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emotes := livechat.NewEmoteCache(livechat.Emote{ID: "kappa", Name: "Kappa", Platform: livechat.Twitch, FilePath: path, MimeType: "image/png"})
+	e, err := NewServer(nil, emotes, livechat.NewEmoteStats(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// listed URLs carry the content version
+	list := decode[EmoteListResponse](t, request(t, e, "GET", "/api/emotes", nil))
+	if len(list.Data) != 1 || !strings.Contains(list.Data[0].URL, "?v=") {
+		t.Fatalf("expected a versioned URL, got %+v", list.Data)
+	}
+	versioned := list.Data[0].URL
+	rec := request(t, e, "GET", versioned, nil)
+	if rec.Code != 200 || rec.Header().Get(echo.HeaderCacheControl) != emoteImmutableCacheControl {
+		t.Fatalf("expected an immutable response, got %d %q", rec.Code, rec.Header().Get(echo.HeaderCacheControl))
+	}
+	etag := rec.Header().Get("ETag")
+
+	// unversioned URLs are revalidated
+	rec = request(t, e, "GET", "/api/emotes/kappa", nil)
+	if rec.Header().Get(echo.HeaderCacheControl) != emoteRevalidateCacheControl || rec.Header().Get("ETag") != etag {
+		t.Fatalf("expected a revalidated response, got %q %q", rec.Header().Get(echo.HeaderCacheControl), rec.Header().Get("ETag"))
+	}
+	req := httptest.NewRequest("GET", "/api/emotes/kappa", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+testAdminToken)
+	req.Header.Set("If-None-Match", etag)
+	notModified := httptest.NewRecorder()
+	e.ServeHTTP(notModified, req)
+	if notModified.Code != 304 {
+		t.Fatalf("expected 304, got %d", notModified.Code)
+	}
+
+	// a stale version is served but not kept
+	if err := os.WriteFile(path, []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec = request(t, e, "GET", versioned, nil)
+	if rec.Body.String() != "second" || rec.Header().Get(echo.HeaderCacheControl) != emoteRevalidateCacheControl {
+		t.Fatalf("expected the new content to be revalidated, got %q %q", rec.Body.String(), rec.Header().Get(echo.HeaderCacheControl))
+	}
+	list = decode[EmoteListResponse](t, request(t, e, "GET", "/api/emotes", nil))
+	if list.Data[0].URL == versioned {
+		t.Error("expected the URL to change with the content")
+	}
+}
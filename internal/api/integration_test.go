@@ -0,0 +1,417 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/audit"
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/helpers"
+	"github.com/nullvt/stream-admin/internal/livechat"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch/twitchtest"
+	"github.com/nullvt/stream-admin/internal/secrets"
+	"github.com/spf13/viper"
+)
+
+const (
+	testAdminToken   = "test-admin-token"
+	broadcasterID    = "1001"
+	broadcasterToken = "broadcaster-token"
+	botID            = "2001"
+	botToken         = "bot-token"
+)
+
+// TestMain runs the tests in a temp dir as the config, audit log and emotes
+// are written relative to the working directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "stream-admin-api")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	viper.SetConfigFile(filepath.Join(dir, "stream-admin.json"))
+
+	// secrets come from the environment, changes are kept in memory
+	config.Cfg.Secrets.Backend = string(secrets.BackendEnv)
+	os.Setenv(secrets.EnvPrefix+"ADMIN_TOKEN", testAdminToken)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestAPI starts a stand-in Twitch with a connected broadcaster and
+// returns the API routes
+func newTestAPI(t *testing.T) (*twitchtest.Server, *echo.Echo) {
+	t.Helper()
+	srv := twitchtest.NewServer(t)
+	srv.Use()
+	srv.AddUser(twitch.User{ID: broadcasterID, Login: "streamer", DisplayName: "Streamer"}, broadcasterToken,
+		"user:read:chat", "moderator:manage:chat_messages", "moderator:manage:banned_users", "channel:manage:broadcast")
+	srv.AddCategory(twitch.Category{ID: "509658", Name: "Just Chatting"})
+	srv.AddCategory(twitch.Category{ID: "27471", Name: "Minecraft"})
+	srv.SetChannel(twitch.ChannelInformation{BroadcasterID: broadcasterID, Title: "old title", GameID: "27471", GameName: "Minecraft", Tags: []string{}})
+
+	config.Cfg.Twitch.ClientID = twitchtest.ClientID
+	config.Cfg.Twitch.BroadcasterID = ""
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{}
+	config.Cfg.Templates = config.TemplatesConfig{}
+	config.Cfg.TagPresets = []config.TagPreset{}
+	scheduler = &presetScheduler{lastRuns: map[string]ScheduleRun{}}
+	setSecrets(t, map[string]string{
+		"twitch_token":     broadcasterToken,
+		"twitch_user":      "",
+		"twitch_bot_token": "",
+		"twitch_bot_user":  "",
+	})
+
+	e, err := NewServer(nil, &livechat.EmoteCache{}, livechat.NewEmoteStats(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, e
+}
+
+func setSecrets(t *testing.T, values map[string]string) {
+	t.Helper()
+	for key, value := range values {
+		if err := secrets.Set(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func connectBot(t *testing.T, srv *twitchtest.Server, scopes ...string) {
+	t.Helper()
+	srv.AddUser(twitch.User{ID: botID, Login: "streamerbot"}, botToken, scopes...)
+	setSecrets(t, map[string]string{"twitch_bot_token": botToken})
+}
+
+// request sends an API request authenticated with the admin token
+func request(t *testing.T, e *echo.Echo, method string, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+testAdminToken)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var out T
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode %q: %v", rec.Body.String(), err)
+	}
+	return out
+}
+
+// lastAudit returns the latest audit entry of an action
+func lastAudit(t *testing.T, action string) audit.Entry {
+	t.Helper()
+	entries, err := audit.Query(audit.Filter{Action: action, Since: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 {
+		t.Fatalf("no audit entry for %s", action)
+	}
+	latest := entries[0]
+	for _, entry := range entries {
+		if entry.Time.After(latest.Time) {
+			latest = entry
+		}
+	}
+	return latest
+}
+
+func TestStreamInfoPresetApply(t *testing.T) {
+	srv, e := newTestAPI(t)
+
+	preset := config.StreamInfoPreset{Name: "chatting", Title: "new title", Tags: []string{"English", "Cozy"}}
+	preset.Category.ID = "509658"
+	preset.Category.Name = "Just Chatting"
+	rec := request(t, e, http.MethodPost, "/api/stream-info-presets", preset)
+	if rec.Code != 200 {
+		t.Fatalf("failed to create preset: %d %s", rec.Code, rec.Body)
+	}
+	presets := decode[[]config.StreamInfoPreset](t, rec)
+	if len(presets) != 1 || presets[0].ID == "" {
+		t.Fatalf("unexpected presets %+v", presets)
+	}
+
+	rec = request(t, e, http.MethodPost, "/api/stream-info-presets/"+presets[0].ID+"/apply", nil)
+	if rec.Code != 200 {
+		t.Fatalf("failed to apply preset: %d %s", rec.Code, rec.Body)
+	}
+	channel := srv.Channel(broadcasterID)
+	if channel.Title != "new title" || channel.GameName != "Just Chatting" || strings.Join(channel.Tags, ",") != "English,Cozy" {
+		t.Errorf("unexpected channel %+v", channel)
+	}
+	if entry := lastAudit(t, "preset.apply"); !entry.Success || entry.Target != "chatting" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+
+	// the applied info is read back from Twitch
+	rec = request(t, e, http.MethodGet, "/api/stream-info", nil)
+	if rec.Code != 200 {
+		t.Fatalf("failed to get stream info: %d %s", rec.Code, rec.Body)
+	}
+	if info := decode[twitch.ChannelInformation](t, rec); info.Title != "new title" || info.GameID != "509658" {
+		t.Errorf("unexpected stream info %+v", info)
+	}
+}
+
+func TestStreamInfoPresetApplyTwitchError(t *testing.T) {
+	srv, e := newTestAPI(t)
+	preset := config.StreamInfoPreset{Name: "broken", Title: "new title"}
+	preset.Category.ID = "509658"
+	presets := decode[[]config.StreamInfoPreset](t, request(t, e, http.MethodPost, "/api/stream-info-presets", preset))
+
+	srv.Fail("PATCH /helix/channels", 400, "The tag contains special characters")
+	rec := request(t, e, http.MethodPost, "/api/stream-info-presets/"+presets[0].ID+"/apply", nil)
+	if rec.Code != 500 || !strings.Contains(rec.Body.String(), "twitch error: The tag contains special characters") {
+		t.Errorf("unexpected response %d %s", rec.Code, rec.Body)
+	}
+	if srv.Channel(broadcasterID).Title != "old title" {
+		t.Error("the channel shouldn't change")
+	}
+	if entry := lastAudit(t, "preset.apply"); entry.Success || entry.Target != "broken" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+
+	// unknown presets aren't sent to Twitch
+	if rec := request(t, e, http.MethodPost, "/api/stream-info-presets/missing/apply", nil); rec.Code != 404 {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestStreamInfoPresetFromCurrent(t *testing.T) {
+	srv, e := newTestAPI(t)
+	srv.SetChannel(twitch.ChannelInformation{
+		BroadcasterID:               broadcasterID,
+		BroadcasterLanguage:         "de",
+		Title:                       "live title",
+		GameID:                      "27471",
+		GameName:                    "Minecraft",
+		Tags:                        []string{"Deutsch"},
+		Delay:                       30,
+		ContentClassificationLabels: []string{"ProfanityVulgarity"},
+		IsBrandedContent:            true,
+	})
+
+	rec := request(t, e, http.MethodPost, "/api/stream-info-presets/from-current", map[string]string{"name": "current"})
+	if rec.Code != 200 {
+		t.Fatalf("failed to create preset: %d %s", rec.Code, rec.Body)
+	}
+	preset := decode[[]config.StreamInfoPreset](t, rec)[0]
+	if preset.Title != "live title" || preset.BroadcasterLanguage != "de" || *preset.Delay != 30 || !*preset.IsBrandedContent {
+		t.Errorf("unexpected preset %+v", preset)
+	}
+
+	// applying it later restores every setting
+	srv.SetChannel(twitch.ChannelInformation{
+		BroadcasterID:               broadcasterID,
+		BroadcasterLanguage:         "en",
+		Title:                       "other title",
+		GameID:                      "509658",
+		Tags:                        []string{},
+		ContentClassificationLabels: []string{"Gambling"},
+	})
+	if rec := request(t, e, http.MethodPost, "/api/stream-info-presets/"+preset.ID+"/apply", nil); rec.Code != 200 {
+		t.Fatalf("failed to apply preset: %d %s", rec.Code, rec.Body)
+	}
+	info := decode[twitch.ChannelInformation](t, request(t, e, http.MethodGet, "/api/stream-info", nil))
+	if info.Title != "live title" || info.GameName != "Minecraft" || info.BroadcasterLanguage != "de" || info.Delay != 30 ||
+		strings.Join(info.ContentClassificationLabels, ",") != "ProfanityVulgarity" || !info.IsBrandedContent {
+		t.Errorf("unexpected stream info %+v", info)
+	}
+
+	if rec := request(t, e, http.MethodPost, "/api/stream-info-presets/from-current", map[string]string{}); rec.Code != 400 {
+		t.Errorf("expected 400 without a name, got %d", rec.Code)
+	}
+}
+
+func TestTwitchBanUser(t *testing.T) {
+	srv, e := newTestAPI(t)
+	connectBot(t, srv, "moderator:manage:banned_users")
+	srv.AddUser(twitch.User{ID: "3001", Login: "spammer", DisplayName: "Spammer"}, "spammer-token")
+	// the bot moderates the broadcaster's channel
+	if err := helpers.SetTwitchUser(helpers.TwitchBroadcaster, &twitch.User{ID: broadcasterID, Login: "streamer"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := request(t, e, http.MethodPost, "/api/twitch/ban-user", map[string]any{"user_id": "3001", "duration": 600, "reason": "spam"})
+	if rec.Code != 204 {
+		t.Fatalf("failed to ban: %d %s", rec.Code, rec.Body)
+	}
+	bans := srv.Bans()
+	if len(bans) != 1 {
+		t.Fatalf("expected 1 ban, got %d", len(bans))
+	}
+	ban := bans[0]
+	if ban.UserID != "3001" || ban.BroadcasterID != broadcasterID || ban.ModeratorID != botID || *ban.Duration != 600 || *ban.Reason != "spam" {
+		t.Errorf("unexpected ban %+v", ban)
+	}
+	entry := lastAudit(t, "user.ban")
+	if !entry.Success || entry.Target != "3001" || entry.Parameters["login"] != "spammer" || entry.Parameters["display_name"] != "Spammer" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+}
+
+func TestTwitchBanUserWithoutBot(t *testing.T) {
+	srv, e := newTestAPI(t)
+
+	// the broadcaster moderates when no bot is connected
+	rec := request(t, e, http.MethodPost, "/api/twitch/ban-user", map[string]any{"user_id": "3001", "permanent": true})
+	if rec.Code != 204 {
+		t.Fatalf("failed to ban: %d %s", rec.Code, rec.Body)
+	}
+	if bans := srv.Bans(); len(bans) != 1 || bans[0].ModeratorID != broadcasterID || bans[0].Duration != nil {
+		t.Errorf("unexpected bans %+v", bans)
+	}
+}
+
+func TestMessageDelete(t *testing.T) {
+	srv, e := newTestAPI(t)
+	connectBot(t, srv, "moderator:manage:chat_messages")
+	if err := helpers.SetTwitchUser(helpers.TwitchBroadcaster, &twitch.User{ID: broadcasterID, Login: "streamer"}); err != nil {
+		t.Fatal(err)
+	}
+
+	msgCacheMu.Lock()
+	msgCache = append(msgCache, livechat.Message{
+		Platform:   livechat.Twitch,
+		ID:         "msg-1",
+		Body:       "buy followers",
+		Sender:     livechat.User{ID: "3001", Name: "spammer"},
+		ReceivedAt: time.Now().UTC(),
+	})
+	msgCacheMu.Unlock()
+
+	rec := request(t, e, http.MethodDelete, "/api/messages/msg-1", nil)
+	if rec.Code != 204 {
+		t.Fatalf("failed to delete message: %d %s", rec.Code, rec.Body)
+	}
+	deleted := srv.DeletedMessages()
+	if len(deleted) != 1 || deleted[0].MessageID != "msg-1" || deleted[0].ModeratorID != botID || deleted[0].BroadcasterID != broadcasterID {
+		t.Errorf("unexpected deleted messages %+v", deleted)
+	}
+	if entry := lastAudit(t, "message.delete"); !entry.Success || entry.Target != "spammer" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+
+	if rec := request(t, e, http.MethodDelete, "/api/messages/unknown", nil); rec.Code != 404 {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestMessageDeleteMissingScope(t *testing.T) {
+	srv, e := newTestAPI(t)
+	connectBot(t, srv, "user:read:chat")
+
+	msgCacheMu.Lock()
+	msgCache = append(msgCache, livechat.Message{Platform: livechat.Twitch, ID: "msg-2", ReceivedAt: time.Now().UTC()})
+	msgCacheMu.Unlock()
+
+	if rec := request(t, e, http.MethodDelete, "/api/messages/msg-2", nil); rec.Code != 500 {
+		t.Errorf("expected 500, got %d", rec.Code)
+	}
+	if entry := lastAudit(t, "message.delete"); entry.Success || !strings.Contains(entry.Error, "Missing scope") {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+}
+
+func TestTwitchCategorySearch(t *testing.T) {
+	_, e := newTestAPI(t)
+
+	rec := request(t, e, http.MethodGet, "/api/twitch/categories?query=chat", nil)
+	if rec.Code != 200 {
+		t.Fatalf("failed to search: %d %s", rec.Code, rec.Body)
+	}
+	categories := decode[[]twitch.Category](t, rec)
+	if len(categories) != 1 || categories[0].ID != "509658" {
+		t.Errorf("unexpected categories %+v", categories)
+	}
+
+	if rec := request(t, e, http.MethodGet, "/api/twitch/categories", nil); rec.Code != 400 {
+		t.Errorf("expected 400 without a query, got %d", rec.Code)
+	}
+}
+
+func TestTwitchLinkFiltering(t *testing.T) {
+	srv, e := newTestAPI(t)
+
+	rec := request(t, e, http.MethodPost, "/api/twitch/link-filtering", map[string]bool{"enabled": true})
+	if rec.Code != 200 {
+		t.Fatalf("failed to enable link filtering: %d %s", rec.Code, rec.Body)
+	}
+	if !srv.HideLinks(broadcasterID) {
+		t.Error("expected links to be hidden")
+	}
+}
+
+func TestTwitchValidateAuth(t *testing.T) {
+	_, e := newTestAPI(t)
+	setSecrets(t, map[string]string{"twitch_token_scopes": ""})
+
+	rec := request(t, e, http.MethodGet, "/api/auth/twitch/valid", nil)
+	if rec.Code != 200 {
+		t.Fatalf("failed to validate: %d %s", rec.Code, rec.Body)
+	}
+	res := decode[TwitchAuthValidResponse](t, rec)
+	if !res.IsValid || len(res.Scopes) == 0 {
+		t.Errorf("unexpected validation %+v", res)
+	}
+
+	// validating only reads the token
+	if scopes, err := secrets.Get("twitch_token_scopes"); err != nil || scopes != "" {
+		t.Errorf("expected the token to be left alone, got %q %v", scopes, err)
+	}
+}
+
+func TestTwitchLoginScopes(t *testing.T) {
+	_, e := newTestAPI(t)
+
+	// chat falls back to the broadcaster, so it keeps the chat scopes
+	rec := request(t, e, http.MethodGet, "/api/auth/twitch", nil)
+	if rec.Code != 200 {
+		t.Fatalf("failed to log in: %d %s", rec.Code, rec.Body)
+	}
+	loginURL, err := url.Parse(decode[map[string]string](t, rec)["url"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	scopes := strings.Fields(loginURL.Query().Get("scope"))
+	for _, scope := range []string{"user:bot", "user:read:chat", "user:write:chat", "channel:manage:broadcast"} {
+		if !slices.Contains(scopes, scope) {
+			t.Errorf("expected %s to be requested, got %v", scope, scopes)
+		}
+	}
+}
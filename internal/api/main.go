@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -15,9 +16,11 @@ import (
 type Handler struct {
 	msgChan     chan livechat.Message
 	emotesCache *livechat.EmoteCache
+	emoteStats  *livechat.EmoteStats
 }
 
-func Start(msgChan chan livechat.Message, emc *livechat.EmoteCache) (*echo.Echo, error) {
+// NewServer sets up the middleware and routes without listening
+func NewServer(msgChan chan livechat.Message, emc *livechat.EmoteCache, emoteStats *livechat.EmoteStats) (*echo.Echo, error) {
 	// Setup server
 	e := echo.New()
 	e.Use(middleware.Logger())
@@ -38,45 +41,98 @@ func Start(msgChan chan livechat.Message, emc *livechat.EmoteCache) (*echo.Echo,
 		},
 	}))
 
-	// Fuck CORS with a rake
+	// only allow the configured origins, credentials are needed for the session cookie
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		AllowOrigins:     config.Cfg.Server.AllowOrigins,
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		AllowCredentials: true,
 	}))
 
-	// API routes
-	apiGroup := e.Group("/api")
+	// generate the admin API token on first start
+	if err := ensureAdminToken(); err != nil {
+		return nil, fmt.Errorf("failed to create admin token: %w", err)
+	}
+
+	// API routes, everything but login requires a session with the route's role
+	apiGroup := e.Group("/api", RequireAuth("/api/auth/login"), RequirePermission("/api/auth/login"))
 	handler := &Handler{
 		msgChan:     msgChan,
 		emotesCache: emc,
+		emoteStats:  emoteStats,
 	}
 
+	// admin auth
+	apiGroup.POST("/auth/login", handler.Login)
+	apiGroup.POST("/auth/logout", handler.Logout)
+	apiGroup.GET("/auth/session", handler.SessionGet)
+	apiGroup.PUT("/auth/password", handler.PasswordPut)
+	apiGroup.GET("/users", handler.APIUsersGet)
+	apiGroup.POST("/users", handler.APIUserPost)
+	apiGroup.PUT("/users/:name", handler.APIUserPut)
+	apiGroup.DELETE("/users/:name", handler.APIUserDelete)
+	apiGroup.GET("/audit", handler.AuditGet)
+
 	// messages
 	apiGroup.GET("/messages", handler.MessageWebsocket)
 	apiGroup.DELETE("/messages/:id", handler.MessageDelete)
 
 	// emotes
+	apiGroup.GET("/emotes", handler.ListEmotes)
+	apiGroup.GET("/emotes/bundle", handler.GetEmoteBundle)
+	apiGroup.GET("/emotes/stats", handler.EmoteStatsGet)
 	apiGroup.GET("/emotes/:id", handler.GetEmote)
+	apiGroup.POST("/emotes/gc", handler.EmotesGC)
 	apiGroup.GET("/emotes/whitelist", handler.EmoteWhitelistGet)
 	apiGroup.POST("/emotes/whitelist", handler.EmoteWhitelistPost)
 	apiGroup.DELETE("/emotes/whitelist", handler.EmoteWhitelistDelete)
 
 	// stream info
 	apiGroup.GET("/stream-info", handler.TwitchGetStreamInfo)
+	apiGroup.GET("/stream-info/history", handler.StreamInfoHistoryGet)
+	apiGroup.POST("/stream-info/revert", handler.StreamInfoRevert)
 	apiGroup.GET("/stream-info-presets", handler.StreamInfoPresetGet)
 	apiGroup.POST("/stream-info-presets", handler.StreamInfoPresetPost)
+	apiGroup.POST("/stream-info-presets/from-current", handler.StreamInfoPresetFromCurrent)
+	apiGroup.GET("/stream-info-presets/export", handler.StreamInfoPresetExport)
+	apiGroup.POST("/stream-info-presets/import", handler.StreamInfoPresetImport)
+	apiGroup.PUT("/stream-info-presets/order", handler.StreamInfoPresetReorder)
+	apiGroup.GET("/stream-info-presets/recent", handler.StreamInfoPresetRecent)
 	apiGroup.PUT("/stream-info-presets/:id", handler.StreamInfoPresetPut)
 	apiGroup.DELETE("/stream-info-presets/:id", handler.StreamInfoPresetDelete)
 	apiGroup.POST("/stream-info-presets/:id/apply", handler.StreamInfoPresetApply)
+	apiGroup.POST("/stream-info-presets/:id/preview", handler.StreamInfoPresetPreview)
+	apiGroup.GET("/stream-info-templates", handler.StreamInfoTemplatesGet)
+	apiGroup.PUT("/stream-info-templates", handler.StreamInfoTemplatesPut)
+	apiGroup.GET("/tag-presets", handler.TagPresetGet)
+	apiGroup.POST("/tag-presets", handler.TagPresetPost)
+	apiGroup.PUT("/tag-presets/:id", handler.TagPresetPut)
+	apiGroup.DELETE("/tag-presets/:id", handler.TagPresetDelete)
+	apiGroup.POST("/tag-presets/:id/toggle", handler.TagPresetToggle)
+	apiGroup.GET("/schedules", handler.SchedulesGet)
 
 	// Twitch routes
+	apiGroup.GET("/auth/identities", handler.TwitchIdentitiesGet)
 	apiGroup.GET("/auth/twitch", handler.TwitchLogin)
 	apiGroup.POST("/auth/twitch", handler.TwitchCallback)
 	apiGroup.DELETE("/auth/twitch", handler.TwitchLogout)
 	apiGroup.GET("/auth/twitch/valid", handler.TwitchValidateAuth)
+	apiGroup.PUT("/auth/twitch/client-secret", handler.TwitchClientSecretPut)
+	apiGroup.GET("/auth/twitch/:identity", handler.TwitchLogin)
+	apiGroup.DELETE("/auth/twitch/:identity", handler.TwitchLogout)
 	apiGroup.POST("/twitch/link-filtering", handler.TwitchLinkFiltering)
 	apiGroup.GET("/twitch/categories", handler.TwitchCategorySearch)
 	apiGroup.POST("/twitch/ban-user", handler.TwitchBanUser)
+	apiGroup.GET("/twitch/broadcaster", handler.TwitchBroadcasterGet)
+	apiGroup.PUT("/twitch/broadcaster", handler.TwitchBroadcasterPut)
+
+	return e, nil
+}
+
+func Start(msgChan chan livechat.Message, emc *livechat.EmoteCache, emoteStats *livechat.EmoteStats) (*echo.Echo, error) {
+	e, err := NewServer(msgChan, emc, emoteStats)
+	if err != nil {
+		return nil, err
+	}
 
 	// Start server in a goroutine
 	go func() {
@@ -88,6 +144,7 @@ func Start(msgChan chan livechat.Message, emc *livechat.EmoteCache) (*echo.Echo,
 
 	// start background tasks
 	go pruneOldMessages()
+	go scheduler.run(context.Background())
 
 	return e, nil
 }
@@ -23,8 +23,9 @@ var (
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
-		// You can customize this to allow different origins
-		return true
+		// non-browser clients don't send an origin
+		origin := r.Header.Get("Origin")
+		return origin == "" || originAllowed(origin)
 	},
 }
 
@@ -63,6 +64,40 @@ func pruneOldMessages() {
 	}
 }
 
+// AuthStateEvent tells the UI when a platform login stops working
+type AuthStateEvent struct {
+	Type     string            `json:"type"`
+	Platform livechat.Platform `json:"platform"`
+	Identity string            `json:"identity,omitempty"`
+	Valid    bool              `json:"valid"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// broadcast sends raw JSON to all connected WebSocket clients
+func broadcast(msgJson []byte) {
+	wsClientsMu.Lock()
+	defer wsClientsMu.Unlock()
+
+	for client := range wsClients {
+		err := client.WriteMessage(websocket.TextMessage, msgJson)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to send message to WebSocket client")
+			client.Close()
+			delete(wsClients, client) // Remove clients that fail to receive the message
+		}
+	}
+}
+
+// BroadcastEvent sends a non-chat event to all connected WebSocket clients
+func BroadcastEvent(event any) {
+	eventJson, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal event to JSON")
+		return
+	}
+	broadcast(eventJson)
+}
+
 func (h *Handler) MessageWebsocket(ctx echo.Context) error {
 	// Upgrade the HTTP connection to a WebSocket
 	ws, err := upgrader.Upgrade(ctx.Response(), ctx.Request(), nil)
@@ -107,16 +142,7 @@ func (h *Handler) MessageWebsocket(ctx echo.Context) error {
 			}
 
 			// Broadcast the message to all connected WebSocket clients
-			wsClientsMu.Lock()
-			for client := range wsClients {
-				err := client.WriteMessage(websocket.TextMessage, msgJson)
-				if err != nil {
-					log.Error().Err(err).Msg("failed to send message to WebSocket client")
-					client.Close()
-					delete(wsClients, client) // Remove clients that fail to receive the message
-				}
-			}
-			wsClientsMu.Unlock()
+			broadcast(msgJson)
 		}
 	}()
 
@@ -140,12 +166,18 @@ func (h *Handler) MessageDelete(ctx echo.Context) error {
 
 	// delete twitch message
 	if string(msg.Platform) == string(livechat.Twitch) {
-		twitchAuth, err := helpers.GetTwitchAuth()
+		twitchAuth, err := helpers.GetTwitchAuthFor(helpers.TwitchBot)
 		if err != nil {
 			return echo.NewHTTPError(500, "failed to load twitch auth")
 		}
 
-		if err := twitch.DeleteMessage(twitchAuth, msg.ID); err != nil {
+		err = twitch.NewClient(twitchAuth).DeleteMessage(ctx.Request().Context(), msg.ID)
+		auditAction(ctx, "message.delete", msg.Sender.Name, map[string]any{
+			"message_id": msg.ID,
+			"body":       msg.Body,
+			"sender_id":  msg.Sender.ID,
+		}, err)
+		if err != nil {
 			log.Error().Err(err).Msg("failed to delete twitch chat message")
 			return echo.NewHTTPError(500, "failed to delete message")
 		}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// routePermissions maps each route registered in Start to the minimum role
+// needed to use it. Routes missing from the matrix are owner only.
+var routePermissions = map[string]config.Role{
+	// admin auth
+	"POST /api/auth/logout":   config.RoleViewer,
+	"GET /api/auth/session":   config.RoleViewer,
+	"PUT /api/auth/password":  config.RoleViewer,
+	"GET /api/users":          config.RoleOwner,
+	"POST /api/users":         config.RoleOwner,
+	"PUT /api/users/:name":    config.RoleOwner,
+	"DELETE /api/users/:name": config.RoleOwner,
+	"GET /api/audit":          config.RoleModerator,
+
+	// messages
+	"GET /api/messages":        config.RoleViewer,
+	"DELETE /api/messages/:id": config.RoleModerator,
+
+	// emotes
+	"GET /api/emotes":              config.RoleViewer,
+	"GET /api/emotes/bundle":       config.RoleViewer,
+	"GET /api/emotes/stats":        config.RoleViewer,
+	"GET /api/emotes/:id":          config.RoleViewer,
+	"POST /api/emotes/gc":          config.RoleOwner,
+	"GET /api/emotes/whitelist":    config.RoleViewer,
+	"POST /api/emotes/whitelist":   config.RoleOwner,
+	"DELETE /api/emotes/whitelist": config.RoleOwner,
+
+	// stream info
+	"GET /api/stream-info":                       config.RoleViewer,
+	"GET /api/stream-info/history":               config.RoleViewer,
+	"POST /api/stream-info/revert":               config.RoleModerator,
+	"GET /api/stream-info-presets":               config.RoleViewer,
+	"POST /api/stream-info-presets":              config.RoleOwner,
+	"POST /api/stream-info-presets/from-current": config.RoleOwner,
+	"GET /api/stream-info-presets/export":        config.RoleViewer,
+	"POST /api/stream-info-presets/import":       config.RoleOwner,
+	"PUT /api/stream-info-presets/order":         config.RoleOwner,
+	"GET /api/stream-info-presets/recent":        config.RoleViewer,
+	"PUT /api/stream-info-presets/:id":           config.RoleOwner,
+	"DELETE /api/stream-info-presets/:id":        config.RoleOwner,
+	"POST /api/stream-info-presets/:id/apply":    config.RoleModerator,
+	"POST /api/stream-info-presets/:id/preview":  config.RoleViewer,
+	"GET /api/stream-info-templates":             config.RoleViewer,
+	"PUT /api/stream-info-templates":             config.RoleOwner,
+	"GET /api/tag-presets":                       config.RoleViewer,
+	"POST /api/tag-presets":                      config.RoleOwner,
+	"PUT /api/tag-presets/:id":                   config.RoleOwner,
+	"DELETE /api/tag-presets/:id":                config.RoleOwner,
+	"POST /api/tag-presets/:id/toggle":           config.RoleModerator,
+	"GET /api/schedules":                         config.RoleViewer,
+
+	// Twitch routes
+	"GET /api/auth/identities":           config.RoleViewer,
+	"GET /api/auth/twitch/:identity":     config.RoleOwner,
+	"DELETE /api/auth/twitch/:identity":  config.RoleOwner,
+	"GET /api/auth/twitch":               config.RoleOwner,
+	"POST /api/auth/twitch":              config.RoleOwner,
+	"DELETE /api/auth/twitch":            config.RoleOwner,
+	"PUT /api/auth/twitch/client-secret": config.RoleOwner,
+	"GET /api/auth/twitch/valid":         config.RoleViewer,
+	"POST /api/twitch/link-filtering":    config.RoleModerator,
+	"GET /api/twitch/categories":         config.RoleViewer,
+	"GET /api/twitch/broadcaster":        config.RoleViewer,
+	"PUT /api/twitch/broadcaster":        config.RoleOwner,
+	"POST /api/twitch/ban-user":          config.RoleModerator,
+}
+
+// RequirePermission checks the session role against the route permissions,
+// it must run after RequireAuth
+func RequirePermission(skipPaths ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			for _, path := range skipPaths {
+				if ctx.Path() == path {
+					return next(ctx)
+				}
+			}
+
+			required, ok := routePermissions[ctx.Request().Method+" "+ctx.Path()]
+			if !ok {
+				required = config.RoleOwner
+			}
+			sess := currentSession(ctx)
+			if sess == nil || !sess.Role.Includes(required) {
+				log.Warn().Str("actor", actor(ctx)).Str("route", ctx.Request().Method+" "+ctx.Path()).Msg("permission denied")
+				return echo.NewHTTPError(403, "insufficient permissions")
+			}
+
+			return next(ctx)
+		}
+	}
+}
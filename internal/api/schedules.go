@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/cron"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// scheduleInterval is how often due presets are checked
+	scheduleInterval = 15 * time.Second
+
+	// schedulerActor is shown in the audit log for scheduled applies
+	schedulerActor = "scheduler"
+)
+
+type ScheduleRun struct {
+	At      time.Time `json:"at"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type ScheduleResponse struct {
+	PresetID   string                `json:"presetId"`
+	PresetName string                `json:"presetName"`
+	Schedule   config.PresetSchedule `json:"schedule"`
+	NextRun    *time.Time            `json:"nextRun"`
+	LastRun    *ScheduleRun          `json:"lastRun"`
+}
+
+// presetScheduler applies presets when their schedule is due. Cron and
+// one-shot schedules are checked against the previous tick, schedules
+// relative to the stream going live against the time it went live.
+type presetScheduler struct {
+	mu          sync.Mutex
+	lastCheck   time.Time
+	onlineAt    time.Time // zero while offline
+	onlineCheck time.Time
+	lastRuns    map[string]ScheduleRun
+}
+
+var scheduler = &presetScheduler{lastRuns: map[string]ScheduleRun{}}
+
+// validateSchedule checks a schedule before it is saved
+func validateSchedule(schedule *config.PresetSchedule) error {
+	if schedule == nil {
+		return nil
+	}
+
+	set := 0
+	for _, value := range []string{schedule.Cron, schedule.At, schedule.AfterOnline} {
+		if value != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("schedule needs exactly one of cron, at or afterOnline")
+	}
+
+	if schedule.Cron != "" {
+		if _, err := cron.Parse(schedule.Cron); err != nil {
+			return fmt.Errorf("invalid cron schedule: %w", err)
+		}
+	}
+	if schedule.At != "" {
+		if _, err := time.Parse(time.RFC3339, schedule.At); err != nil {
+			return errors.New("schedule at must be an RFC3339 time")
+		}
+	}
+	if schedule.AfterOnline != "" {
+		if offset, err := time.ParseDuration(schedule.AfterOnline); err != nil || offset < 0 {
+			return errors.New("schedule afterOnline must be a positive duration, e.g. 30m")
+		}
+	}
+
+	return nil
+}
+
+// nextRun returns when a schedule is due after a time, zero if never. Must
+// be called with the lock held.
+func (ps *presetScheduler) nextRun(schedule *config.PresetSchedule, after time.Time) time.Time {
+	if schedule == nil || !schedule.Enabled {
+		return time.Time{}
+	}
+
+	switch {
+	case schedule.Cron != "":
+		expr, err := cron.Parse(schedule.Cron)
+		if err != nil {
+			return time.Time{}
+		}
+		return expr.Next(after.In(time.Local))
+
+	case schedule.At != "":
+		at, err := time.Parse(time.RFC3339, schedule.At)
+		if err != nil || !at.After(after) {
+			return time.Time{}
+		}
+		return at
+
+	case schedule.AfterOnline != "":
+		offset, err := time.ParseDuration(schedule.AfterOnline)
+		if err != nil || ps.onlineAt.IsZero() {
+			return time.Time{}
+		}
+		if at := ps.onlineAt.Add(offset); at.After(after) {
+			return at
+		}
+	}
+
+	return time.Time{}
+}
+
+// checkFrom is the time a schedule was last checked
+func (ps *presetScheduler) checkFrom(schedule *config.PresetSchedule) time.Time {
+	if schedule.AfterOnline != "" {
+		return ps.onlineCheck
+	}
+	return ps.lastCheck
+}
+
+// due returns the presets to apply now, in the order they were due
+func (ps *presetScheduler) due(now time.Time) []config.StreamInfoPreset {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	type duePreset struct {
+		preset config.StreamInfoPreset
+		at     time.Time
+	}
+	duePresets := []duePreset{}
+	for _, preset := range loadPresets() {
+		if preset.Schedule == nil {
+			continue
+		}
+		next := ps.nextRun(preset.Schedule, ps.checkFrom(preset.Schedule))
+		if !next.IsZero() && !next.After(now) {
+			duePresets = append(duePresets, duePreset{preset: preset, at: next})
+		}
+	}
+	ps.lastCheck = now
+	if !ps.onlineAt.IsZero() {
+		ps.onlineCheck = now
+	}
+
+	sort.SliceStable(duePresets, func(i, j int) bool { return duePresets[i].at.Before(duePresets[j].at) })
+	presets := make([]config.StreamInfoPreset, len(duePresets))
+	for idx, due := range duePresets {
+		presets[idx] = due.preset
+	}
+	return presets
+}
+
+// tick applies every due preset
+func (ps *presetScheduler) tick(ctx context.Context, now time.Time) {
+	for _, preset := range ps.due(now) {
+		err := applyPreset(ctx, schedulerActor, preset)
+		run := ScheduleRun{At: now, Success: err == nil}
+		if err != nil {
+			run.Error = err.Error()
+			log.Error().Err(err).Str("preset", preset.Name).Msg("failed to apply scheduled preset")
+		} else {
+			log.Info().Str("preset", preset.Name).Msg("applied scheduled preset")
+		}
+
+		ps.mu.Lock()
+		ps.lastRuns[preset.ID] = run
+		ps.mu.Unlock()
+	}
+}
+
+func (ps *presetScheduler) run(ctx context.Context) {
+	ps.mu.Lock()
+	ps.lastCheck = time.Now()
+	ps.mu.Unlock()
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ps.tick(ctx, now)
+		}
+	}
+}
+
+// setStreamStatus starts or stops the schedules relative to going live
+func (ps *presetScheduler) setStreamStatus(status twitch.StreamStatus) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if !status.Online {
+		ps.onlineAt = time.Time{}
+		return
+	}
+	ps.onlineAt = status.StartedAt
+	if ps.onlineAt.IsZero() {
+		ps.onlineAt = time.Now()
+	}
+	// the event may arrive after the stream started, include that gap
+	ps.onlineCheck = ps.onlineAt.Add(-time.Nanosecond)
+}
+
+// resumeStreamStatus picks up a stream that was already live when the server
+// started. Like cron runs while the server was down, schedules that were due
+// before now are skipped.
+func (ps *presetScheduler) resumeStreamStatus(status twitch.StreamStatus) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if !status.Online || !ps.onlineAt.IsZero() {
+		return
+	}
+	ps.onlineAt = status.StartedAt
+	ps.onlineCheck = time.Now()
+}
+
+// ResumeStreamStatus is called at startup with the current stream status. The
+// stream count isn't bumped, the stream may have been counted before a restart.
+func ResumeStreamStatus(status twitch.StreamStatus) {
+	log.Info().Bool("online", status.Online).Time("startedAt", status.StartedAt).Msg("resuming stream status")
+	scheduler.resumeStreamStatus(status)
+}
+
+// HandleStreamStatus is called by the Twitch listener as the stream goes
+// live or offline
+func HandleStreamStatus(status twitch.StreamStatus) {
+	log.Info().Bool("online", status.Online).Time("startedAt", status.StartedAt).Msg("stream status changed")
+	if status.Online {
+		countStream()
+	}
+	scheduler.setStreamStatus(status)
+}
+
+func (h *Handler) SchedulesGet(ctx echo.Context) error {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	schedules := []ScheduleResponse{}
+	for _, preset := range loadPresets() {
+		if preset.Schedule == nil {
+			continue
+		}
+		schedule := ScheduleResponse{
+			PresetID:   preset.ID,
+			PresetName: preset.Name,
+			Schedule:   *preset.Schedule,
+		}
+		if next := scheduler.nextRun(preset.Schedule, time.Now()); !next.IsZero() {
+			schedule.NextRun = &next
+		}
+		if lastRun, ok := scheduler.lastRuns[preset.ID]; ok {
+			schedule.LastRun = &lastRun
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	// upcoming first, then the ones without a next run
+	sort.SliceStable(schedules, func(i, j int) bool {
+		if schedules[i].NextRun == nil || schedules[j].NextRun == nil {
+			return schedules[j].NextRun == nil && schedules[i].NextRun != nil
+		}
+		return schedules[i].NextRun.Before(*schedules[j].NextRun)
+	})
+
+	return ctx.JSON(200, schedules)
+}
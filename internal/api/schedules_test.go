@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+)
+
+func TestValidateSchedule(t *testing.T) {
+	valid := []*config.PresetSchedule{
+		nil,
+		{Cron: "0 18 * * 1-5"},
+		{At: "2030-01-01T18:00:00Z"},
+		{AfterOnline: "30m"},
+	}
+	for _, schedule := range valid {
+		if err := validateSchedule(schedule); err != nil {
+			t.Errorf("%+v: %v", schedule, err)
+		}
+	}
+
+	invalid := []*config.PresetSchedule{
+		{},
+		{Cron: "0 18 * * *", AfterOnline: "30m"},
+		{Cron: "every day"},
+		{At: "tomorrow"},
+		{AfterOnline: "-5m"},
+	}
+	for _, schedule := range invalid {
+		if err := validateSchedule(schedule); err == nil {
+			t.Errorf("%+v: expected an error", schedule)
+		}
+	}
+}
+
+func schedulePreset(name string, title string, schedule config.PresetSchedule) config.StreamInfoPreset {
+	preset := config.StreamInfoPreset{ID: name, Name: name, Title: title, Tags: []string{}, Schedule: &schedule}
+	preset.Category.ID = "509658"
+	return preset
+}
+
+func TestSchedulerCron(t *testing.T) {
+	srv, _ := newTestAPI(t)
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{
+		schedulePreset("every-minute", "scheduled title", config.PresetSchedule{Enabled: true, Cron: "* * * * *"}),
+		schedulePreset("disabled", "disabled title", config.PresetSchedule{Enabled: false, Cron: "* * * * *"}),
+		schedulePreset("yearly", "yearly title", config.PresetSchedule{Enabled: true, Cron: "0 0 1 1 *"}),
+	}
+
+	now := time.Now()
+	scheduler.lastCheck = now.Add(-2 * time.Minute)
+	scheduler.tick(context.Background(), now)
+	if title := srv.Channel(broadcasterID).Title; title != "scheduled title" {
+		t.Errorf("expected the due preset to be applied, got %q", title)
+	}
+	if run, ok := scheduler.lastRuns["every-minute"]; !ok || !run.Success {
+		t.Errorf("unexpected last run %+v", run)
+	}
+	if _, ok := scheduler.lastRuns["disabled"]; ok {
+		t.Error("disabled schedules shouldn't run")
+	}
+	if entry := lastAudit(t, "preset.apply"); entry.Actor != schedulerActor {
+		t.Errorf("expected the scheduler as actor, got %q", entry.Actor)
+	}
+
+	// nothing is due until the next minute
+	requests := len(srv.Requests("PATCH /helix/channels"))
+	scheduler.tick(context.Background(), now.Add(time.Second))
+	if len(srv.Requests("PATCH /helix/channels")) != requests {
+		t.Error("expected no apply within the same minute")
+	}
+
+	// failures are kept as the last result
+	srv.Fail("PATCH /helix/channels", 400, "Invalid game_id")
+	scheduler.tick(context.Background(), now.Add(time.Minute))
+	if run := scheduler.lastRuns["every-minute"]; run.Success || run.Error == "" {
+		t.Errorf("unexpected last run %+v", run)
+	}
+}
+
+func TestSchedulerAfterOnline(t *testing.T) {
+	srv, _ := newTestAPI(t)
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{
+		schedulePreset("opening", "just chatting", config.PresetSchedule{Enabled: true, AfterOnline: "0s"}),
+		schedulePreset("main", "main game", config.PresetSchedule{Enabled: true, AfterOnline: "30m"}),
+	}
+	now := time.Now()
+	scheduler.lastCheck = now
+
+	// nothing runs while offline
+	scheduler.tick(context.Background(), now)
+	if len(scheduler.lastRuns) != 0 {
+		t.Fatalf("unexpected runs %+v", scheduler.lastRuns)
+	}
+
+	// the event arrives after the stream started, the opening preset still runs
+	HandleStreamStatus(twitch.StreamStatus{BroadcasterID: broadcasterID, Online: true, StartedAt: now.Add(-10 * time.Second)})
+	scheduler.tick(context.Background(), now.Add(15*time.Second))
+	if title := srv.Channel(broadcasterID).Title; title != "just chatting" {
+		t.Errorf("expected the opening preset, got %q", title)
+	}
+	if _, ok := scheduler.lastRuns["main"]; ok {
+		t.Error("the main preset isn't due yet")
+	}
+
+	scheduler.tick(context.Background(), now.Add(30*time.Minute))
+	if title := srv.Channel(broadcasterID).Title; title != "main game" {
+		t.Errorf("expected the main preset, got %q", title)
+	}
+
+	// each runs once per stream
+	requests := len(srv.Requests("PATCH /helix/channels"))
+	scheduler.tick(context.Background(), now.Add(45*time.Minute))
+	if len(srv.Requests("PATCH /helix/channels")) != requests {
+		t.Error("expected no more applies")
+	}
+
+	HandleStreamStatus(twitch.StreamStatus{BroadcasterID: broadcasterID, Online: false})
+	if next := scheduler.nextRun(config.Cfg.StreamInfoPresets[1].Schedule, now); !next.IsZero() {
+		t.Errorf("expected no next run while offline, got %s", next)
+	}
+}
+
+func TestSchedulerResume(t *testing.T) {
+	srv, _ := newTestAPI(t)
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{
+		schedulePreset("opening", "just chatting", config.PresetSchedule{Enabled: true, AfterOnline: "0s"}),
+		schedulePreset("main", "main game", config.PresetSchedule{Enabled: true, AfterOnline: "70m"}),
+	}
+	now := time.Now()
+
+	// the server starts an hour into the stream
+	ResumeStreamStatus(twitch.StreamStatus{BroadcasterID: broadcasterID, Online: true, StartedAt: now.Add(-time.Hour)})
+	scheduler.tick(context.Background(), now.Add(time.Minute))
+	if _, ok := scheduler.lastRuns["opening"]; ok {
+		t.Error("the opening preset was due before the restart")
+	}
+	scheduler.tick(context.Background(), now.Add(11*time.Minute))
+	if title := srv.Channel(broadcasterID).Title; title != "main game" {
+		t.Errorf("expected the main preset, got %q", title)
+	}
+
+	// the stream going live through the listener isn't overridden
+	started := scheduler.onlineAt
+	ResumeStreamStatus(twitch.StreamStatus{BroadcasterID: broadcasterID, Online: true, StartedAt: now})
+	if !scheduler.onlineAt.Equal(started) {
+		t.Errorf("expected the stream start to be kept, got %s", scheduler.onlineAt)
+	}
+}
+
+func TestSchedulesGet(t *testing.T) {
+	_, e := newTestAPI(t)
+	at := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{
+		schedulePreset("relative", "relative", config.PresetSchedule{Enabled: true, AfterOnline: "30m"}),
+		schedulePreset("yearly", "yearly", config.PresetSchedule{Enabled: true, Cron: "0 0 1 1 *"}),
+		schedulePreset("once", "once", config.PresetSchedule{Enabled: true, At: at.Format(time.RFC3339)}),
+		{ID: "unscheduled", Name: "unscheduled"},
+	}
+	scheduler.lastRuns["yearly"] = ScheduleRun{At: time.Now(), Success: true}
+
+	rec := request(t, e, http.MethodGet, "/api/schedules", nil)
+	if rec.Code != 200 {
+		t.Fatalf("failed to list schedules: %d %s", rec.Code, rec.Body)
+	}
+	schedules := decode[[]ScheduleResponse](t, rec)
+	if len(schedules) != 3 {
+		t.Fatalf("expected 3 schedules, got %+v", schedules)
+	}
+	if schedules[0].PresetID != "once" || !schedules[0].NextRun.Equal(at) {
+		t.Errorf("expected the one-shot schedule first, got %+v", schedules[0])
+	}
+	if schedules[1].PresetID != "yearly" || schedules[1].LastRun == nil || !schedules[1].LastRun.Success {
+		t.Errorf("unexpected schedule %+v", schedules[1])
+	}
+	if schedules[2].PresetID != "relative" || schedules[2].NextRun != nil {
+		t.Errorf("expected the offline relative schedule last, got %+v", schedules[2])
+	}
+}
+
+func TestStreamInfoPresetScheduleValidation(t *testing.T) {
+	_, e := newTestAPI(t)
+
+	preset := config.StreamInfoPreset{Name: "bad", Schedule: &config.PresetSchedule{Enabled: true, Cron: "61 * * * *"}}
+	if rec := request(t, e, http.MethodPost, "/api/stream-info-presets", preset); rec.Code != 400 {
+		t.Errorf("expected 400, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestSchedulerConcurrentEdits(t *testing.T) {
+	_, e := newTestAPI(t)
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{
+		schedulePreset("scheduled", "scheduled title", config.PresetSchedule{Enabled: true, Cron: "* * * * *"}),
+		schedulePreset("edited", "edited title", config.PresetSchedule{Enabled: false, Cron: "* * * * *"}),
+		schedulePreset("deleted", "deleted title", config.PresetSchedule{Enabled: false, Cron: "* * * * *"}),
+	}
+	edited := schedulePreset("edited", "new title", config.PresetSchedule{Enabled: false, Cron: "* * * * *"})
+	edited.Category.Name = "Just Chatting"
+
+	// applying and marking presets runs alongside requests changing them
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		now := time.Now()
+		scheduler.mu.Lock()
+		scheduler.lastCheck = now.Add(-2 * time.Minute)
+		scheduler.mu.Unlock()
+		scheduler.tick(context.Background(), now)
+	}()
+	go func() {
+		defer wg.Done()
+		if rec := request(t, e, http.MethodPut, "/api/stream-info-presets/edited", edited); rec.Code != 200 {
+			t.Errorf("failed to update preset: %d %s", rec.Code, rec.Body)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if rec := request(t, e, http.MethodDelete, "/api/stream-info-presets/deleted", nil); rec.Code != 200 {
+			t.Errorf("failed to delete preset: %d %s", rec.Code, rec.Body)
+		}
+	}()
+	wg.Wait()
+
+	// every change is kept
+	presets := loadPresets()
+	if len(presets) != 2 {
+		t.Fatalf("expected 2 presets, got %+v", presets)
+	}
+	if presets[0].ID != "scheduled" || presets[0].LastApplied == "" {
+		t.Errorf("expected the scheduled preset to be marked applied, got %+v", presets[0])
+	}
+	if presets[1].ID != "edited" || presets[1].Title != "new title" {
+		t.Errorf("expected the edit to be kept, got %+v", presets[1])
+	}
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/secrets"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookieName = "stream_admin_session"
+	sessionContextKey = "session"
+	sessionTTL        = 24 * time.Hour
+	adminTokenSecret  = "admin_token"
+
+	// username used for the admin API token and the server password
+	adminUsername = "admin"
+)
+
+type session struct {
+	Token     string
+	Username  string
+	Role      config.Role
+	ExpiresAt time.Time
+}
+
+var (
+	sessions   map[string]session
+	sessionsMu sync.Mutex
+)
+
+func init() {
+	sessions = make(map[string]session)
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+}
+
+type LoginResponse struct {
+	Token     string      `json:"token"`
+	Username  string      `json:"username"`
+	Role      config.Role `json:"role"`
+	ExpiresAt time.Time   `json:"expires_at"`
+}
+
+type PasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// randomToken generates a hex encoded token from n random bytes
+func randomToken(n int) (string, error) {
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// ensureAdminToken generates the static admin API token on first start. The
+// token is logged once so it can be used to log in before a password is set.
+func ensureAdminToken() error {
+	// every store reports a missing secret as empty
+	token, err := secrets.Get(adminTokenSecret)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		return nil
+	}
+
+	token, err = randomToken(32)
+	if err != nil {
+		return err
+	}
+	if err := secrets.Set(adminTokenSecret, token); err != nil {
+		return err
+	}
+	log.Warn().Str("token", token).Msg("generated admin API token, use it to log in and set a password")
+
+	return nil
+}
+
+// validAdminToken checks a token against the static admin API token
+func validAdminToken(token string) bool {
+	adminToken, err := secrets.Get(adminTokenSecret)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load admin token")
+		return false
+	}
+	return adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+func newSession(username string, role config.Role) (session, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return session{}, err
+	}
+	sess := session{
+		Token:     token,
+		Username:  username,
+		Role:      role,
+		ExpiresAt: time.Now().Add(sessionTTL),
+	}
+
+	sessionsMu.Lock()
+	sessions[token] = sess
+	sessionsMu.Unlock()
+
+	return sess, nil
+}
+
+// findSession returns the session for a token, removing it if expired
+func findSession(token string) *session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	sess, ok := sessions[token]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		delete(sessions, token)
+		return nil
+	}
+	return &sess
+}
+
+func deleteSession(token string) {
+	sessionsMu.Lock()
+	delete(sessions, token)
+	sessionsMu.Unlock()
+}
+
+// requestToken reads the session or API token from the Authorization header,
+// the session cookie, or the access_token query param. The query param is
+// needed for websockets and OBS browser sources which can't set headers.
+func requestToken(ctx echo.Context) string {
+	if bearer, ok := strings.CutPrefix(ctx.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); ok {
+		return bearer
+	}
+	if cookie, err := ctx.Cookie(sessionCookieName); err == nil {
+		return cookie.Value
+	}
+	return ctx.QueryParam("access_token")
+}
+
+// RequireAuth rejects requests without a valid session or admin API token,
+// storing the session on the context for later middleware and handlers
+func RequireAuth(skipPaths ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			for _, path := range skipPaths {
+				if ctx.Path() == path {
+					return next(ctx)
+				}
+			}
+
+			token := requestToken(ctx)
+			if token == "" {
+				return echo.NewHTTPError(401, "authentication required")
+			}
+			sess := findSession(token)
+			if sess == nil {
+				if !validAdminToken(token) {
+					return echo.NewHTTPError(401, "invalid or expired session")
+				}
+				// the admin API token has full access
+				sess = &session{Username: adminUsername, Role: config.RoleOwner}
+			}
+			ctx.Set(sessionContextKey, sess)
+
+			return next(ctx)
+		}
+	}
+}
+
+// currentSession returns the session stored by RequireAuth
+func currentSession(ctx echo.Context) *session {
+	sess, _ := ctx.Get(sessionContextKey).(*session)
+	return sess
+}
+
+// actor returns the username performing the request
+func actor(ctx echo.Context) string {
+	if sess := currentSession(ctx); sess != nil {
+		return sess.Username
+	}
+	return ""
+}
+
+// originAllowed checks an origin against the configured CORS allowlist
+func originAllowed(origin string) bool {
+	for _, allowed := range config.Cfg.Server.AllowOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) Login(ctx echo.Context) error {
+	// unmarshal request
+	body := new(LoginRequest)
+	if err := ctx.Bind(body); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal request body")
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	// check the credentials, falling back to the server password or admin token
+	username := adminUsername
+	role := config.RoleOwner
+	switch {
+	case body.Username != "":
+		user := findUser(body.Username)
+		if user == nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(body.Password)) != nil {
+			log.Warn().Str("ip", ctx.RealIP()).Str("username", body.Username).Msg("failed login attempt")
+			return echo.NewHTTPError(401, "invalid credentials")
+		}
+		username = user.Username
+		role = user.Role
+	case body.Password != "" && config.Cfg.Server.PasswordHash != "":
+		if err := bcrypt.CompareHashAndPassword([]byte(config.Cfg.Server.PasswordHash), []byte(body.Password)); err != nil {
+			log.Warn().Str("ip", ctx.RealIP()).Msg("failed login attempt")
+			return echo.NewHTTPError(401, "invalid credentials")
+		}
+	case body.Token != "":
+		if !validAdminToken(body.Token) {
+			log.Warn().Str("ip", ctx.RealIP()).Msg("failed login attempt")
+			return echo.NewHTTPError(401, "invalid credentials")
+		}
+	default:
+		return echo.NewHTTPError(401, "invalid credentials")
+	}
+
+	// issue session
+	sess, err := newSession(username, role)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create session")
+		return echo.NewHTTPError(500, "failed to create session")
+	}
+	ctx.SetCookie(&http.Cookie{
+		Name:     sessionCookieName,
+		Value:    sess.Token,
+		Path:     "/api",
+		Expires:  sess.ExpiresAt,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(config.Cfg.Server.BaseURL, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return ctx.JSON(200, LoginResponse{
+		Token:     sess.Token,
+		Username:  sess.Username,
+		Role:      sess.Role,
+		ExpiresAt: sess.ExpiresAt,
+	})
+}
+
+func (h *Handler) Logout(ctx echo.Context) error {
+	deleteSession(requestToken(ctx))
+	ctx.SetCookie(&http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/api",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	return ctx.NoContent(204)
+}
+
+func (h *Handler) SessionGet(ctx echo.Context) error {
+	sess := currentSession(ctx)
+	res := map[string]any{
+		"authenticated": true,
+		"username":      sess.Username,
+		"role":          sess.Role,
+	}
+	if !sess.ExpiresAt.IsZero() {
+		res["expires_at"] = sess.ExpiresAt
+	}
+
+	return ctx.JSON(200, res)
+}
+
+func (h *Handler) PasswordPut(ctx echo.Context) error {
+	// unmarshal request
+	body := new(PasswordRequest)
+	if err := ctx.Bind(body); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal request body")
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+	if len(body.Password) < 8 {
+		return echo.NewHTTPError(400, "password must be at least 8 characters")
+	}
+
+	// hash the password
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to hash password")
+		return echo.NewHTTPError(500, "failed to hash password")
+	}
+
+	// API users change their own password
+	if user := findUser(actor(ctx)); user != nil {
+		user.PasswordHash = string(hash)
+		if err := config.SetConfigValue("users", config.Cfg.Users); err != nil {
+			log.Error().Err(err).Msg("failed to persist users")
+			return echo.NewHTTPError(500, "failed to save password")
+		}
+		return ctx.NoContent(204)
+	}
+
+	// everyone else changes the server password
+	if err := config.SetConfigValue("server.passwordHash", string(hash)); err != nil {
+		log.Error().Err(err).Msg("failed to persist password hash")
+		return echo.NewHTTPError(500, "failed to save password")
+	}
+	config.Cfg.Server.PasswordHash = string(hash)
+
+	return ctx.NoContent(204)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/helpers"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/nullvt/stream-admin/internal/streaminfo"
+	"github.com/rs/zerolog/log"
+)
+
+type StreamInfoRevertRequest struct {
+	// ID is the history entry to undo, the latest one if empty
+	ID string `json:"id"`
+}
+
+// modifyChannel updates the channel and records the change in the stream
+// info history. The history is best effort, it never holds back a change.
+func modifyChannel(ctx context.Context, client *twitch.Client, broadcasterID string, entry streaminfo.HistoryEntry, update twitch.ModifyChannelInformationRequest) error {
+	before, err := client.GetChannelInformation(ctx, broadcasterID)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to read the channel before changing it, the change won't be in the history")
+	}
+
+	if err := client.ModifyChannelInformation(ctx, broadcasterID, update); err != nil {
+		return err
+	}
+	if before == nil {
+		return nil
+	}
+
+	entry.ID = uuid.NewString()
+	entry.Before = *before
+	if entry.After, err = client.GetChannelInformation(ctx, broadcasterID); err != nil {
+		log.Warn().Err(err).Msg("failed to read the channel after changing it")
+	}
+	if err := streaminfo.AppendHistory(entry); err != nil {
+		log.Error().Err(err).Msg("failed to write stream info history")
+	}
+
+	return nil
+}
+
+// restoreRequest turns channel information back into an update. The delay
+// is only sent when it differs as only partners can set it.
+func restoreRequest(info twitch.ChannelInformation, current *twitch.ChannelInformation) twitch.ModifyChannelInformationRequest {
+	branded := info.IsBrandedContent
+	update := twitch.ModifyChannelInformationRequest{
+		GameID:              info.GameID,
+		Title:               info.Title,
+		Tags:                info.Tags,
+		BroadcasterLanguage: info.BroadcasterLanguage,
+		IsBrandedContent:    &branded,
+	}
+	if update.Tags == nil {
+		update.Tags = []string{}
+	}
+	if info.Delay != current.Delay {
+		delay := info.Delay
+		update.Delay = &delay
+	}
+	for _, id := range streaminfo.ContentClassificationLabels {
+		update.ContentClassificationLabels = append(update.ContentClassificationLabels, twitch.ContentClassificationLabel{
+			ID:        id,
+			IsEnabled: slices.Contains(info.ContentClassificationLabels, id),
+		})
+	}
+
+	return update
+}
+
+func (h *Handler) StreamInfoHistoryGet(ctx echo.Context) error {
+	limit, err := parseIntParam(ctx, "limit", 50)
+	if err != nil {
+		return err
+	}
+
+	entries, err := streaminfo.History(limit)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read stream info history")
+		return echo.NewHTTPError(500, "failed to read stream info history")
+	}
+
+	return ctx.JSON(200, entries)
+}
+
+func (h *Handler) StreamInfoRevert(ctx echo.Context) error {
+	body := new(StreamInfoRevertRequest)
+	if err := ctx.Bind(body); err != nil {
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	// find the change to undo
+	entries, err := streaminfo.History(0)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read stream info history")
+		return echo.NewHTTPError(500, "failed to read stream info history")
+	}
+	var entry *streaminfo.HistoryEntry
+	for idx := range entries {
+		if body.ID == "" || entries[idx].ID == body.ID {
+			entry = &entries[idx]
+			break
+		}
+	}
+	if entry == nil {
+		return echo.NewHTTPError(404, "change not found")
+	}
+
+	// get twitch auth
+	twitchAuth, err := helpers.GetTwitchAuth()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get Twitch auth")
+		return echo.NewHTTPError(500)
+	}
+	if entry.Before.BroadcasterID != twitchAuth.BroadcasterID {
+		return echo.NewHTTPError(409, "the change was made to another channel")
+	}
+
+	// send req
+	client := twitch.NewClient(twitchAuth)
+	current, err := client.GetChannelInformation(ctx.Request().Context(), twitchAuth.BroadcasterID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get Twitch channel information")
+		return twitchHTTPError(err)
+	}
+	err = modifyChannel(ctx.Request().Context(), client, twitchAuth.BroadcasterID, streaminfo.HistoryEntry{
+		Actor:  actor(ctx),
+		Action: "stream_info.revert",
+		Target: entry.ID,
+	}, restoreRequest(entry.Before, current))
+	auditAction(ctx, "stream_info.revert", entry.ID, map[string]any{
+		"title":    entry.Before.Title,
+		"category": entry.Before.GameName,
+		"tags":     entry.Before.Tags,
+	}, err)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to revert Twitch channel info")
+		return twitchHTTPError(err)
+	}
+
+	return ctx.JSON(200, entry.Before)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/nullvt/stream-admin/internal/streaminfo"
+)
+
+func TestStreamInfoRevert(t *testing.T) {
+	srv, e := newTestAPI(t)
+	srv.SetChannel(twitch.ChannelInformation{
+		BroadcasterID:               broadcasterID,
+		Title:                       "old title",
+		GameID:                      "27471",
+		GameName:                    "Minecraft",
+		Tags:                        []string{"English"},
+		ContentClassificationLabels: []string{"Gambling"},
+	})
+	preset := config.StreamInfoPreset{ID: "wrong", Name: "wrong", Title: "wrong title", Tags: []string{}}
+	preset.Category.ID = "509658"
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{preset}
+
+	if rec := request(t, e, http.MethodPost, "/api/stream-info-presets/wrong/apply", nil); rec.Code != 200 {
+		t.Fatalf("failed to apply preset: %d %s", rec.Code, rec.Body)
+	}
+	history := decode[[]streaminfo.HistoryEntry](t, request(t, e, http.MethodGet, "/api/stream-info/history?limit=1", nil))
+	if len(history) != 1 || history[0].Action != "preset.apply" || history[0].Before.Title != "old title" || history[0].After.Title != "wrong title" {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	// the latest change is undone
+	rec := request(t, e, http.MethodPost, "/api/stream-info/revert", nil)
+	if rec.Code != 200 {
+		t.Fatalf("failed to revert: %d %s", rec.Code, rec.Body)
+	}
+	channel := srv.Channel(broadcasterID)
+	if channel.Title != "old title" || channel.GameID != "27471" || len(channel.Tags) != 1 || len(channel.ContentClassificationLabels) != 1 {
+		t.Errorf("unexpected channel %+v", channel)
+	}
+	revert := decode[[]streaminfo.HistoryEntry](t, request(t, e, http.MethodGet, "/api/stream-info/history", nil))[0]
+	if revert.Action != "stream_info.revert" || revert.Target != history[0].ID || revert.Before.Title != "wrong title" {
+		t.Errorf("unexpected history entry %+v", revert)
+	}
+	if entry := lastAudit(t, "stream_info.revert"); !entry.Success || entry.Target != history[0].ID {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+
+	// reverting a revert redoes the change
+	if rec := request(t, e, http.MethodPost, "/api/stream-info/revert", StreamInfoRevertRequest{ID: revert.ID}); rec.Code != 200 {
+		t.Fatalf("failed to revert: %d %s", rec.Code, rec.Body)
+	}
+	if title := srv.Channel(broadcasterID).Title; title != "wrong title" {
+		t.Errorf("unexpected title %q", title)
+	}
+
+	if rec := request(t, e, http.MethodPost, "/api/stream-info/revert", StreamInfoRevertRequest{ID: "missing"}); rec.Code != 404 {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
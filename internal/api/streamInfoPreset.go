@@ -1,21 +1,75 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"net/http"
-	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/nullvt/stream-admin/internal/config"
 	"github.com/nullvt/stream-admin/internal/helpers"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/nullvt/stream-admin/internal/streaminfo"
 	"github.com/rs/zerolog/log"
 )
 
+// presetsMu guards config.Cfg.StreamInfoPresets, which is changed by the
+// handlers and the scheduler
+var presetsMu sync.Mutex
+
+var errPresetNotFound = echo.NewHTTPError(404, "preset not found")
+
+// loadPresets returns a copy of the presets that is safe to use unlocked
+func loadPresets() []config.StreamInfoPreset {
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	return slices.Clone(config.Cfg.StreamInfoPresets)
+}
+
+// findPreset returns a copy of a preset by ID
+func findPreset(presetID string) (config.StreamInfoPreset, bool) {
+	presets := loadPresets()
+	idx := presetIndex(presets, presetID)
+	if idx == -1 {
+		return config.StreamInfoPreset{}, false
+	}
+	return presets[idx], true
+}
+
+// updatePresets persists the presets returned by update and returns them.
+// update receives a copy of the current presets and runs with the lock held,
+// so slow work such as validation has to happen before.
+func updatePresets(update func(presets []config.StreamInfoPreset) ([]config.StreamInfoPreset, error)) ([]config.StreamInfoPreset, error) {
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+
+	newPresets, err := update(slices.Clone(config.Cfg.StreamInfoPresets))
+	if err != nil {
+		return nil, err
+	}
+	if err := config.SetConfigValue("streamInfoPresets", newPresets); err != nil {
+		log.Error().Err(err).Msg("failed to persist StreamInfoPresets")
+		return nil, echo.NewHTTPError(500, "failed to save presets")
+	}
+	config.Cfg.StreamInfoPresets = newPresets
+
+	return slices.Clone(newPresets), nil
+}
+
+// presetIndex returns the index of a preset by ID, or -1
+func presetIndex(presets []config.StreamInfoPreset, presetID string) int {
+	return slices.IndexFunc(presets, func(preset config.StreamInfoPreset) bool { return preset.ID == presetID })
+}
+
 func (h *Handler) StreamInfoPresetGet(ctx echo.Context) error {
-	return ctx.JSON(200, config.Cfg.StreamInfoPresets)
+	return ctx.JSON(200, loadPresets())
 }
 
 func (h *Handler) StreamInfoPresetPost(ctx echo.Context) error {
@@ -28,25 +82,109 @@ func (h *Handler) StreamInfoPresetPost(ctx echo.Context) error {
 	var preset config.StreamInfoPreset
 	if err := json.Unmarshal(body, &preset); err != nil {
 		log.Error().Err(err).Msg("failed to unmarshal request body")
-		return echo.NewHTTPError(500, "failed to unmarshal request body")
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
 	}
 
 	// validate body
 	if preset.ID != "" {
 		return echo.NewHTTPError(400, "cannot create StreamInfoPreset with manually set ID")
 	}
+	if err := checkPreset(ctx, &preset); err != nil {
+		return err
+	}
 	preset.ID = uuid.NewString()
+	preset.LastApplied = ""
 
 	// save
-	newPresets := append(config.Cfg.StreamInfoPresets, preset)
-	if err := config.SetConfigValue("streamInfoPresets", newPresets); err != nil {
-		log.Error().Err(err).Msg("failed to persist StreamInfoPresets")
-		return echo.NewHTTPError(500, "failed to save presets")
+	newPresets, err := updatePresets(func(presets []config.StreamInfoPreset) ([]config.StreamInfoPreset, error) {
+		return append(presets, preset), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(200, newPresets)
+}
+
+type StreamInfoPresetFromCurrentRequest struct {
+	Name string `json:"name"`
+}
+
+// StreamInfoPresetFromCurrent saves the live channel settings as a new preset
+func (h *Handler) StreamInfoPresetFromCurrent(ctx echo.Context) error {
+	body := new(StreamInfoPresetFromCurrentRequest)
+	if err := ctx.Bind(body); err != nil {
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return echo.NewHTTPError(400, "preset name required")
+	}
+
+	// get twitch auth
+	twitchAuth, err := helpers.GetTwitchAuth()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get Twitch auth")
+		return echo.NewHTTPError(500)
+	}
+
+	// read the live settings
+	channel, err := twitch.NewClient(twitchAuth).GetChannelInformation(ctx.Request().Context(), twitchAuth.BroadcasterID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get Twitch channel information")
+		return twitchHTTPError(err)
+	}
+	preset := presetFromChannel(body.Name, channel)
+	if err := checkPreset(ctx, &preset); err != nil {
+		return err
+	}
+	preset.ID = uuid.NewString()
+
+	// save
+	newPresets, err := updatePresets(func(presets []config.StreamInfoPreset) ([]config.StreamInfoPreset, error) {
+		return append(presets, preset), nil
+	})
+	if err != nil {
+		return err
 	}
 
 	return ctx.JSON(200, newPresets)
 }
 
+// presetFromChannel copies channel information into a preset that restores
+// it when applied
+func presetFromChannel(name string, channel *twitch.ChannelInformation) config.StreamInfoPreset {
+	branded := channel.IsBrandedContent
+	preset := config.StreamInfoPreset{
+		Name:                        name,
+		Title:                       channel.Title,
+		Tags:                        channel.Tags,
+		BroadcasterLanguage:         channel.BroadcasterLanguage,
+		ContentClassificationLabels: []config.ContentClassificationLabel{},
+		IsBrandedContent:            &branded,
+	}
+	if preset.Tags == nil {
+		preset.Tags = []string{}
+	}
+	preset.Category.ID = channel.GameID
+	preset.Category.Name = channel.GameName
+
+	// only partners can set a delay, so it is left out unless used
+	if channel.Delay > 0 {
+		delay := channel.Delay
+		preset.Delay = &delay
+	}
+
+	// every label is listed so disabled ones are turned off again
+	for _, id := range streaminfo.ContentClassificationLabels {
+		preset.ContentClassificationLabels = append(preset.ContentClassificationLabels, config.ContentClassificationLabel{
+			ID:      id,
+			Enabled: slices.Contains(channel.ContentClassificationLabels, id),
+		})
+	}
+
+	return preset
+}
+
 func (h *Handler) StreamInfoPresetPut(ctx echo.Context) error {
 	// find preset in config
 	presetID := ctx.Param("id")
@@ -55,15 +193,8 @@ func (h *Handler) StreamInfoPresetPut(ctx echo.Context) error {
 	}
 
 	// Read existing preset
-	oldPresetIndex := -1
-	for i, preset := range config.Cfg.StreamInfoPresets {
-		if presetID == preset.ID {
-			oldPresetIndex = i
-			break
-		}
-	}
-	if oldPresetIndex == -1 {
-		return echo.NewHTTPError(404, "preset not found")
+	if _, ok := findPreset(presetID); !ok {
+		return errPresetNotFound
 	}
 
 	// read body
@@ -84,17 +215,26 @@ func (h *Handler) StreamInfoPresetPut(ctx echo.Context) error {
 	if preset.ID != presetID {
 		return echo.NewHTTPError(400, "you cannot change the ID of a preset")
 	}
+	if err := checkPreset(ctx, &preset); err != nil {
+		return err
+	}
 
-	// Update the existing preset in the slice
-	config.Cfg.StreamInfoPresets[oldPresetIndex] = preset
-
-	// Persist updated presets
-	if err := config.SetConfigValue("streamInfoPresets", config.Cfg.StreamInfoPresets); err != nil {
-		log.Error().Err(err).Msg("failed to persist StreamInfoPresets")
-		return echo.NewHTTPError(500, "failed to save presets")
+	// Update the existing preset, it may have been deleted while validating.
+	// Only applying sets LastApplied.
+	newPresets, err := updatePresets(func(presets []config.StreamInfoPreset) ([]config.StreamInfoPreset, error) {
+		idx := presetIndex(presets, presetID)
+		if idx == -1 {
+			return nil, errPresetNotFound
+		}
+		preset.LastApplied = presets[idx].LastApplied
+		presets[idx] = preset
+		return presets, nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return ctx.JSON(200, config.Cfg.StreamInfoPresets)
+	return ctx.JSON(200, newPresets)
 }
 
 func (h *Handler) StreamInfoPresetDelete(ctx echo.Context) error {
@@ -104,33 +244,19 @@ func (h *Handler) StreamInfoPresetDelete(ctx echo.Context) error {
 		return echo.NewHTTPError(400, "invalid preset id")
 	}
 
-	// Find the index of the preset to delete
-	oldPresetIndex := -1
-	for i, preset := range config.Cfg.StreamInfoPresets {
-		if presetID == preset.ID {
-			oldPresetIndex = i
-			break
+	// Remove the preset and persist the updated list of presets
+	newPresets, err := updatePresets(func(presets []config.StreamInfoPreset) ([]config.StreamInfoPreset, error) {
+		idx := presetIndex(presets, presetID)
+		if idx == -1 {
+			return nil, errPresetNotFound
 		}
+		return slices.Delete(presets, idx, idx+1), nil
+	})
+	if err != nil {
+		return err
 	}
 
-	// If no matching preset was found, return 404
-	if oldPresetIndex == -1 {
-		return echo.NewHTTPError(404, "preset not found")
-	}
-
-	// Remove the preset from the slice
-	config.Cfg.StreamInfoPresets = append(
-		config.Cfg.StreamInfoPresets[:oldPresetIndex],
-		config.Cfg.StreamInfoPresets[oldPresetIndex+1:]...,
-	)
-
-	// Persist the updated list of presets
-	if err := config.SetConfigValue("streamInfoPresets", config.Cfg.StreamInfoPresets); err != nil {
-		log.Error().Err(err).Msg("failed to persist StreamInfoPresets")
-		return echo.NewHTTPError(500, "failed to save presets")
-	}
-
-	return ctx.JSON(200, config.Cfg.StreamInfoPresets)
+	return ctx.JSON(200, newPresets)
 }
 
 func (h *Handler) StreamInfoPresetApply(ctx echo.Context) error {
@@ -141,64 +267,87 @@ func (h *Handler) StreamInfoPresetApply(ctx echo.Context) error {
 	}
 
 	// Read existing preset
-	var oldPresetIndex = -1
-	var preset config.StreamInfoPreset
-	for i, p := range config.Cfg.StreamInfoPresets {
-		if presetID == p.ID {
-			oldPresetIndex = i
-			preset = p
-			break
-		}
+	preset, ok := findPreset(presetID)
+	if !ok {
+		return errPresetNotFound
 	}
-	if oldPresetIndex == -1 {
-		return echo.NewHTTPError(404, "preset not found")
+
+	// send req
+	if err := applyPreset(ctx.Request().Context(), actor(ctx), preset); err != nil {
+		var templateErr *TemplateError
+		if errors.As(err, &templateErr) {
+			return echo.NewHTTPError(400, templateErr.Error())
+		}
+		log.Error().Err(err).Msg("failed to update Twitch channel info")
+		return twitchHTTPError(err)
 	}
 
+	return ctx.JSON(200, loadPresets())
+}
+
+// applyPreset updates the channel to a preset, recording the result in the
+// audit log under actorName
+func applyPreset(ctx context.Context, actorName string, preset config.StreamInfoPreset) error {
 	// get twitch auth
 	twitchAuth, err := helpers.GetTwitchAuth()
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get Twitch auth")
-		return echo.NewHTTPError(500)
+		return fmt.Errorf("failed to get Twitch auth: %w", err)
 	}
 
-	// build request
-	reqURL, _ := url.Parse("https://api.twitch.tv/helix/channels")
-	reqQuery := reqURL.Query()
-	reqQuery.Add("broadcaster_id", twitchAuth.UserID)
-	reqURL.RawQuery = reqQuery.Encode()
-	requestBody := TwitchModifyChannelInformationRequest{
-		GameID: preset.Category.ID,
-		Title:  preset.Title,
-		Tags:   preset.Tags,
-	}
-	bodyBytes, err := json.Marshal(requestBody)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to marshal request body")
-		return echo.NewHTTPError(500, "Failed to create request")
+	// resolve placeholders, nothing is sent if any fails
+	auditParams := map[string]any{
+		"preset_id": preset.ID,
+		"category":  preset.Category.Name,
 	}
-	req, err := http.NewRequest("PATCH", reqURL.String(), bytes.NewBuffer(bodyBytes))
-	if err != nil {
-		log.Error().Err(err).Msg("failed to init request")
-		return echo.NewHTTPError(500)
+	rendered, errs := renderPreset(preset, time.Now())
+	auditParams["title"] = rendered.Title
+	auditParams["tags"] = rendered.Tags
+	if len(errs) > 0 {
+		err := &TemplateError{Errors: errs}
+		auditActionBy(actorName, "preset.apply", preset.Name, auditParams, err)
+		return err
 	}
-	req.Header.Set("Client-Id", twitchAuth.ClientID)
-	req.Header.Set("Authorization", twitchAuth.Bearer())
-	req.Header.Set("Content-Type", "application/json")
+	preset = rendered
 
 	// send req
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to update Twitch channel info")
-		return echo.NewHTTPError(500, "twitch error")
+	change := streaminfo.HistoryEntry{Actor: actorName, Action: "preset.apply", Target: preset.Name}
+	err = modifyChannel(ctx, twitch.NewClient(twitchAuth), twitchAuth.BroadcasterID, change, twitch.ModifyChannelInformationRequest{
+		GameID:                      preset.Category.ID,
+		Title:                       preset.Title,
+		Tags:                        preset.Tags,
+		BroadcasterLanguage:         preset.BroadcasterLanguage,
+		Delay:                       preset.Delay,
+		ContentClassificationLabels: contentClassificationLabels(preset),
+		IsBrandedContent:            preset.IsBrandedContent,
+	})
+	auditActionBy(actorName, "preset.apply", preset.Name, auditParams, err)
+	if err == nil {
+		markApplied(preset.ID, time.Now())
 	}
-	defer res.Body.Close()
 
-	// check response code
-	if res.StatusCode != 204 {
-		log.Error().Any("responseCode", res.StatusCode).Msg("failed to update Twitch channel info")
-		return echo.NewHTTPError(500, "twitch error")
-	}
+	return err
+}
+
+// markApplied records when a preset was last applied, unless it was deleted
+// in the meantime. Failures to persist are logged by updatePresets.
+func markApplied(presetID string, at time.Time) {
+	updatePresets(func(presets []config.StreamInfoPreset) ([]config.StreamInfoPreset, error) {
+		idx := presetIndex(presets, presetID)
+		if idx == -1 {
+			return nil, errPresetNotFound
+		}
+		presets[idx].LastApplied = at.UTC().Format(time.RFC3339)
+		return presets, nil
+	})
+}
 
-	return ctx.JSON(200, config.Cfg.StreamInfoPresets)
+func contentClassificationLabels(preset config.StreamInfoPreset) []twitch.ContentClassificationLabel {
+	if len(preset.ContentClassificationLabels) == 0 {
+		return nil
+	}
+	labels := make([]twitch.ContentClassificationLabel, len(preset.ContentClassificationLabels))
+	for idx, label := range preset.ContentClassificationLabels {
+		labels[idx] = twitch.ContentClassificationLabel{ID: label.ID, IsEnabled: label.Enabled}
+	}
+	return labels
 }
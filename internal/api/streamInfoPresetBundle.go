@@ -0,0 +1,321 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/helpers"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// presetBundleVersion is bumped when the bundle format changes incompatibly
+const presetBundleVersion = 1
+
+// maxGamesPerRequest is the most categories Helix looks up at once
+const maxGamesPerRequest = 100
+
+// PresetBundle is the format presets are shared in, as JSON or YAML
+type PresetBundle struct {
+	Version    int                       `json:"version"`
+	ExportedAt time.Time                 `json:"exportedAt"`
+	Presets    []config.StreamInfoPreset `json:"presets"`
+}
+
+type mergeStrategy string
+
+const (
+	mergeSkip      mergeStrategy = "skip"
+	mergeOverwrite mergeStrategy = "overwrite"
+	mergeDuplicate mergeStrategy = "duplicate"
+)
+
+type PresetImportResult struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	// Result is created, skipped, overwritten or duplicated
+	Result string `json:"result"`
+}
+
+type PresetImportResponse struct {
+	Results []PresetImportResult      `json:"results"`
+	Presets []config.StreamInfoPreset `json:"presets"`
+}
+
+func (h *Handler) StreamInfoPresetExport(ctx echo.Context) error {
+	format := ctx.QueryParam("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "yaml" {
+		return echo.NewHTTPError(400, "format must be json or yaml")
+	}
+
+	// export everything unless ids are given
+	ids := ctx.QueryParams()["id"]
+	bundle := PresetBundle{
+		Version:    presetBundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Presets:    []config.StreamInfoPreset{},
+	}
+	for _, preset := range loadPresets() {
+		if len(ids) == 0 || slices.Contains(ids, preset.ID) {
+			bundle.Presets = append(bundle.Presets, preset)
+		}
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "stream-info-presets."+format))
+	if format == "json" {
+		return ctx.JSONPretty(200, bundle, "  ")
+	}
+	raw, err := marshalYAML(bundle)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to encode presets as YAML")
+		return echo.NewHTTPError(500, "failed to export presets")
+	}
+	return ctx.Blob(200, "application/yaml", raw)
+}
+
+func (h *Handler) StreamInfoPresetImport(ctx echo.Context) error {
+	strategy := mergeStrategy(ctx.QueryParam("strategy"))
+	if strategy == "" {
+		strategy = mergeSkip
+	}
+	if !slices.Contains([]mergeStrategy{mergeSkip, mergeOverwrite, mergeDuplicate}, strategy) {
+		return echo.NewHTTPError(400, "strategy must be skip, overwrite or duplicate")
+	}
+
+	// read body
+	raw, err := io.ReadAll(ctx.Request().Body)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read request body")
+		return echo.NewHTTPError(500, "failed to read request body")
+	}
+	bundle, err := unmarshalBundle(raw)
+	if err != nil {
+		return echo.NewHTTPError(400, "invalid preset bundle: "+err.Error())
+	}
+	if bundle.Version != presetBundleVersion {
+		return echo.NewHTTPError(400, fmt.Sprintf("unsupported bundle version %d, expected %d", bundle.Version, presetBundleVersion))
+	}
+
+	// presets skipped on a collision aren't looked up or validated
+	_, planned := mergePresets(loadPresets(), bundle.Presets, strategy)
+	kept := []int{}
+	toSave := []config.StreamInfoPreset{}
+	for idx, result := range planned {
+		if result.Result != "skipped" {
+			kept = append(kept, idx)
+			toSave = append(toSave, bundle.Presets[idx])
+		}
+	}
+
+	// categories are looked up again as the bundle may come from elsewhere
+	categories, err := resolveCategories(ctx.Request().Context(), toSave)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to resolve imported categories")
+		return twitchHTTPError(err)
+	}
+
+	// nothing is saved unless every preset is valid
+	errs := []FieldError{}
+	for keptIdx, idx := range kept {
+		preset := &toSave[keptIdx]
+		presetErrs := append(validatePresetFields(preset), checkCategory(preset, categories)...)
+		for _, fieldErr := range presetErrs {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("presets[%d].%s", idx, fieldErr.Field), Message: fieldErr.Message})
+		}
+		bundle.Presets[idx] = *preset
+	}
+	if len(errs) > 0 {
+		return echo.NewHTTPError(400, PresetValidationError{Message: "invalid preset bundle", Errors: errs})
+	}
+
+	// save, unless the presets changed so that another preset would be saved
+	var results []PresetImportResult
+	newPresets, err := updatePresets(func(presets []config.StreamInfoPreset) ([]config.StreamInfoPreset, error) {
+		var merged []config.StreamInfoPreset
+		merged, results = mergePresets(presets, bundle.Presets, strategy)
+		for idx, result := range results {
+			if (result.Result == "skipped") != (planned[idx].Result == "skipped") {
+				return nil, echo.NewHTTPError(409, "presets changed during the import, try again")
+			}
+		}
+		return merged, nil
+	})
+	if err != nil {
+		return err
+	}
+	auditAction(ctx, "preset.import", "", map[string]any{
+		"strategy": strategy,
+		"results":  results,
+	}, nil)
+
+	return ctx.JSON(200, PresetImportResponse{Results: results, Presets: newPresets})
+}
+
+// marshalYAML encodes through JSON so the keys are the same in both formats
+func marshalYAML(value any) ([]byte, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(generic)
+}
+
+// unmarshalBundle reads a JSON or YAML bundle, JSON being valid YAML
+func unmarshalBundle(raw []byte) (*PresetBundle, error) {
+	var generic any
+	if err := yaml.Unmarshal(raw, &generic); err != nil {
+		return nil, err
+	}
+	converted, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+	bundle := new(PresetBundle)
+	if err := json.Unmarshal(converted, bundle); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// resolveCategories looks up the categories of imported presets by ID,
+// falling back to the name for IDs Twitch doesn't know. Every category found
+// is returned, keyed by ID.
+func resolveCategories(ctx context.Context, presets []config.StreamInfoPreset) (map[string]twitch.Category, error) {
+	if len(presets) == 0 {
+		return map[string]twitch.Category{}, nil
+	}
+
+	// get twitch auth
+	twitchAuth, err := helpers.GetTwitchAuth()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Twitch auth: %w", err)
+	}
+	client := twitch.NewClient(twitchAuth)
+
+	ids := []string{}
+	for _, preset := range presets {
+		if preset.Category.ID != "" && !slices.Contains(ids, preset.Category.ID) {
+			ids = append(ids, preset.Category.ID)
+		}
+	}
+	known, err := getGames(ctx, client, ids, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, preset := range presets {
+		if _, ok := known[preset.Category.ID]; !ok && preset.Category.Name != "" && !slices.Contains(names, preset.Category.Name) {
+			names = append(names, preset.Category.Name)
+		}
+	}
+	found, err := getGames(ctx, client, nil, names)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]twitch.Category{}
+	for _, category := range found {
+		byName[strings.ToLower(category.Name)] = category
+		known[category.ID] = category
+	}
+
+	for idx := range presets {
+		category := &presets[idx].Category
+		if _, ok := known[category.ID]; ok {
+			continue
+		}
+		if resolved, ok := byName[strings.ToLower(category.Name)]; ok {
+			category.ID = resolved.ID
+			category.Name = resolved.Name
+			category.ImageURL = ""
+		}
+	}
+
+	return known, nil
+}
+
+// getGames looks up categories in batches Helix accepts, keyed by ID
+func getGames(ctx context.Context, client *twitch.Client, ids []string, names []string) (map[string]twitch.Category, error) {
+	categories := map[string]twitch.Category{}
+	for len(ids) > 0 || len(names) > 0 {
+		idBatch := ids[:min(len(ids), maxGamesPerRequest)]
+		nameBatch := names[:min(len(names), maxGamesPerRequest-len(idBatch))]
+		ids, names = ids[len(idBatch):], names[len(nameBatch):]
+
+		found, err := client.GetGames(ctx, idBatch, nameBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, category := range found {
+			categories[category.ID] = category
+		}
+	}
+	return categories, nil
+}
+
+// mergePresets adds imported presets to the existing ones, resolving
+// collisions on ID or name with the strategy
+func mergePresets(existing []config.StreamInfoPreset, imported []config.StreamInfoPreset, strategy mergeStrategy) ([]config.StreamInfoPreset, []PresetImportResult) {
+	presets := slices.Clone(existing)
+	results := []PresetImportResult{}
+	for _, preset := range imported {
+		preset.LastApplied = ""
+		collision := slices.IndexFunc(presets, func(p config.StreamInfoPreset) bool {
+			return (preset.ID != "" && p.ID == preset.ID) || (preset.Name != "" && strings.EqualFold(p.Name, preset.Name))
+		})
+
+		result := "created"
+		switch {
+		case collision == -1:
+			if preset.ID == "" {
+				preset.ID = uuid.NewString()
+			}
+			presets = append(presets, preset)
+		case strategy == mergeSkip:
+			result = "skipped"
+		case strategy == mergeOverwrite:
+			// the existing ID is kept so schedules and history still match
+			preset.ID = presets[collision].ID
+			preset.LastApplied = presets[collision].LastApplied
+			presets[collision] = preset
+			result = "overwritten"
+		case strategy == mergeDuplicate:
+			preset.ID = uuid.NewString()
+			preset.Name = uniquePresetName(presets, preset.Name)
+			presets = append(presets, preset)
+			result = "duplicated"
+		}
+		results = append(results, PresetImportResult{ID: preset.ID, Name: preset.Name, Result: result})
+	}
+
+	return presets, results
+}
+
+// uniquePresetName numbers a name until no preset has it
+func uniquePresetName(presets []config.StreamInfoPreset, name string) string {
+	taken := func(candidate string) bool {
+		return slices.ContainsFunc(presets, func(p config.StreamInfoPreset) bool { return strings.EqualFold(p.Name, candidate) })
+	}
+	candidate := name
+	for n := 2; taken(candidate); n++ {
+		candidate = fmt.Sprintf("%s (%d)", name, n)
+	}
+	return candidate
+}
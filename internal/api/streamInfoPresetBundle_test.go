@@ -0,0 +1,128 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+)
+
+func TestMergePresets(t *testing.T) {
+	existing := []config.StreamInfoPreset{{ID: "a", Name: "Chatting"}, {ID: "b", Name: "Gaming"}}
+	imported := []config.StreamInfoPreset{
+		{ID: "a", Name: "renamed", Title: "by id"},
+		{ID: "x", Name: "gaming", Title: "by name"},
+		{ID: "y", Name: "new", Title: "new"},
+	}
+
+	tests := []struct {
+		strategy mergeStrategy
+		results  string
+		names    string
+	}{
+		{mergeSkip, "skipped,skipped,created", "Chatting,Gaming,new"},
+		{mergeOverwrite, "overwritten,overwritten,created", "renamed,gaming,new"},
+		{mergeDuplicate, "duplicated,duplicated,created", "Chatting,Gaming,renamed,gaming (2),new"},
+	}
+	for _, tt := range tests {
+		presets, results := mergePresets(existing, imported, tt.strategy)
+		got := []string{}
+		for _, result := range results {
+			got = append(got, result.Result)
+		}
+		names := []string{}
+		for _, preset := range presets {
+			names = append(names, preset.Name)
+		}
+		if strings.Join(got, ",") != tt.results || strings.Join(names, ",") != tt.names {
+			t.Errorf("%s: got %s and %s", tt.strategy, got, names)
+		}
+		if tt.strategy == mergeOverwrite && (presets[0].ID != "a" || presets[1].ID != "b") {
+			t.Errorf("overwritten presets should keep their ID, got %+v", presets)
+		}
+	}
+	if existing[0].Name != "Chatting" {
+		t.Error("the existing presets shouldn't change")
+	}
+}
+
+func importBundle(t *testing.T, e *echo.Echo, strategy string, bundle string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/stream-info-presets/import?strategy="+strategy, bytes.NewReader([]byte(bundle)))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+testAdminToken)
+	req.Header.Set(echo.HeaderContentType, "application/yaml")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStreamInfoPresetExportImport(t *testing.T) {
+	srv, e := newTestAPI(t)
+	preset := config.StreamInfoPreset{ID: "p1", Name: "chatting", Title: "chatting", Tags: []string{"English"}}
+	preset.Category.ID = "509658"
+	preset.Category.Name = "Just Chatting"
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{preset}
+
+	rec := request(t, e, http.MethodGet, "/api/stream-info-presets/export?format=yaml", nil)
+	if rec.Code != 200 || !strings.Contains(rec.Header().Get(echo.HeaderContentDisposition), "stream-info-presets.yaml") {
+		t.Fatalf("failed to export: %d %s", rec.Code, rec.Body)
+	}
+	exported := rec.Body.String()
+
+	// the same presets are skipped or duplicated
+	rec = importBundle(t, e, "skip", exported)
+	if rec.Code != 200 {
+		t.Fatalf("failed to import: %d %s", rec.Code, rec.Body)
+	}
+	if res := decode[PresetImportResponse](t, rec); res.Results[0].Result != "skipped" || len(res.Presets) != 1 {
+		t.Errorf("unexpected import %+v", res)
+	}
+	res := decode[PresetImportResponse](t, importBundle(t, e, "duplicate", exported))
+	if len(res.Presets) != 2 || res.Presets[1].Name != "chatting (2)" || res.Presets[1].ID == "p1" {
+		t.Errorf("unexpected import %+v", res)
+	}
+
+	// unknown category IDs are looked up by name
+	rec = importBundle(t, e, "overwrite", `{"version": 1, "presets": [{"name": "mc", "title": "mining", "tags": [], "category": {"id": "1", "name": "Minecraft"}}]}`)
+	if rec.Code != 200 {
+		t.Fatalf("failed to import: %d %s", rec.Code, rec.Body)
+	}
+	if imported := config.Cfg.StreamInfoPresets[2]; imported.Category.ID != "27471" || imported.ID == "" {
+		t.Errorf("unexpected preset %+v", imported)
+	}
+	if entry := lastAudit(t, "preset.import"); !entry.Success {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+
+	// invalid bundles aren't saved at all
+	rec = importBundle(t, e, "skip", "version: 1\npresets:\n  - name: ok\n    title: ok\n    category: {id: \"27471\"}\n  - name: bad\n    title: bad\n    category: {id: \"404\"}\n")
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "presets[1].category") {
+		t.Errorf("unexpected response %d %s", rec.Code, rec.Body)
+	}
+	if rec := importBundle(t, e, "skip", `{"version": 2, "presets": []}`); rec.Code != 400 {
+		t.Errorf("expected 400 for a newer version, got %d", rec.Code)
+	}
+	if rec := importBundle(t, e, "merge", `{"version": 1, "presets": []}`); rec.Code != 400 {
+		t.Errorf("expected 400 for an unknown strategy, got %d", rec.Code)
+	}
+	if len(config.Cfg.StreamInfoPresets) != 3 {
+		t.Errorf("expected 3 presets, got %d", len(config.Cfg.StreamInfoPresets))
+	}
+
+	// skipped presets aren't validated and categories are looked up once
+	requests := len(srv.Requests("GET /helix/games"))
+	rec = importBundle(t, e, "skip", `{"version": 1, "presets": [{"name": "chatting", "title": "", "category": {"id": "404"}}, {"name": "new", "title": "new", "category": {"id": "509658"}}, {"name": "newer", "title": "newer", "category": {"id": "27471"}}]}`)
+	if rec.Code != 200 {
+		t.Fatalf("failed to import: %d %s", rec.Code, rec.Body)
+	}
+	if res := decode[PresetImportResponse](t, rec); res.Results[0].Result != "skipped" || len(res.Presets) != 5 || res.Presets[3].Category.Name != "Just Chatting" {
+		t.Errorf("unexpected import %+v", res)
+	}
+	if lookups := len(srv.Requests("GET /helix/games")) - requests; lookups != 1 {
+		t.Errorf("expected 1 category lookup, got %d", lookups)
+	}
+}
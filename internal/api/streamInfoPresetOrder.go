@@ -0,0 +1,79 @@
+package api
+
+import (
+	"sort"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+)
+
+type StreamInfoPresetOrderRequest struct {
+	// IDs lists every preset once, in the new order
+	IDs []string `json:"ids"`
+}
+
+func (h *Handler) StreamInfoPresetReorder(ctx echo.Context) error {
+	body := new(StreamInfoPresetOrderRequest)
+	if err := ctx.Bind(body); err != nil {
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	// reorder and save, the ids must be a permutation of the current presets
+	ordered, err := updatePresets(func(presets []config.StreamInfoPreset) ([]config.StreamInfoPreset, error) {
+		if len(body.IDs) != len(presets) {
+			return nil, echo.NewHTTPError(400, "ids must list every preset once")
+		}
+		byID := map[string]config.StreamInfoPreset{}
+		for _, preset := range presets {
+			byID[preset.ID] = preset
+		}
+		ordered := make([]config.StreamInfoPreset, 0, len(body.IDs))
+		for _, id := range body.IDs {
+			preset, ok := byID[id]
+			if !ok {
+				return nil, echo.NewHTTPError(400, "ids must list every preset once")
+			}
+			delete(byID, id)
+			ordered = append(ordered, preset)
+		}
+		return ordered, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(200, ordered)
+}
+
+// StreamInfoPresetRecent lists the presets by when they were last applied,
+// most recent first
+func (h *Handler) StreamInfoPresetRecent(ctx echo.Context) error {
+	limit, err := parseIntParam(ctx, "limit", 5)
+	if err != nil {
+		return err
+	}
+
+	type appliedPreset struct {
+		preset config.StreamInfoPreset
+		at     time.Time
+	}
+	applied := []appliedPreset{}
+	for _, preset := range loadPresets() {
+		at, err := time.Parse(time.RFC3339, preset.LastApplied)
+		if err != nil {
+			continue
+		}
+		applied = append(applied, appliedPreset{preset: preset, at: at})
+	}
+	sort.SliceStable(applied, func(i, j int) bool { return applied[i].at.After(applied[j].at) })
+	if limit > 0 && len(applied) > limit {
+		applied = applied[:limit]
+	}
+
+	recent := make([]config.StreamInfoPreset, len(applied))
+	for idx, entry := range applied {
+		recent[idx] = entry.preset
+	}
+	return ctx.JSON(200, recent)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nullvt/stream-admin/internal/config"
+)
+
+func TestStreamInfoPresetReorder(t *testing.T) {
+	_, e := newTestAPI(t)
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{{ID: "a", Name: "a"}, {ID: "b", Name: "b"}, {ID: "c", Name: "c"}}
+
+	rec := request(t, e, http.MethodPut, "/api/stream-info-presets/order", StreamInfoPresetOrderRequest{IDs: []string{"c", "a", "b"}})
+	if rec.Code != 200 {
+		t.Fatalf("failed to reorder: %d %s", rec.Code, rec.Body)
+	}
+	if presets := config.Cfg.StreamInfoPresets; presets[0].ID != "c" || presets[1].ID != "a" || presets[2].ID != "b" {
+		t.Errorf("unexpected order %+v", presets)
+	}
+
+	invalid := [][]string{{"a", "b"}, {"a", "b", "b"}, {"a", "b", "d"}}
+	for _, ids := range invalid {
+		if rec := request(t, e, http.MethodPut, "/api/stream-info-presets/order", StreamInfoPresetOrderRequest{IDs: ids}); rec.Code != 400 {
+			t.Errorf("%v: expected 400, got %d", ids, rec.Code)
+		}
+	}
+}
+
+func TestStreamInfoPresetRecent(t *testing.T) {
+	_, e := newTestAPI(t)
+	presets := []config.StreamInfoPreset{}
+	for _, name := range []string{"first", "second", "never"} {
+		preset := config.StreamInfoPreset{ID: name, Name: name, Title: name, Tags: []string{}}
+		preset.Category.ID = "509658"
+		presets = append(presets, preset)
+	}
+	presets[1].LastApplied = "2024-01-01T18:00:00Z"
+	config.Cfg.StreamInfoPresets = presets
+
+	if rec := request(t, e, http.MethodPost, "/api/stream-info-presets/first/apply", nil); rec.Code != 200 {
+		t.Fatalf("failed to apply preset: %d %s", rec.Code, rec.Body)
+	}
+	recent := decode[[]config.StreamInfoPreset](t, request(t, e, http.MethodGet, "/api/stream-info-presets/recent", nil))
+	if len(recent) != 2 || recent[0].ID != "first" || recent[0].LastApplied == "" || recent[1].ID != "second" {
+		t.Errorf("unexpected recent presets %+v", recent)
+	}
+
+	// saving a preset doesn't change when it was applied
+	edited := config.Cfg.StreamInfoPresets[1]
+	edited.LastApplied = ""
+	edited.Favorite = true
+	if rec := request(t, e, http.MethodPut, "/api/stream-info-presets/second", edited); rec.Code != 200 {
+		t.Fatalf("failed to save preset: %d %s", rec.Code, rec.Body)
+	}
+	if preset := config.Cfg.StreamInfoPresets[1]; preset.LastApplied != "2024-01-01T18:00:00Z" || !preset.Favorite {
+		t.Errorf("unexpected preset %+v", preset)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/helpers"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/nullvt/stream-admin/internal/streaminfo"
+	"github.com/rs/zerolog/log"
+)
+
+// FieldError points at the part of a preset that breaks a rule, Field is a
+// path like "tags[2]"
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// PresetValidationError is the body of a 400 for an invalid preset
+type PresetValidationError struct {
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors"`
+}
+
+// validatePreset checks a preset against the rules of Twitch and fills in the
+// category from Helix. The error is set if Twitch couldn't be asked.
+func validatePreset(ctx context.Context, preset *config.StreamInfoPreset) ([]FieldError, error) {
+	errs := validatePresetFields(preset)
+	categories := map[string]twitch.Category{}
+	if preset.Category.ID != "" {
+		twitchAuth, err := helpers.GetTwitchAuth()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Twitch auth: %w", err)
+		}
+		categories, err = getGames(ctx, twitch.NewClient(twitchAuth), []string{preset.Category.ID}, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(errs, checkCategory(preset, categories)...), nil
+}
+
+// validatePresetFields checks everything but the category, which needs Twitch
+func validatePresetFields(preset *config.StreamInfoPreset) []FieldError {
+	errs := []FieldError{}
+	data := templateData(time.Now())
+	preset.Group = strings.TrimSpace(preset.Group)
+
+	// placeholders are checked as they would render now
+	title, err := streaminfo.Render(preset.Title, data)
+	switch {
+	case err != nil:
+		errs = append(errs, FieldError{Field: "title", Message: err.Error()})
+	case strings.TrimSpace(title) == "":
+		errs = append(errs, FieldError{Field: "title", Message: "title can't be empty"})
+	case streaminfo.TitleLength(title) > streaminfo.MaxTitleLength:
+		errs = append(errs, FieldError{Field: "title", Message: fmt.Sprintf("title is %d characters, Twitch allows %d", streaminfo.TitleLength(title), streaminfo.MaxTitleLength)})
+	}
+
+	if len(preset.Tags) > streaminfo.MaxTags {
+		errs = append(errs, FieldError{Field: "tags", Message: fmt.Sprintf("%d tags, Twitch allows %d", len(preset.Tags), streaminfo.MaxTags)})
+	}
+	for idx, tag := range preset.Tags {
+		rendered, err := streaminfo.Render(tag, data)
+		if err == nil {
+			err = streaminfo.ValidateTag(rendered)
+		}
+		if err != nil {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("tags[%d]", idx), Message: err.Error()})
+		}
+	}
+
+	if preset.BroadcasterLanguage != "" {
+		if err := streaminfo.ValidateLanguage(preset.BroadcasterLanguage); err != nil {
+			errs = append(errs, FieldError{Field: "broadcasterLanguage", Message: err.Error()})
+		}
+	}
+	if preset.Delay != nil && (*preset.Delay < 0 || *preset.Delay > streaminfo.MaxDelay) {
+		errs = append(errs, FieldError{Field: "delay", Message: fmt.Sprintf("delay must be between 0 and %d seconds", streaminfo.MaxDelay)})
+	}
+
+	seen := map[string]bool{}
+	for idx, label := range preset.ContentClassificationLabels {
+		field := fmt.Sprintf("contentClassificationLabels[%d]", idx)
+		switch {
+		case label.ID == "MatureGame":
+			errs = append(errs, FieldError{Field: field, Message: "MatureGame is set by Twitch from the category"})
+		case !streaminfo.IsContentClassificationLabel(label.ID):
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("unknown content classification label %q", label.ID)})
+		case seen[label.ID]:
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("%s is listed twice", label.ID)})
+		}
+		seen[label.ID] = true
+	}
+
+	if err := validateSchedule(preset.Schedule); err != nil {
+		errs = append(errs, FieldError{Field: "schedule", Message: err.Error()})
+	}
+
+	return errs
+}
+
+// checkCategory fills in the preset's category from the categories found on
+// Twitch, keyed by ID
+func checkCategory(preset *config.StreamInfoPreset, categories map[string]twitch.Category) []FieldError {
+	// the category has to exist on Twitch
+	if preset.Category.ID == "" {
+		return []FieldError{{Field: "category", Message: "a category is required"}}
+	}
+	category, ok := categories[preset.Category.ID]
+	if !ok {
+		return []FieldError{{Field: "category", Message: fmt.Sprintf("category %s doesn't exist on Twitch", preset.Category.ID)}}
+	}
+	preset.Category.Name = category.Name
+	if preset.Category.ImageURL == "" {
+		// same size as the search results
+		preset.Category.ImageURL = strings.NewReplacer("{width}", "52", "{height}", "72").Replace(category.BoxArtUrl)
+	}
+	return nil
+}
+
+// checkPreset validates a preset about to be saved and returns the error to
+// respond with
+func checkPreset(ctx echo.Context, preset *config.StreamInfoPreset) error {
+	errs, err := validatePreset(ctx.Request().Context(), preset)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to validate preset")
+		return twitchHTTPError(err)
+	}
+	if len(errs) > 0 {
+		return echo.NewHTTPError(400, PresetValidationError{Message: "invalid preset", Errors: errs})
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nullvt/stream-admin/internal/config"
+)
+
+func TestStreamInfoPresetValidation(t *testing.T) {
+	_, e := newTestAPI(t)
+
+	preset := config.StreamInfoPreset{
+		Name:  "invalid",
+		Title: strings.Repeat("a", 141),
+		Tags:  []string{"English", "two words", "{{unknown}}"},
+		ContentClassificationLabels: []config.ContentClassificationLabel{
+			{ID: "Gambling", Enabled: true},
+			{ID: "MatureGame", Enabled: true},
+			{ID: "Gambling", Enabled: false},
+		},
+	}
+	preset.Category.ID = "404"
+	rec := request(t, e, http.MethodPost, "/api/stream-info-presets", preset)
+	if rec.Code != 400 {
+		t.Fatalf("expected 400, got %d %s", rec.Code, rec.Body)
+	}
+	fields := []string{}
+	for _, fieldErr := range decode[PresetValidationError](t, rec).Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	want := "title,tags[1],tags[2],contentClassificationLabels[1],contentClassificationLabels[2],category"
+	if strings.Join(fields, ",") != want {
+		t.Errorf("expected errors for %s, got %s", want, fields)
+	}
+	if len(config.Cfg.StreamInfoPresets) != 0 {
+		t.Error("the preset shouldn't be saved")
+	}
+
+	// more than 10 tags and no category
+	preset = config.StreamInfoPreset{Name: "tags", Title: "title", Tags: strings.Split("a,b,c,d,e,f,g,h,i,j,k", ",")}
+	rec = request(t, e, http.MethodPost, "/api/stream-info-presets", preset)
+	if errs := decode[PresetValidationError](t, rec).Errors; len(errs) != 2 || errs[0].Field != "tags" || errs[1].Field != "category" {
+		t.Errorf("unexpected errors %+v", errs)
+	}
+}
+
+func TestStreamInfoPresetValidCategory(t *testing.T) {
+	srv, e := newTestAPI(t)
+
+	// the category name is taken from Twitch
+	branded := true
+	preset := config.StreamInfoPreset{
+		Name:                        "sponsored",
+		Title:                       "sponsored stream",
+		Tags:                        []string{},
+		ContentClassificationLabels: []config.ContentClassificationLabel{{ID: "Gambling", Enabled: false}},
+		IsBrandedContent:            &branded,
+	}
+	preset.Category.ID = "27471"
+	preset.Category.Name = "stale name"
+	rec := request(t, e, http.MethodPost, "/api/stream-info-presets", preset)
+	if rec.Code != 200 {
+		t.Fatalf("failed to create preset: %d %s", rec.Code, rec.Body)
+	}
+	saved := decode[[]config.StreamInfoPreset](t, rec)[0]
+	if saved.Category.Name != "Minecraft" {
+		t.Errorf("unexpected category %+v", saved.Category)
+	}
+
+	// updates are validated too
+	saved.Tags = []string{"no-dashes"}
+	if rec := request(t, e, http.MethodPut, "/api/stream-info-presets/"+saved.ID, saved); rec.Code != 400 {
+		t.Errorf("expected 400, got %d %s", rec.Code, rec.Body)
+	}
+
+	// labels and branded content are sent when applying
+	if rec := request(t, e, http.MethodPost, "/api/stream-info-presets/"+saved.ID+"/apply", nil); rec.Code != 200 {
+		t.Fatalf("failed to apply preset: %d %s", rec.Code, rec.Body)
+	}
+	requests := srv.Requests("PATCH /helix/channels")
+	var body map[string]any
+	if err := json.Unmarshal(requests[len(requests)-1].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	labels, _ := json.Marshal(body["content_classification_labels"])
+	if string(labels) != `[{"id":"Gambling","is_enabled":false}]` || body["is_branded_content"] != true {
+		t.Errorf("unexpected request %s", requests[len(requests)-1].Body)
+	}
+}
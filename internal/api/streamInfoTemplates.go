@@ -0,0 +1,223 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/streaminfo"
+	"github.com/rs/zerolog/log"
+)
+
+// TemplateError is returned when a preset can't be rendered, the preset
+// itself has to be fixed so it is reported as a bad request
+type TemplateError struct {
+	Errors []error
+}
+
+func (e *TemplateError) Error() string {
+	return errors.Join(e.Errors...).Error()
+}
+
+type PresetPreviewRequest struct {
+	Title *string  `json:"title"`
+	Tags  []string `json:"tags"`
+}
+
+type PresetPreviewResponse struct {
+	Title       string   `json:"title"`
+	Tags        []string `json:"tags"`
+	TitleLength int      `json:"titleLength"`
+	MaxLength   int      `json:"maxLength"`
+	Valid       bool     `json:"valid"`
+	Errors      []string `json:"errors"`
+}
+
+// templatesMu guards config.Cfg.Templates, which is changed by the handlers
+// and as the stream goes live
+var templatesMu sync.Mutex
+
+// loadTemplates returns a copy of the templates that is safe to use unlocked
+func loadTemplates() config.TemplatesConfig {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	return cloneTemplates(config.Cfg.Templates)
+}
+
+// updateTemplates persists the templates returned by update and returns them.
+// update receives a copy of the current templates and runs with the lock held.
+func updateTemplates(update func(templates config.TemplatesConfig) config.TemplatesConfig) (config.TemplatesConfig, error) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	templates := update(cloneTemplates(config.Cfg.Templates))
+
+	// persist each key, setting the parent would replace unrelated keys
+	values := map[string]any{
+		"templates.variables":   templates.Variables,
+		"templates.challenges":  templates.Challenges,
+		"templates.streamCount": templates.StreamCount,
+	}
+	for key, value := range values {
+		if err := config.SetConfigValue(key, value); err != nil {
+			log.Error().Err(err).Msg("failed to persist templates")
+			return config.TemplatesConfig{}, echo.NewHTTPError(500, "failed to save templates")
+		}
+	}
+	config.Cfg.Templates = templates
+
+	return cloneTemplates(templates), nil
+}
+
+// cloneTemplates copies the maps, which would be shared otherwise
+func cloneTemplates(templates config.TemplatesConfig) config.TemplatesConfig {
+	templates.Variables = maps.Clone(templates.Variables)
+	templates.Challenges = maps.Clone(templates.Challenges)
+	return templates
+}
+
+// templateData collects the values for rendering at a point in time
+func templateData(now time.Time) streaminfo.TemplateData {
+	scheduler.mu.Lock()
+	online := !scheduler.onlineAt.IsZero()
+	scheduler.mu.Unlock()
+
+	templates := loadTemplates()
+	return streaminfo.TemplateData{
+		Now:         now,
+		StreamCount: templates.StreamCount,
+		Online:      online,
+		Variables:   templates.Variables,
+		Challenges:  templates.Challenges,
+	}
+}
+
+// renderPreset resolves the placeholders of the title and tags, returning
+// every problem found
+func renderPreset(preset config.StreamInfoPreset, now time.Time) (config.StreamInfoPreset, []error) {
+	data := templateData(now)
+	errs := []error{}
+
+	title, err := streaminfo.Render(preset.Title, data)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("title: %w", err))
+	} else if length := streaminfo.TitleLength(title); length > streaminfo.MaxTitleLength {
+		errs = append(errs, fmt.Errorf("title: %d characters, Twitch allows %d", length, streaminfo.MaxTitleLength))
+	}
+	preset.Title = title
+
+	tags := make([]string, 0, len(preset.Tags))
+	for _, tag := range preset.Tags {
+		rendered, err := streaminfo.Render(tag, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tag %q: %w", tag, err))
+		}
+		tags = append(tags, rendered)
+	}
+	preset.Tags = tags
+
+	return preset, errs
+}
+
+func (h *Handler) StreamInfoPresetPreview(ctx echo.Context) error {
+	// find preset in config
+	preset, ok := findPreset(ctx.Param("id"))
+	if !ok {
+		return errPresetNotFound
+	}
+
+	// unsaved edits can be previewed by sending them
+	body := new(PresetPreviewRequest)
+	if err := ctx.Bind(body); err != nil {
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+	previewed := preset
+	if body.Title != nil {
+		previewed.Title = *body.Title
+	}
+	if body.Tags != nil {
+		previewed.Tags = body.Tags
+	}
+
+	rendered, errs := renderPreset(previewed, time.Now())
+	res := PresetPreviewResponse{
+		Title:       rendered.Title,
+		Tags:        rendered.Tags,
+		TitleLength: streaminfo.TitleLength(rendered.Title),
+		MaxLength:   streaminfo.MaxTitleLength,
+		Valid:       len(errs) == 0,
+		Errors:      []string{},
+	}
+	for _, err := range errs {
+		res.Errors = append(res.Errors, err.Error())
+	}
+
+	return ctx.JSON(200, res)
+}
+
+func (h *Handler) StreamInfoTemplatesGet(ctx echo.Context) error {
+	return ctx.JSON(200, loadTemplates())
+}
+
+func (h *Handler) StreamInfoTemplatesPut(ctx echo.Context) error {
+	body := new(config.TemplatesConfig)
+	if err := ctx.Bind(body); err != nil {
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+	if body.Variables == nil {
+		body.Variables = map[string]string{}
+	}
+	if body.Challenges == nil {
+		body.Challenges = map[string]string{}
+	}
+
+	// validate
+	for name := range body.Variables {
+		if name == "" || strings.ContainsAny(name, ":{} ") {
+			return echo.NewHTTPError(400, fmt.Sprintf("invalid variable name %q", name))
+		}
+		if streaminfo.IsBuiltin(name) {
+			return echo.NewHTTPError(400, fmt.Sprintf("%q is a built-in variable", name))
+		}
+	}
+	for name, startDate := range body.Challenges {
+		if name == "" || strings.ContainsAny(name, "{}") {
+			return echo.NewHTTPError(400, fmt.Sprintf("invalid challenge name %q", name))
+		}
+		if _, err := time.Parse("2006-01-02", startDate); err != nil {
+			return echo.NewHTTPError(400, fmt.Sprintf("challenge %q needs a start date like 2024-01-31", name))
+		}
+	}
+	if body.StreamCount < 0 {
+		return echo.NewHTTPError(400, "stream count can't be negative")
+	}
+
+	// save
+	templates, err := updateTemplates(func(config.TemplatesConfig) config.TemplatesConfig { return *body })
+	if err != nil {
+		return err
+	}
+	auditAction(ctx, "templates.update", "", map[string]any{
+		"variables":   body.Variables,
+		"challenges":  body.Challenges,
+		"streamCount": body.StreamCount,
+	}, nil)
+
+	return ctx.JSON(200, templates)
+}
+
+// countStream bumps the stream count used by {{stream}}
+func countStream() {
+	_, err := updateTemplates(func(templates config.TemplatesConfig) config.TemplatesConfig {
+		templates.StreamCount++
+		return templates
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to persist the stream count")
+	}
+}
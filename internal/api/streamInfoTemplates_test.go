@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+)
+
+func TestStreamInfoPresetPreview(t *testing.T) {
+	_, e := newTestAPI(t)
+	config.Cfg.Templates = config.TemplatesConfig{
+		Variables:   map[string]string{"game": "Elden Ring"},
+		Challenges:  map[string]string{"marathon": time.Now().AddDate(0, 0, -2).Format("2006-01-02")},
+		StreamCount: 9,
+	}
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{
+		{ID: "p1", Name: "marathon", Title: "{{game}} marathon day {{day:marathon}} | stream #{{stream}}", Tags: []string{"{{game}}"}},
+	}
+
+	rec := request(t, e, http.MethodPost, "/api/stream-info-presets/p1/preview", nil)
+	if rec.Code != 200 {
+		t.Fatalf("failed to preview: %d %s", rec.Code, rec.Body)
+	}
+	preview := decode[PresetPreviewResponse](t, rec)
+	if !preview.Valid || preview.Title != "Elden Ring marathon day 3 | stream #10" || preview.Tags[0] != "Elden Ring" {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+
+	// unsaved edits are previewed with every problem listed
+	rec = request(t, e, http.MethodPost, "/api/stream-info-presets/p1/preview", map[string]any{
+		"title": strings.Repeat("a", 140) + "{{game}}",
+		"tags":  []string{"{{unknown}}"},
+	})
+	preview = decode[PresetPreviewResponse](t, rec)
+	if preview.Valid || len(preview.Errors) != 2 || preview.TitleLength != 150 {
+		t.Errorf("unexpected preview %+v", preview)
+	}
+
+	if rec := request(t, e, http.MethodPost, "/api/stream-info-presets/missing/preview", nil); rec.Code != 404 {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestStreamInfoPresetApplyTemplate(t *testing.T) {
+	srv, e := newTestAPI(t)
+	config.Cfg.Templates.Variables = map[string]string{"game": "Elden Ring"}
+	config.Cfg.StreamInfoPresets = []config.StreamInfoPreset{
+		{ID: "ok", Name: "ok", Title: "playing {{game}} on {{weekday}}", Tags: []string{}},
+		{ID: "long", Name: "long", Title: strings.Repeat("{{game}}", 20), Tags: []string{}},
+	}
+
+	if rec := request(t, e, http.MethodPost, "/api/stream-info-presets/ok/apply", nil); rec.Code != 200 {
+		t.Fatalf("failed to apply: %d %s", rec.Code, rec.Body)
+	}
+	if title := srv.Channel(broadcasterID).Title; title != "playing Elden Ring on "+time.Now().Weekday().String() {
+		t.Errorf("unexpected title %q", title)
+	}
+
+	// nothing is sent when the rendered title is too long
+	requests := len(srv.Requests("PATCH /helix/channels"))
+	rec := request(t, e, http.MethodPost, "/api/stream-info-presets/long/apply", nil)
+	if rec.Code != 400 || !strings.Contains(rec.Body.String(), "Twitch allows 140") {
+		t.Errorf("unexpected response %d %s", rec.Code, rec.Body)
+	}
+	if len(srv.Requests("PATCH /helix/channels")) != requests {
+		t.Error("expected no request to Twitch")
+	}
+	if entry := lastAudit(t, "preset.apply"); entry.Success || entry.Target != "long" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+}
+
+func TestStreamInfoTemplatesPut(t *testing.T) {
+	_, e := newTestAPI(t)
+
+	templates := config.TemplatesConfig{
+		Variables:   map[string]string{"game": "Elden Ring"},
+		Challenges:  map[string]string{"marathon": "2024-05-01"},
+		StreamCount: 3,
+	}
+	rec := request(t, e, http.MethodPut, "/api/stream-info-templates", templates)
+	if rec.Code != 200 {
+		t.Fatalf("failed to save templates: %d %s", rec.Code, rec.Body)
+	}
+	if config.Cfg.Templates.Variables["game"] != "Elden Ring" || config.Cfg.Templates.StreamCount != 3 {
+		t.Errorf("unexpected templates %+v", config.Cfg.Templates)
+	}
+
+	invalid := []config.TemplatesConfig{
+		{Variables: map[string]string{"date": "x"}},
+		{Variables: map[string]string{"a:b": "x"}},
+		{Challenges: map[string]string{"marathon": "May 1st"}},
+		{StreamCount: -1},
+	}
+	for _, body := range invalid {
+		if rec := request(t, e, http.MethodPut, "/api/stream-info-templates", body); rec.Code != 400 {
+			t.Errorf("%+v: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	// going live counts a stream
+	HandleStreamStatus(twitch.StreamStatus{Online: true, StartedAt: time.Now()})
+	HandleStreamStatus(twitch.StreamStatus{Online: false})
+	if config.Cfg.Templates.StreamCount != 4 {
+		t.Errorf("expected 4 streams, got %d", config.Cfg.Templates.StreamCount)
+	}
+}
+
+func TestStreamInfoTemplatesConcurrent(t *testing.T) {
+	_, e := newTestAPI(t)
+	config.Cfg.Templates = config.TemplatesConfig{Variables: map[string]string{"game": "Elden Ring"}, Challenges: map[string]string{}}
+	templates := config.TemplatesConfig{Variables: map[string]string{"game": "Elden Ring"}, Challenges: map[string]string{}}
+
+	// streams are counted and rendered while the templates are replaced
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		if rec := request(t, e, http.MethodPut, "/api/stream-info-templates", templates); rec.Code != 200 {
+			t.Errorf("failed to save templates: %d %s", rec.Code, rec.Body)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		countStream()
+	}()
+	go func() {
+		defer wg.Done()
+		data := templateData(time.Now())
+		data.Variables["game"] = "changed"
+	}()
+	wg.Wait()
+
+	// the render data is a copy
+	if loaded := loadTemplates(); loaded.Variables["game"] == "changed" {
+		t.Errorf("expected the templates to be copied, got %+v", loaded)
+	}
+}
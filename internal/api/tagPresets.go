@@ -0,0 +1,238 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/helpers"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/nullvt/stream-admin/internal/streaminfo"
+	"github.com/rs/zerolog/log"
+)
+
+type TagPresetToggleRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+type TagPresetToggleResponse struct {
+	// Tags are the channel tags after the change
+	Tags []string `json:"tags"`
+}
+
+// validateTagPreset checks a tag preset before it is saved
+func validateTagPreset(preset *config.TagPreset) []FieldError {
+	errs := []FieldError{}
+	preset.Name = strings.TrimSpace(preset.Name)
+	if preset.Name == "" {
+		errs = append(errs, FieldError{Field: "name", Message: "a name is required"})
+	}
+	if len(preset.Tags) == 0 {
+		errs = append(errs, FieldError{Field: "tags", Message: "at least one tag is required"})
+	}
+	if len(preset.Tags) > streaminfo.MaxTags {
+		errs = append(errs, FieldError{Field: "tags", Message: fmt.Sprintf("%d tags, Twitch allows %d", len(preset.Tags), streaminfo.MaxTags)})
+	}
+	for idx, tag := range preset.Tags {
+		if err := streaminfo.ValidateTag(tag); err != nil {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("tags[%d]", idx), Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// tagPresetsMu guards config.Cfg.TagPresets, which is changed by concurrent
+// handlers
+var tagPresetsMu sync.Mutex
+
+var errTagPresetNotFound = echo.NewHTTPError(404, "tag preset not found")
+
+// loadTagPresets returns a copy of the tag presets that is safe to use unlocked
+func loadTagPresets() []config.TagPreset {
+	tagPresetsMu.Lock()
+	defer tagPresetsMu.Unlock()
+	return slices.Clone(config.Cfg.TagPresets)
+}
+
+// updateTagPresets persists the tag presets returned by update and returns
+// them. update receives a copy of the current tag presets and runs with the
+// lock held.
+func updateTagPresets(update func(presets []config.TagPreset) ([]config.TagPreset, error)) ([]config.TagPreset, error) {
+	tagPresetsMu.Lock()
+	defer tagPresetsMu.Unlock()
+
+	newPresets, err := update(slices.Clone(config.Cfg.TagPresets))
+	if err != nil {
+		return nil, err
+	}
+	if err := config.SetConfigValue("tagPresets", newPresets); err != nil {
+		log.Error().Err(err).Msg("failed to persist TagPresets")
+		return nil, echo.NewHTTPError(500, "failed to save tag presets")
+	}
+	config.Cfg.TagPresets = newPresets
+
+	return slices.Clone(newPresets), nil
+}
+
+// findTagPreset returns the index of a tag preset, -1 if there is none
+func findTagPreset(presets []config.TagPreset, id string) int {
+	return slices.IndexFunc(presets, func(preset config.TagPreset) bool { return preset.ID == id })
+}
+
+func (h *Handler) TagPresetGet(ctx echo.Context) error {
+	return ctx.JSON(200, loadTagPresets())
+}
+
+func (h *Handler) TagPresetPost(ctx echo.Context) error {
+	preset := new(config.TagPreset)
+	if err := ctx.Bind(preset); err != nil {
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	// validate body
+	if preset.ID != "" {
+		return echo.NewHTTPError(400, "cannot create TagPreset with manually set ID")
+	}
+	if errs := validateTagPreset(preset); len(errs) > 0 {
+		return echo.NewHTTPError(400, PresetValidationError{Message: "invalid tag preset", Errors: errs})
+	}
+	preset.ID = uuid.NewString()
+
+	// save
+	newPresets, err := updateTagPresets(func(presets []config.TagPreset) ([]config.TagPreset, error) {
+		return append(presets, *preset), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(200, newPresets)
+}
+
+func (h *Handler) TagPresetPut(ctx echo.Context) error {
+	if findTagPreset(loadTagPresets(), ctx.Param("id")) == -1 {
+		return errTagPresetNotFound
+	}
+
+	preset := new(config.TagPreset)
+	if err := ctx.Bind(preset); err != nil {
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	// validate: preset ID must match the existing one
+	if preset.ID != ctx.Param("id") {
+		return echo.NewHTTPError(400, "you cannot change the ID of a tag preset")
+	}
+	if errs := validateTagPreset(preset); len(errs) > 0 {
+		return echo.NewHTTPError(400, PresetValidationError{Message: "invalid tag preset", Errors: errs})
+	}
+
+	// save, unless the tag preset was deleted in the meantime
+	newPresets, err := updateTagPresets(func(presets []config.TagPreset) ([]config.TagPreset, error) {
+		idx := findTagPreset(presets, preset.ID)
+		if idx == -1 {
+			return nil, errTagPresetNotFound
+		}
+		presets[idx] = *preset
+		return presets, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(200, newPresets)
+}
+
+func (h *Handler) TagPresetDelete(ctx echo.Context) error {
+	// save
+	newPresets, err := updateTagPresets(func(presets []config.TagPreset) ([]config.TagPreset, error) {
+		idx := findTagPreset(presets, ctx.Param("id"))
+		if idx == -1 {
+			return nil, errTagPresetNotFound
+		}
+		return slices.Delete(presets, idx, idx+1), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(200, newPresets)
+}
+
+// TagPresetToggle adds the tags of a tag preset to the channel or removes
+// them, leaving the other tags as they are
+func (h *Handler) TagPresetToggle(ctx echo.Context) error {
+	presets := loadTagPresets()
+	idx := findTagPreset(presets, ctx.Param("id"))
+	if idx == -1 {
+		return errTagPresetNotFound
+	}
+	preset := presets[idx]
+
+	body := new(TagPresetToggleRequest)
+	if err := ctx.Bind(body); err != nil {
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	// get twitch auth
+	twitchAuth, err := helpers.GetTwitchAuth()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get Twitch auth")
+		return echo.NewHTTPError(500)
+	}
+
+	// read the current tags
+	client := twitch.NewClient(twitchAuth)
+	channel, err := client.GetChannelInformation(ctx.Request().Context(), twitchAuth.BroadcasterID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get Twitch channel information")
+		return twitchHTTPError(err)
+	}
+	hasTag := func(tags []string, tag string) bool {
+		return slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) })
+	}
+	tags := []string{}
+	if body.Enabled {
+		tags = append(tags, channel.Tags...)
+		for _, tag := range preset.Tags {
+			if !hasTag(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > streaminfo.MaxTags {
+			return echo.NewHTTPError(400, fmt.Sprintf("the channel would have %d tags, Twitch allows %d", len(tags), streaminfo.MaxTags))
+		}
+	} else {
+		for _, tag := range channel.Tags {
+			if !hasTag(preset.Tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	// send req
+	action := "tag_preset.disable"
+	if body.Enabled {
+		action = "tag_preset.enable"
+	}
+	err = modifyChannel(ctx.Request().Context(), client, twitchAuth.BroadcasterID, streaminfo.HistoryEntry{
+		Actor:  actor(ctx),
+		Action: action,
+		Target: preset.Name,
+	}, twitch.ModifyChannelInformationRequest{
+		GameID: channel.GameID,
+		Title:  channel.Title,
+		Tags:   tags,
+	})
+	auditAction(ctx, action, preset.Name, map[string]any{"tags": tags}, err)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to update Twitch channel tags")
+		return twitchHTTPError(err)
+	}
+
+	return ctx.JSON(200, TagPresetToggleResponse{Tags: tags})
+}
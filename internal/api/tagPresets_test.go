@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+)
+
+func TestTagPresetToggle(t *testing.T) {
+	srv, e := newTestAPI(t)
+	srv.SetChannel(twitch.ChannelInformation{BroadcasterID: broadcasterID, Title: "title", GameID: "27471", Tags: []string{"English", "Cozy"}})
+
+	rec := request(t, e, http.MethodPost, "/api/tag-presets", config.TagPreset{Name: "charity", Tags: []string{"Charity", "cozy"}})
+	if rec.Code != 200 {
+		t.Fatalf("failed to create tag preset: %d %s", rec.Code, rec.Body)
+	}
+	preset := decode[[]config.TagPreset](t, rec)[0]
+
+	// tags already set aren't added twice
+	rec = request(t, e, http.MethodPost, "/api/tag-presets/"+preset.ID+"/toggle", TagPresetToggleRequest{Enabled: true})
+	if rec.Code != 200 {
+		t.Fatalf("failed to toggle: %d %s", rec.Code, rec.Body)
+	}
+	channel := srv.Channel(broadcasterID)
+	if strings.Join(channel.Tags, ",") != "English,Cozy,Charity" || channel.Title != "title" || channel.GameID != "27471" {
+		t.Errorf("unexpected channel %+v", channel)
+	}
+	if entry := lastAudit(t, "tag_preset.enable"); !entry.Success || entry.Target != "charity" {
+		t.Errorf("unexpected audit entry %+v", entry)
+	}
+
+	rec = request(t, e, http.MethodPost, "/api/tag-presets/"+preset.ID+"/toggle", TagPresetToggleRequest{Enabled: false})
+	if tags := decode[TagPresetToggleResponse](t, rec).Tags; strings.Join(tags, ",") != "English" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	// more than 10 tags are rejected before reaching Twitch
+	srv.SetChannel(twitch.ChannelInformation{BroadcasterID: broadcasterID, Title: "title", Tags: strings.Split("a,b,c,d,e,f,g,h,i", ",")})
+	if rec := request(t, e, http.MethodPost, "/api/tag-presets/"+preset.ID+"/toggle", TagPresetToggleRequest{Enabled: true}); rec.Code != 400 {
+		t.Errorf("expected 400, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTagPresetValidation(t *testing.T) {
+	_, e := newTestAPI(t)
+
+	invalid := []config.TagPreset{
+		{Name: "", Tags: []string{"English"}},
+		{Name: "empty"},
+		{Name: "spaces", Tags: []string{"two words"}},
+		{Name: "too many", Tags: strings.Split("a,b,c,d,e,f,g,h,i,j,k", ",")},
+	}
+	for _, preset := range invalid {
+		if rec := request(t, e, http.MethodPost, "/api/tag-presets", preset); rec.Code != 400 {
+			t.Errorf("%+v: expected 400, got %d", preset, rec.Code)
+		}
+	}
+
+	preset := decode[[]config.TagPreset](t, request(t, e, http.MethodPost, "/api/tag-presets", config.TagPreset{Name: "ok", Tags: []string{"English"}}))[0]
+	preset.Tags = []string{"Deutsch"}
+	if rec := request(t, e, http.MethodPut, "/api/tag-presets/"+preset.ID, preset); rec.Code != 200 || config.Cfg.TagPresets[0].Tags[0] != "Deutsch" {
+		t.Errorf("failed to update tag preset: %d %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, e, http.MethodDelete, "/api/tag-presets/"+preset.ID, nil); rec.Code != 200 || len(config.Cfg.TagPresets) != 0 {
+		t.Errorf("failed to delete tag preset: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTagPresetConcurrentPosts(t *testing.T) {
+	_, e := newTestAPI(t)
+
+	// no tag preset is lost when they are created at the same time
+	var wg sync.WaitGroup
+	for idx := range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			preset := config.TagPreset{Name: fmt.Sprintf("preset %d", idx), Tags: []string{"English"}}
+			if rec := request(t, e, http.MethodPost, "/api/tag-presets", preset); rec.Code != 200 {
+				t.Errorf("failed to create tag preset: %d %s", rec.Code, rec.Body)
+			}
+		}()
+	}
+	wg.Wait()
+	if presets := loadTagPresets(); len(presets) != 5 {
+		t.Errorf("expected 5 tag presets, got %+v", presets)
+	}
+}
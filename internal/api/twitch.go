@@ -3,21 +3,18 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"net/url"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/nullvt/stream-admin/internal/config"
 	"github.com/nullvt/stream-admin/internal/helpers"
 	"github.com/nullvt/stream-admin/internal/livechat/twitch"
-	"github.com/nullvt/stream-admin/internal/secrets"
 	"github.com/rs/zerolog/log"
 )
 
-const (
-	twitchGqlUrl = "https://gql.twitch.tv/gql"
-)
-
 type TwitchUpdateChatSettingsRequest struct {
 	OperationName string                 `json:"operationName"`
 	Variables     map[string]interface{} `json:"variables"`
@@ -34,12 +31,6 @@ type TwitchUpdateChatSettingsResponse struct {
 	} `json:"data"`
 }
 
-type TwitchModifyChannelInformationRequest struct {
-	GameID string   `json:"game_id"`
-	Title  string   `json:"title"`
-	Tags   []string `json:"tags"`
-}
-
 type LinkFilteringRequest struct {
 	Enabled bool `json:"enabled"`
 }
@@ -52,18 +43,6 @@ func (h *Handler) TwitchLinkFiltering(ctx echo.Context) error {
 		return echo.NewHTTPError(500, err.Error())
 	}
 
-	// get channel ID
-	userInfoJson, err := secrets.Get("twitch_user")
-	if err != nil {
-		log.Error().Err(err).Msg("failed to get Twitch UserInfo from secrets")
-		return echo.NewHTTPError(500, "Failed to load UserInfo")
-	}
-	userInfo := &twitch.User{}
-	if err := userInfo.UnmarshalString(userInfoJson); err != nil {
-		log.Error().Err(err).Msg("failed to unmarshal Twitch UserInfo")
-		return echo.NewHTTPError(500, "Failed to load UserInfo")
-	}
-
 	// get twitch auth
 	twitchAuth, err := helpers.GetTwitchAuth()
 	if err != nil {
@@ -77,7 +56,7 @@ func (h *Handler) TwitchLinkFiltering(ctx echo.Context) error {
 			OperationName: "UpdateChatSettings",
 			Variables: map[string]interface{}{
 				"input": map[string]interface{}{
-					"channelID": userInfo.ID,
+					"channelID": twitchAuth.BroadcasterID,
 					"hideLinks": body.Enabled,
 				},
 			},
@@ -96,7 +75,7 @@ func (h *Handler) TwitchLinkFiltering(ctx echo.Context) error {
 		log.Error().Err(err).Msg("failed to marshal request body")
 		return echo.NewHTTPError(500, "Failed to create request")
 	}
-	req, err := http.NewRequest("POST", twitchGqlUrl, bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequest("POST", twitch.GQLURL, bytes.NewBuffer(bodyBytes))
 	if err != nil {
 		log.Error().Err(err).Msg("failed to init request")
 		return echo.NewHTTPError(500, "Failed to create request")
@@ -106,9 +85,11 @@ func (h *Handler) TwitchLinkFiltering(ctx echo.Context) error {
 	req.Header.Set("Content-Type", "application/json")
 
 	// send request
-	client := &http.Client{}
+	client := twitch.HTTPClient
+	auditParams := map[string]any{"enabled": body.Enabled}
 	resp, err := client.Do(req)
 	if err != nil {
+		auditAction(ctx, "chat.link_filtering", twitchAuth.BroadcasterID, auditParams, err)
 		log.Error().Err(err).Msg("GQL request failed")
 		return echo.NewHTTPError(500, "Failed query Twitch GQL")
 	}
@@ -121,20 +102,23 @@ func (h *Handler) TwitchLinkFiltering(ctx echo.Context) error {
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		auditAction(ctx, "chat.link_filtering", twitchAuth.BroadcasterID, auditParams, fmt.Errorf("twitch responded %d", resp.StatusCode))
 		log.Error().Any("responseCode", resp.StatusCode).Any("body", response).Msg("GQL request failed")
 		return echo.NewHTTPError(500, "Failed query Twitch GQL")
 	}
 
 	if response.Data.UpdateChatSettings.ChatSettings.HideLinks {
+		auditAction(ctx, "chat.link_filtering", twitchAuth.BroadcasterID, auditParams, nil)
 		return ctx.NoContent(200)
 	} else {
+		auditAction(ctx, "chat.link_filtering", twitchAuth.BroadcasterID, auditParams, errors.New("unexpected response from Twitch GQL"))
 		log.Error().Any("response", response.Data).Msg("unexpected response from Twitch GQL")
 		return echo.NewHTTPError(500, "Twitch GQL request failed")
 	}
 }
 
 func (h *Handler) TwitchCategorySearch(ctx echo.Context) error {
-	perPage := "20"
+	perPage := 20
 	query := ctx.Request().URL.Query().Get("query")
 	if query == "" {
 		return echo.NewHTTPError(400, "query param required")
@@ -147,52 +131,14 @@ func (h *Handler) TwitchCategorySearch(ctx echo.Context) error {
 		return echo.NewHTTPError(500)
 	}
 
-	// set URL and query
-	reqURL, _ := url.Parse("https://api.twitch.tv/helix/search/categories")
-	reqQuery := reqURL.Query()
-	reqQuery.Add("query", query)
-	reqQuery.Add("first", perPage) // WTF Twitch
-	reqURL.RawQuery = reqQuery.Encode()
-
-	// create http req
-	req, err := http.NewRequest("GET", reqURL.String(), nil)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to init request")
-		return echo.NewHTTPError(500)
-	}
-	req.Header.Set("Client-Id", twitchAuth.ClientID)
-	req.Header.Set("Authorization", twitchAuth.Bearer())
-	req.Header.Set("Content-Type", "application/json")
-
 	// send req
-	client := &http.Client{}
-	res, err := client.Do(req)
+	categories, err := twitch.NewClient(twitchAuth).SearchCategories(ctx.Request().Context(), query, perPage)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to search Twitch categories")
-		return echo.NewHTTPError(500, "twitch error")
-	}
-	defer res.Body.Close()
-
-	// check response code
-	if res.StatusCode != 200 {
-		log.Error().Any("responseCode", res.StatusCode).Msg("failed to search Twitch categories")
-		return echo.NewHTTPError(500, "twitch error")
+		return twitchHTTPError(err)
 	}
 
-	// parse the response
-	var resBody struct {
-		Data []struct {
-			ID        string `json:"id"`
-			Name      string `json:"name"`
-			BoxArtUrl string `json:"box_art_url"`
-		} `json:"data"`
-	}
-	if err := json.NewDecoder(res.Body).Decode(&resBody); err != nil {
-		log.Error().Err(err).Msg("failed to unmarshal response")
-		return echo.NewHTTPError(500)
-	}
-
-	return ctx.JSON(200, resBody.Data)
+	return ctx.JSON(200, categories)
 }
 
 func (h *Handler) TwitchGetStreamInfo(ctx echo.Context) error {
@@ -203,55 +149,74 @@ func (h *Handler) TwitchGetStreamInfo(ctx echo.Context) error {
 		return echo.NewHTTPError(500)
 	}
 
-	// set URL and query
-	reqURL, _ := url.Parse("https://api.twitch.tv/helix/channels")
-	reqQuery := reqURL.Query()
-	reqQuery.Add("broadcaster_id", twitchAuth.BroadcasterID)
-	reqURL.RawQuery = reqQuery.Encode()
-
-	// create http req
-	req, err := http.NewRequest("GET", reqURL.String(), nil)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to init request")
-		return echo.NewHTTPError(500)
-	}
-	req.Header.Set("Client-Id", twitchAuth.ClientID)
-	req.Header.Set("Authorization", twitchAuth.Bearer())
-	req.Header.Set("Content-Type", "application/json")
-
 	// send req
-	client := &http.Client{}
-	res, err := client.Do(req)
+	channelInfo, err := twitch.NewClient(twitchAuth).GetChannelInformation(ctx.Request().Context(), twitchAuth.BroadcasterID)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get channel information")
-		return echo.NewHTTPError(500, "twitch error")
+		log.Error().Err(err).Msg("failed to get Twitch channel information")
+		return twitchHTTPError(err)
 	}
-	defer res.Body.Close()
 
-	// check response code
-	if res.StatusCode != 200 {
-		log.Error().Any("responseCode", res.StatusCode).Msg("failed to get Twitch channel information")
-		return echo.NewHTTPError(500, "twitch error")
-	}
+	return ctx.JSON(200, channelInfo)
+}
 
-	// parse the response
-	var resBody struct {
-		Data []struct {
-			Title    string   `json:"title"`
-			GameName string   `json:"game_name"`
-			GameID   string   `json:"game_id"`
-			Tags     []string `json:"tags"`
-		} `json:"data"`
+// twitchHTTPError surfaces the message of a Helix error to the UI
+func twitchHTTPError(err error) error {
+	var apiErr *twitch.APIError
+	if errors.As(err, &apiErr) {
+		return echo.NewHTTPError(500, "twitch error: "+apiErr.Message)
 	}
-	if err := json.NewDecoder(res.Body).Decode(&resBody); err != nil {
-		log.Error().Err(err).Msg("failed to unmarshal response")
+	return echo.NewHTTPError(500, "twitch error")
+}
+
+type TwitchBroadcasterRequest struct {
+	Login string `json:"login"`
+}
+
+func (h *Handler) TwitchBroadcasterGet(ctx echo.Context) error {
+	// get twitch auth
+	twitchAuth, err := helpers.GetTwitchAuth()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get Twitch auth")
 		return echo.NewHTTPError(500)
 	}
 
-	if len(resBody.Data) != 1 {
-		log.Error().Any("dataLength", len(resBody.Data)).Msg("unexpected number of results for Twitch get stream info")
-		return echo.NewHTTPError(500, "malformed Twitch GetStreamInfo")
-	}
+	return ctx.JSON(200, map[string]string{
+		"user_id":        twitchAuth.UserID,
+		"broadcaster_id": twitchAuth.BroadcasterID,
+	})
+}
 
-	return ctx.JSON(200, resBody.Data[0])
+func (h *Handler) TwitchBroadcasterPut(ctx echo.Context) error {
+	// unmarshal request
+	body := new(TwitchBroadcasterRequest)
+	if err := ctx.Bind(body); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal request body")
+		return echo.NewHTTPError(400, "failed to unmarshal request body")
+	}
+
+	// resolve the channel, an empty login resets to the logged in account
+	broadcasterID := ""
+	if body.Login != "" {
+		twitchAuth, err := helpers.GetTwitchAuth()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get Twitch auth")
+			return echo.NewHTTPError(500)
+		}
+		users, err := twitch.NewClient(twitchAuth).GetUsers(ctx.Request().Context(), []string{strings.ToLower(body.Login)})
+		if err != nil {
+			log.Error().Err(err).Msg("failed to get twitch users")
+			return echo.NewHTTPError(404, "twitch user not found")
+		}
+		broadcasterID = users[0].ID
+	}
+
+	// persist to config
+	if err := config.SetConfigValue("twitch.broadcasterId", broadcasterID); err != nil {
+		log.Error().Err(err).Msg("failed to persist broadcasterId")
+		return echo.NewHTTPError(500, "failed to update broadcaster")
+	}
+	config.Cfg.Twitch.BroadcasterID = broadcasterID
+	auditAction(ctx, "twitch.broadcaster", broadcasterID, map[string]any{"login": body.Login}, nil)
+
+	return h.TwitchBroadcasterGet(ctx)
 }
@@ -1,13 +1,9 @@
 package api
 
 import (
-	"bytes"
-	"encoding/json"
-	"net/http"
-	"net/url"
-
 	"github.com/labstack/echo/v4"
 	"github.com/nullvt/stream-admin/internal/helpers"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
 	"github.com/rs/zerolog/log"
 )
 
@@ -18,15 +14,6 @@ type BanUserRequest struct {
 	Reason    *string `json:"reason,omitempty"`
 }
 
-type TwitchBanUserRequestData struct {
-	UserID   string  `json:"user_id"`
-	Duration *uint   `json:"duration,omitempty"`
-	Reason   *string `json:"reason,omitempty"`
-}
-type TwitchBanUserRequest struct {
-	Data TwitchBanUserRequestData `json:"data"`
-}
-
 func (h *Handler) TwitchBanUser(ctx echo.Context) error {
 	// unmarshal request
 	body := new(BanUserRequest)
@@ -36,52 +23,38 @@ func (h *Handler) TwitchBanUser(ctx echo.Context) error {
 	}
 
 	// get twitch auth
-	twitchAuth, err := helpers.GetTwitchAuth()
+	twitchAuth, err := helpers.GetTwitchAuthFor(helpers.TwitchBot)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get Twitch auth")
 		return echo.NewHTTPError(500)
 	}
 
-	// build request
-	reqURL, _ := url.Parse("https://api.twitch.tv/helix/moderation/bans")
-	reqQuery := reqURL.Query()
-	reqQuery.Add("broadcaster_id", twitchAuth.UserID)
-	reqQuery.Add("moderator_id", twitchAuth.UserID)
-	reqURL.RawQuery = reqQuery.Encode()
-	requestBody := TwitchBanUserRequest{
-		Data: TwitchBanUserRequestData{
-			UserID:   body.UserID,
-			Duration: body.Duration,
-			Reason:   body.Reason,
-		},
+	// record who was banned by name, the ID alone is hard to read back
+	client := twitch.NewClient(twitchAuth)
+	auditParams := map[string]any{
+		"permanent": body.Permanent,
+		"duration":  body.Duration,
+		"reason":    body.Reason,
 	}
-	bodyBytes, err := json.Marshal(requestBody)
+	users, err := client.GetUsersByID(ctx.Request().Context(), []string{body.UserID})
 	if err != nil {
-		log.Error().Err(err).Msg("failed to marshal request body")
-		return echo.NewHTTPError(500, "Failed to create request")
+		log.Warn().Err(err).Str("user", body.UserID).Msg("failed to look up banned Twitch user")
 	}
-	req, err := http.NewRequest("POST", reqURL.String(), bytes.NewBuffer(bodyBytes))
-	if err != nil {
-		log.Error().Err(err).Msg("failed to init request")
-		return echo.NewHTTPError(500)
+	if len(users) > 0 {
+		auditParams["login"] = users[0].Login
+		auditParams["display_name"] = users[0].DisplayName
 	}
-	req.Header.Set("Client-Id", twitchAuth.ClientID)
-	req.Header.Set("Authorization", twitchAuth.Bearer())
-	req.Header.Set("Content-Type", "application/json")
 
 	// send req
-	client := &http.Client{}
-	res, err := client.Do(req)
+	err = client.BanUser(ctx.Request().Context(), twitch.BanUserRequest{
+		UserID:   body.UserID,
+		Duration: body.Duration,
+		Reason:   body.Reason,
+	})
+	auditAction(ctx, "user.ban", body.UserID, auditParams, err)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to update Twitch channel info")
-		return echo.NewHTTPError(500, "twitch error")
-	}
-	defer res.Body.Close()
-
-	// check response code
-	if res.StatusCode != 200 {
-		log.Error().Any("responseCode", res.StatusCode).Msg("failed to update Twitch channel info")
-		return echo.NewHTTPError(500, "twitch error")
+		log.Error().Err(err).Msg("failed to ban Twitch user")
+		return twitchHTTPError(err)
 	}
 
 	return ctx.JSON(204, nil)
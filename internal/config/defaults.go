@@ -5,21 +5,61 @@ import "github.com/spf13/viper"
 func setDefaults() {
 	defaultConfig := Config{
 		Twitch: TwitchConfig{
-			ClientID: "",
+			ClientID:      "",
+			BroadcasterID: "",
 		},
 		Server: ServerConfig{
 			Host:    "localhost",
 			Port:    8080,
 			BaseURL: "http://localhost:8080/",
+			AllowOrigins: []string{
+				"http://localhost:3001",
+				"http://localhost:8080",
+			},
 		},
 		EmotesWhitelist:   map[string]string{},
 		StreamInfoPresets: []StreamInfoPreset{},
+		EmoteStats: EmoteStatsConfig{
+			PerChatter: false,
+		},
+		Users: []APIUser{},
+		Secrets: SecretsConfig{
+			Backend:    "",
+			Encrypted:  false,
+			KeyFile:    "",
+			Command:    []string{},
+			SetCommand: []string{},
+		},
+		Templates: TemplatesConfig{
+			Variables:   map[string]string{},
+			Challenges:  map[string]string{},
+			StreamCount: 0,
+		},
+		TagPresets: []TagPreset{},
 	}
 
 	viper.SetDefault("twitch.clientId", defaultConfig.Twitch.ClientID)
+	viper.SetDefault("twitch.broadcasterId", defaultConfig.Twitch.BroadcasterID)
+	viper.SetDefault("twitch.helixUrl", defaultConfig.Twitch.HelixURL)
+	viper.SetDefault("twitch.oauthUrl", defaultConfig.Twitch.OAuthURL)
+	viper.SetDefault("twitch.eventSubUrl", defaultConfig.Twitch.EventSubURL)
+	viper.SetDefault("twitch.gqlUrl", defaultConfig.Twitch.GQLURL)
 	viper.SetDefault("server.host", defaultConfig.Server.Host)
 	viper.SetDefault("server.port", defaultConfig.Server.Port)
 	viper.SetDefault("server.baseUrl", defaultConfig.Server.BaseURL)
+	viper.SetDefault("server.passwordHash", defaultConfig.Server.PasswordHash)
+	viper.SetDefault("server.allowOrigins", defaultConfig.Server.AllowOrigins)
 	viper.SetDefault("emotesWhitelist", defaultConfig.EmotesWhitelist)
 	viper.SetDefault("streamInfoPresets", defaultConfig.StreamInfoPresets)
+	viper.SetDefault("emoteStats.perChatter", defaultConfig.EmoteStats.PerChatter)
+	viper.SetDefault("users", defaultConfig.Users)
+	viper.SetDefault("secrets.backend", defaultConfig.Secrets.Backend)
+	viper.SetDefault("secrets.encrypted", defaultConfig.Secrets.Encrypted)
+	viper.SetDefault("secrets.keyFile", defaultConfig.Secrets.KeyFile)
+	viper.SetDefault("secrets.command", defaultConfig.Secrets.Command)
+	viper.SetDefault("secrets.setCommand", defaultConfig.Secrets.SetCommand)
+	viper.SetDefault("templates.variables", defaultConfig.Templates.Variables)
+	viper.SetDefault("templates.challenges", defaultConfig.Templates.Challenges)
+	viper.SetDefault("templates.streamCount", defaultConfig.Templates.StreamCount)
+	viper.SetDefault("tagPresets", defaultConfig.TagPresets)
 }
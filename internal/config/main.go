@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -16,22 +17,105 @@ type Config struct {
 	Server            ServerConfig       `json:"server"`
 	EmotesWhitelist   map[string]string  `json:"emotesWhitelist"`
 	StreamInfoPresets []StreamInfoPreset `json:"streamInfoPresets"`
+	EmoteStats        EmoteStatsConfig   `json:"emoteStats"`
+	Users             []APIUser          `json:"users"`
+	Secrets           SecretsConfig      `json:"secrets"`
+	Templates         TemplatesConfig    `json:"templates"`
+	TagPresets        []TagPreset        `json:"tagPresets"`
 }
 
 type TwitchConfig struct {
 	ClientID string `json:"clientId"`
+
+	// BroadcasterID is the channel to administer, defaults to the logged in account
+	BroadcasterID string `json:"broadcasterId"`
+
+	// Twitch endpoints, empty uses the real ones
+	HelixURL    string `json:"helixUrl"`
+	OAuthURL    string `json:"oauthUrl"`
+	EventSubURL string `json:"eventSubUrl"`
+	GQLURL      string `json:"gqlUrl"`
+}
+
+// TemplatesConfig holds the values used by {{placeholders}} in presets
+type TemplatesConfig struct {
+	// Variables are rendered by {{name}}, names are case-insensitive
+	Variables map[string]string `json:"variables"`
+
+	// Challenges map a name to its start date (YYYY-MM-DD) for {{day:name}}
+	Challenges map[string]string `json:"challenges"`
+
+	// StreamCount is incremented each time the stream goes live
+	StreamCount int `json:"streamCount"`
+}
+
+type EmoteStatsConfig struct {
+	PerChatter bool `json:"perChatter"`
+}
+
+type SecretsConfig struct {
+	// Backend is plaintext, encrypted, keyring, env or command. When empty
+	// it follows Server.Keyring and Encrypted.
+	Backend string `json:"backend"`
+
+	// Encrypted stores secrets.json encrypted at rest, the key is derived from
+	// the passphrase environment variable or the key file
+	Encrypted bool   `json:"encrypted"`
+	KeyFile   string `json:"keyFile"`
+
+	// Command prints the secret named by the {key} argument, SetCommand
+	// receives a new value on stdin
+	Command    []string `json:"command"`
+	SetCommand []string `json:"setCommand"`
 }
 
 type ServerConfig struct {
-	Host    string
-	Port    uint16
-	BaseURL string `json:"baseUrl"`
-	Keyring bool
+	Host         string
+	Port         uint16
+	BaseURL      string `json:"baseUrl"`
+	Keyring      bool
+	PasswordHash string   `json:"passwordHash"`
+	AllowOrigins []string `json:"allowOrigins"`
+}
+
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleModerator Role = "moderator"
+	RoleOwner     Role = "owner"
+)
+
+// roleLevels orders roles so that each one includes the ones below it
+var roleLevels = map[Role]int{
+	RoleViewer:    1,
+	RoleModerator: 2,
+	RoleOwner:     3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleLevels[r]
+	return ok
 }
 
+// Includes reports whether the role has at least the permissions of required
+func (r Role) Includes(required Role) bool {
+	return r.Valid() && roleLevels[r] >= roleLevels[required]
+}
+
+type APIUser struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"passwordHash"`
+	Role         Role   `json:"role"`
+}
+
+// StreamInfoPreset sets the channel information at once, presets are listed
+// in the order they are stored in
 type StreamInfoPreset struct {
 	ID       string   `json:"id"`
 	Name     string   `json:"name"`
+	Group    string   `json:"group,omitempty"`
+	Favorite bool     `json:"favorite,omitempty"`
 	Title    string   `json:"title"`
 	Tags     []string `json:"tags"`
 	Category struct {
@@ -39,6 +123,46 @@ type StreamInfoPreset struct {
 		Name     string `json:"name"`
 		ImageURL string `json:"image_url"`
 	} `json:"category"`
+
+	// empty fields are left as they are when applying, only the listed labels
+	// are changed
+	BroadcasterLanguage         string                       `json:"broadcasterLanguage,omitempty"`
+	Delay                       *int                         `json:"delay,omitempty"`
+	ContentClassificationLabels []ContentClassificationLabel `json:"contentClassificationLabels,omitempty"`
+	IsBrandedContent            *bool                        `json:"isBrandedContent,omitempty"`
+
+	Schedule *PresetSchedule `json:"schedule,omitempty"`
+
+	// LastApplied is an RFC3339 time, it is set by the server
+	LastApplied string `json:"lastApplied,omitempty"`
+}
+
+// TagPreset is a set of tags turned on or off without changing the rest of
+// the channel information
+type TagPreset struct {
+	ID   string   `json:"id"`
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+type ContentClassificationLabel struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+}
+
+// PresetSchedule applies a preset automatically, exactly one of Cron, At or
+// AfterOnline is set
+type PresetSchedule struct {
+	Enabled bool `json:"enabled"`
+
+	// Cron is a five field expression in the server's time zone
+	Cron string `json:"cron,omitempty"`
+
+	// At is an RFC3339 time to apply the preset once
+	At string `json:"at,omitempty"`
+
+	// AfterOnline is a duration after the stream goes live, e.g. "30m"
+	AfterOnline string `json:"afterOnline,omitempty"`
 }
 
 // Global variable to hold the loaded config.
@@ -122,8 +246,15 @@ func createConfigFile(configDir, configFileName string) error {
 	return nil
 }
 
+// writeMu serializes config writes
+var writeMu sync.Mutex
+
 // SetConfigValue sets a configuration value and persists it to the config file.
 func SetConfigValue(key string, value interface{}) error {
+	// viper isn't safe for concurrent use, handlers and background tasks write
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
 	// Set the new value in Viper's in-memory configuration
 	viper.Set(key, value)
 
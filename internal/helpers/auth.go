@@ -1,24 +1,207 @@
 package helpers
 
 import (
+	"context"
+	"strings"
+	"time"
+
 	"github.com/nullvt/stream-admin/internal/config"
 	"github.com/nullvt/stream-admin/internal/livechat/twitch"
 	"github.com/nullvt/stream-admin/internal/secrets"
 	"github.com/rs/zerolog/log"
 )
 
+// Twitch identities, the broadcaster owns the channel while the bot sends
+// chat messages and moderates
+const (
+	TwitchBroadcaster = "broadcaster"
+	TwitchBot         = "bot"
+)
+
+var TwitchIdentities = []string{TwitchBroadcaster, TwitchBot}
+
+func ValidTwitchIdentity(identity string) bool {
+	for _, known := range TwitchIdentities {
+		if identity == known {
+			return true
+		}
+	}
+	return false
+}
+
+// twitchSecretKey namespaces secrets per identity, the broadcaster keeps the
+// original unprefixed keys
+func twitchSecretKey(identity string, name string) string {
+	if identity == TwitchBroadcaster || identity == "" {
+		return "twitch_" + name
+	}
+	return "twitch_" + identity + "_" + name
+}
+
+// GetTwitchAuth returns the broadcaster's auth config
 func GetTwitchAuth() (twitch.AuthConfig, error) {
-	twitchToken, err := secrets.Get("twitch_token")
+	return GetTwitchAuthFor(TwitchBroadcaster)
+}
+
+// GetTwitchAuthFor returns the auth config for an identity, falling back to
+// the broadcaster when that identity isn't connected
+func GetTwitchAuthFor(identity string) (twitch.AuthConfig, error) {
+	twitchToken, err := secrets.Get(twitchSecretKey(identity, "token"))
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed to load twitch_token")
+		log.Error().Err(err).Msg("failed to load twitch_token")
 		return twitch.AuthConfig{}, err
 	}
-
-	return twitch.AuthConfig{
+	if twitchToken == "" && identity != TwitchBroadcaster {
+		return GetTwitchAuthFor(TwitchBroadcaster)
+	}
+	auth := twitch.AuthConfig{
 		ClientID:  config.Cfg.Twitch.ClientID,
 		AuthToken: twitchToken,
-		// TODO: replace with user from secrets
-		UserID:        "1113117444",
-		BroadcasterID: "1113117444",
-	}, nil
+	}
+
+	// the logged in account, looked up if it was never persisted
+	user, err := GetTwitchUser(identity)
+	if err != nil {
+		return auth, err
+	}
+	if user == nil && twitchToken != "" {
+		if user, err = fetchTwitchUser(identity, auth); err != nil {
+			log.Warn().Err(err).Str("identity", identity).Msg("failed to look up the logged in Twitch user")
+		}
+	}
+	if user != nil {
+		auth.UserID = user.ID
+	}
+
+	// administer the broadcaster's channel unless another one is configured
+	auth.BroadcasterID = config.Cfg.Twitch.BroadcasterID
+	if auth.BroadcasterID == "" && identity == TwitchBroadcaster {
+		auth.BroadcasterID = auth.UserID
+	}
+	if auth.BroadcasterID == "" {
+		broadcaster, err := GetTwitchUser(TwitchBroadcaster)
+		if err != nil {
+			return auth, err
+		}
+		if broadcaster != nil {
+			auth.BroadcasterID = broadcaster.ID
+		}
+	}
+
+	return auth, nil
+}
+
+// GetTwitchUser returns the account logged in as an identity, or nil if not
+// logged in
+func GetTwitchUser(identity string) (*twitch.User, error) {
+	userJson, err := secrets.Get(twitchSecretKey(identity, "user"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to load twitch_user")
+		return nil, err
+	}
+	if userJson == "" {
+		return nil, nil
+	}
+
+	user := &twitch.User{}
+	if err := user.UnmarshalString(userJson); err != nil {
+		log.Error().Err(err).Msg("failed to unmarshal twitch_user")
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetTwitchUser persists the account logged in as an identity, nil clears it
+func SetTwitchUser(identity string, user *twitch.User) error {
+	if user == nil {
+		return secrets.Set(twitchSecretKey(identity, "user"), "")
+	}
+
+	userJson, err := user.MarshalString()
+	if err != nil {
+		return err
+	}
+	return secrets.Set(twitchSecretKey(identity, "user"), userJson)
+}
+
+// fetchTwitchUser looks up the owner of the token and persists it
+func fetchTwitchUser(identity string, auth twitch.AuthConfig) (*twitch.User, error) {
+	users, err := twitch.NewClient(auth).GetUsers(context.Background(), []string{})
+	if err != nil {
+		return nil, err
+	}
+	if err := SetTwitchUser(identity, &users[0]); err != nil {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+// TwitchTokenStore persists the Twitch OAuth tokens of an identity in secrets
+type TwitchTokenStore struct {
+	Identity string
+}
+
+// TwitchTokenStores returns a store for every identity
+func TwitchTokenStores() map[string]twitch.TokenStore {
+	stores := map[string]twitch.TokenStore{}
+	for _, identity := range TwitchIdentities {
+		stores[identity] = TwitchTokenStore{Identity: identity}
+	}
+	return stores
+}
+
+func (ts TwitchTokenStore) LoadToken() (twitch.Token, error) {
+	token := twitch.Token{}
+	var err error
+	if token.AccessToken, err = secrets.Get(twitchSecretKey(ts.Identity, "token")); err != nil {
+		return token, err
+	}
+	if token.RefreshToken, err = secrets.Get(twitchSecretKey(ts.Identity, "refresh_token")); err != nil {
+		return token, err
+	}
+	expiresAt, err := secrets.Get(twitchSecretKey(ts.Identity, "token_expiry"))
+	if err != nil {
+		return token, err
+	}
+	if expiresAt != "" {
+		if token.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+			return token, err
+		}
+	}
+	scopes, err := secrets.Get(twitchSecretKey(ts.Identity, "token_scopes"))
+	if err != nil {
+		return token, err
+	}
+	if scopes != "" {
+		token.Scopes = strings.Split(scopes, " ")
+	}
+
+	return token, nil
+}
+
+func (ts TwitchTokenStore) SaveToken(token twitch.Token) error {
+	// the shared client must not keep using the old token
+	defer twitch.InvalidateTokens(ts.Identity)
+
+	expiresAt := ""
+	if !token.ExpiresAt.IsZero() {
+		expiresAt = token.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	values := map[string]string{
+		"token":         token.AccessToken,
+		"refresh_token": token.RefreshToken,
+		"token_expiry":  expiresAt,
+		"token_scopes":  strings.Join(token.Scopes, " "),
+	}
+	for name, value := range values {
+		if err := secrets.Set(twitchSecretKey(ts.Identity, name), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ts TwitchTokenStore) ClientSecret() (string, error) {
+	return secrets.Get("twitch_client_secret")
 }
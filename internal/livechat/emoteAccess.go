@@ -0,0 +1,36 @@
+package livechat
+
+const (
+	EmoteTypeGlobal        = "globals"
+	EmoteTypeSubscriptions = "subscriptions"
+	EmoteTypeFollower      = "follower"
+	EmoteTypeBitsTier      = "bitstier"
+)
+
+// EmoteAccess describes who is able to use an emote
+type EmoteAccess struct {
+	Tier       string `json:"tier,omitempty"`
+	EmoteType  string `json:"emote_type,omitempty"`
+	EmoteSetID string `json:"emote_set_id,omitempty"`
+}
+
+// UsableBy reports whether the sender plausibly has access to the emote when
+// chatting in channelID. Only access that can be checked from the message is
+// enforced: follower emotes only work in the owning channel, and in the owning
+// channel sub emotes require a subscriber badge. Access to other channels'
+// emotes cannot be verified so is assumed.
+func (e *Emote) UsableBy(sender User, channelID string) bool {
+	ownChannel := e.Segment == channelID
+	if ownChannel && sender.Broadcaster {
+		return true
+	}
+
+	switch e.Access.EmoteType {
+	case EmoteTypeFollower:
+		return ownChannel
+	case EmoteTypeSubscriptions:
+		return !ownChannel || sender.TwitchSubscriber
+	default:
+		return true
+	}
+}
@@ -0,0 +1,115 @@
+package livechat
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Twitch emote modifier suffixes, e.g. "LUL_HF" is LUL flipped horizontally
+var twitchEmoteModifiers = []string{"_BW", "_HF", "_SG", "_SQ", "_TK"}
+
+type messageToken struct {
+	text      string
+	start     int
+	runeStart int
+}
+
+// tokenizeMessage splits a message on any unicode whitespace, keeping the byte
+// and rune offset of each token
+func tokenizeMessage(text string) []messageToken {
+	tokens := []messageToken{}
+	start := -1
+	runeStart := 0
+	runeIdx := 0
+	for idx, r := range text {
+		if unicode.IsSpace(r) {
+			if start != -1 {
+				tokens = append(tokens, messageToken{text: text[start:idx], start: start, runeStart: runeStart})
+				start = -1
+			}
+		} else if start == -1 {
+			start = idx
+			runeStart = runeIdx
+		}
+		runeIdx++
+	}
+	if start != -1 {
+		tokens = append(tokens, messageToken{text: text[start:], start: start, runeStart: runeStart})
+	}
+	return tokens
+}
+
+// MatchMessage finds every emote occurrence in a message. Tokens are matched
+// as-is first, then with surrounding punctuation trimmed, then without a Twitch
+// modifier suffix. Emotes are looked up on each platform in order, e.g. Twitch
+// then 7TV. Zero-width emotes are flagged so they can be overlaid on the
+// previous emote. usable may be nil to accept every emote.
+func (ec *EmoteCache) MatchMessage(text string, platforms []Platform, usable func(*Emote) bool) []MessageEmote {
+	emotes := []MessageEmote{}
+	for _, token := range tokenizeMessage(text) {
+		emote, name, offset, modifier := ec.matchToken(token.text, platforms, usable)
+		if emote == nil {
+			continue
+		}
+
+		start := token.start + offset
+		runeStart := token.runeStart + utf8.RuneCountInString(token.text[:offset])
+		end := start + len(name) + len(modifier)
+		emotes = append(emotes, MessageEmote{
+			ID:        emote.ID,
+			Name:      name,
+			Modifier:  strings.TrimPrefix(modifier, "_"),
+			ZeroWidth: emote.ZeroWidth,
+			Start:     start,
+			End:       end,
+			RuneStart: runeStart,
+			RuneEnd:   runeStart + utf8.RuneCountInString(text[start:end]),
+		})
+	}
+	return emotes
+}
+
+// matchToken returns the emote for a token along with the matched name, its
+// byte offset within the token and any modifier suffix
+func (ec *EmoteCache) matchToken(token string, platforms []Platform, usable func(*Emote) bool) (*Emote, string, int, string) {
+	find := func(name string) *Emote {
+		for _, platform := range platforms {
+			emote := ec.FindByName(name, platform)
+			if emote != nil && (usable == nil || usable(emote)) {
+				return emote
+			}
+		}
+		return nil
+	}
+
+	// exact match, emote names such as ":)" or "D:" contain punctuation
+	if emote := find(token); emote != nil {
+		return emote, token, 0, ""
+	}
+
+	// trim surrounding punctuation, e.g. "LUL," or "(Kappa)"
+	trimmed := strings.TrimFunc(token, unicode.IsPunct)
+	if trimmed == "" {
+		return nil, "", 0, ""
+	}
+	offset := strings.Index(token, trimmed)
+	if trimmed != token {
+		if emote := find(trimmed); emote != nil {
+			return emote, trimmed, offset, ""
+		}
+	}
+
+	// strip a Twitch modifier suffix
+	for _, modifier := range twitchEmoteModifiers {
+		name, ok := strings.CutSuffix(trimmed, modifier)
+		if !ok || name == "" {
+			continue
+		}
+		if emote := find(name); emote != nil && emote.Platform == Twitch {
+			return emote, name, offset, modifier
+		}
+	}
+
+	return nil, "", 0, ""
+}
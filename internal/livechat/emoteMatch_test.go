@@ -0,0 +1,90 @@
+package livechat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []messageToken
+	}{
+		{"empty", "", []messageToken{}},
+		{"single", "Kappa", []messageToken{{"Kappa", 0, 0}}},
+		{"repeated whitespace", "  hi \t\nKappa  ", []messageToken{{"hi", 2, 2}, {"Kappa", 7, 7}}},
+		{"unicode whitespace", "hi　Kappa", []messageToken{{"hi", 0, 0}, {"Kappa", 5, 3}}},
+		{"multibyte", "héllo 🎉 Kappa", []messageToken{{"héllo", 0, 0}, {"🎉", 7, 6}, {"Kappa", 12, 8}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenizeMessage(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenizeMessage(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchMessage(t *testing.T) {
+	cache := NewEmoteCache(
+		Emote{ID: "kappa", Name: "Kappa", Platform: Twitch},
+		Emote{ID: "lul", Name: "LUL", Platform: Twitch},
+		Emote{ID: "smile", Name: ":)", Platform: Twitch},
+		Emote{ID: "ez", Name: "EZ", Platform: SevenTV},
+		Emote{ID: "rain", Name: "RainTime", Platform: SevenTV, ZeroWidth: true},
+		Emote{ID: "lul7tv", Name: "LUL", Platform: SevenTV},
+	)
+	platforms := []Platform{Twitch, SevenTV}
+
+	tests := []struct {
+		name string
+		text string
+		want []MessageEmote
+	}{
+		{"no emotes", "hello there", []MessageEmote{}},
+		{"punctuation", "LUL, that was (Kappa)!", []MessageEmote{
+			{ID: "lul", Name: "LUL", Start: 0, End: 3, RuneStart: 0, RuneEnd: 3},
+			{ID: "kappa", Name: "Kappa", Start: 15, End: 20, RuneStart: 15, RuneEnd: 20},
+		}},
+		{"punctuation in name", "hi :)", []MessageEmote{
+			{ID: "smile", Name: ":)", Start: 3, End: 5, RuneStart: 3, RuneEnd: 5},
+		}},
+		{"repeated whitespace", "Kappa   \t LUL", []MessageEmote{
+			{ID: "kappa", Name: "Kappa", Start: 0, End: 5, RuneStart: 0, RuneEnd: 5},
+			{ID: "lul", Name: "LUL", Start: 10, End: 13, RuneStart: 10, RuneEnd: 13},
+		}},
+		{"multibyte before emote", "héllo 🎉 Kappa", []MessageEmote{
+			{ID: "kappa", Name: "Kappa", Start: 12, End: 17, RuneStart: 8, RuneEnd: 13},
+		}},
+		{"duplicates", "Kappa Kappa Kappa", []MessageEmote{
+			{ID: "kappa", Name: "Kappa", Start: 0, End: 5, RuneStart: 0, RuneEnd: 5},
+			{ID: "kappa", Name: "Kappa", Start: 6, End: 11, RuneStart: 6, RuneEnd: 11},
+			{ID: "kappa", Name: "Kappa", Start: 12, End: 17, RuneStart: 12, RuneEnd: 17},
+		}},
+		{"modifier", "Kappa_HF", []MessageEmote{
+			{ID: "kappa", Name: "Kappa", Modifier: "HF", Start: 0, End: 8, RuneStart: 0, RuneEnd: 8},
+		}},
+		{"modifiers are Twitch only", "EZ_HF", []MessageEmote{}},
+		{"zero width", "EZ RainTime", []MessageEmote{
+			{ID: "ez", Name: "EZ", Start: 0, End: 2, RuneStart: 0, RuneEnd: 2},
+			{ID: "rain", Name: "RainTime", ZeroWidth: true, Start: 3, End: 11, RuneStart: 3, RuneEnd: 11},
+		}},
+		{"platform order", "LUL", []MessageEmote{
+			{ID: "lul", Name: "LUL", Start: 0, End: 3, RuneStart: 0, RuneEnd: 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cache.MatchMessage(tt.text, platforms, nil); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MatchMessage(%q) = %+v, want %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	// unusable emotes are skipped
+	got := cache.MatchMessage("Kappa LUL", platforms, func(emote *Emote) bool { return emote.ID != "kappa" })
+	if len(got) != 1 || got[0].ID != "lul" {
+		t.Errorf("expected only the usable emote, got %+v", got)
+	}
+}
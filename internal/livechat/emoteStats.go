@@ -0,0 +1,281 @@
+package livechat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EmoteStatsFile = "./emotestats.json"
+
+	// hourly buckets older than this are dropped, all-time totals are kept
+	emoteStatsRetention = 90 * 24 * time.Hour
+)
+
+type EmoteUsage struct {
+	EmoteID  string            `json:"emote_id"`
+	Name     string            `json:"name"`
+	Platform Platform          `json:"platform"`
+	Total    uint64            `json:"total"`
+	Hourly   map[int64]uint64  `json:"hourly"`
+	Chatters map[string]uint64 `json:"chatters,omitempty"`
+}
+
+// EmoteStats counts how often each emote is used in chat. Usage is bucketed
+// by hour so it can be queried over a time window. The session starts when
+// the stream goes live and is kept across restarts.
+type EmoteStats struct {
+	Emotes       map[string]*EmoteUsage `json:"emotes"`
+	SessionStart time.Time              `json:"session_start"`
+	PerChatter   bool                   `json:"-"`
+
+	mu    sync.Mutex
+	dirty bool
+}
+
+type EmoteStatsQuery struct {
+	Since    time.Time
+	Platform Platform
+	Limit    int
+	Chatters bool
+}
+
+type EmoteUsageCount struct {
+	EmoteID  string            `json:"emote_id"`
+	Name     string            `json:"name"`
+	Platform Platform          `json:"platform"`
+	Count    uint64            `json:"count"`
+	Chatters map[string]uint64 `json:"chatters,omitempty"`
+}
+
+type EmoteStatsResult struct {
+	Since     time.Time           `json:"since"`
+	Total     uint64              `json:"total"`
+	Platforms map[Platform]uint64 `json:"platforms"`
+	Top       []EmoteUsageCount   `json:"top"`
+}
+
+func NewEmoteStats(perChatter bool) *EmoteStats {
+	return &EmoteStats{
+		Emotes:       map[string]*EmoteUsage{},
+		SessionStart: time.Now().UTC(),
+		PerChatter:   perChatter,
+	}
+}
+
+// StartSession resets the per stream session, e.g. as the stream goes live.
+// A zero time starts the session now.
+func (es *EmoteStats) StartSession(at time.Time) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.SessionStart = at.UTC()
+	es.dirty = true
+}
+
+// Session returns the start of the current stream session
+func (es *EmoteStats) Session() time.Time {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.SessionStart
+}
+
+// Record counts every emote occurrence in a message
+func (es *EmoteStats) Record(msg Message) {
+	if len(msg.Emotes) == 0 {
+		return
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	receivedAt := msg.ReceivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now().UTC()
+	}
+	hour := receivedAt.Truncate(time.Hour).Unix()
+	for _, emote := range msg.Emotes {
+		usage, ok := es.Emotes[emote.ID]
+		if !ok {
+			usage = &EmoteUsage{
+				EmoteID:  emote.ID,
+				Platform: msg.Platform,
+				Hourly:   map[int64]uint64{},
+			}
+			es.Emotes[emote.ID] = usage
+		}
+		usage.Name = emote.Name
+		usage.Total++
+		usage.Hourly[hour]++
+		if es.PerChatter && msg.Sender.ID != "" {
+			if usage.Chatters == nil {
+				usage.Chatters = map[string]uint64{}
+			}
+			usage.Chatters[msg.Sender.ID]++
+		}
+	}
+	es.dirty = true
+}
+
+// Tee records the stats of each message from in before forwarding it to out
+func (es *EmoteStats) Tee(in <-chan Message, out chan<- Message) {
+	defer close(out)
+	for msg := range in {
+		es.Record(msg)
+		out <- msg
+	}
+}
+
+// Query returns the most used emotes since the given time. A zero Since
+// returns all-time totals, and a zero Limit returns every emote.
+func (es *EmoteStats) Query(query EmoteStatsQuery) EmoteStatsResult {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	result := EmoteStatsResult{
+		Since:     query.Since,
+		Platforms: map[Platform]uint64{},
+		Top:       []EmoteUsageCount{},
+	}
+	since := query.Since.Truncate(time.Hour).Unix()
+	for _, usage := range es.Emotes {
+		if query.Platform != "" && usage.Platform != query.Platform {
+			continue
+		}
+
+		// count usage inside the window
+		count := usage.Total
+		if !query.Since.IsZero() {
+			count = 0
+			for hour, hourCount := range usage.Hourly {
+				if hour >= since {
+					count += hourCount
+				}
+			}
+		}
+		if count == 0 {
+			continue
+		}
+
+		result.Total += count
+		result.Platforms[usage.Platform] += count
+		usageCount := EmoteUsageCount{
+			EmoteID:  usage.EmoteID,
+			Name:     usage.Name,
+			Platform: usage.Platform,
+			Count:    count,
+		}
+		if query.Chatters && usage.Chatters != nil {
+			usageCount.Chatters = map[string]uint64{}
+			for chatterID, chatterCount := range usage.Chatters {
+				usageCount.Chatters[chatterID] = chatterCount
+			}
+		}
+		result.Top = append(result.Top, usageCount)
+	}
+
+	// most used first
+	sort.Slice(result.Top, func(i, j int) bool {
+		if result.Top[i].Count == result.Top[j].Count {
+			return result.Top[i].Name < result.Top[j].Name
+		}
+		return result.Top[i].Count > result.Top[j].Count
+	})
+	if query.Limit > 0 && len(result.Top) > query.Limit {
+		result.Top = result.Top[:query.Limit]
+	}
+
+	return result
+}
+
+// prune drops hourly buckets older than the retention period
+func (es *EmoteStats) prune() {
+	cutoff := time.Now().Add(-emoteStatsRetention).Unix()
+	for _, usage := range es.Emotes {
+		for hour := range usage.Hourly {
+			if hour < cutoff {
+				delete(usage.Hourly, hour)
+			}
+		}
+	}
+}
+
+func (es *EmoteStats) SaveToFile(fileName string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.prune()
+
+	// convert data into JSON
+	content, err := json.Marshal(es)
+	if err != nil {
+		return fmt.Errorf("failed to marshal EmoteStats to JSON: %w", err)
+	}
+
+	// Write content to the file
+	if err := os.WriteFile(fileName, content, 0644); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	es.dirty = false
+
+	return nil
+}
+
+func (es *EmoteStats) LoadFromFile(fileName string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	// Ensure the file exists before trying to load it
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return fmt.Errorf("file does not exist: %w", err)
+	}
+
+	// Read the file content
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Unmarshal the JSON content into the EmoteStats struct
+	if err := json.Unmarshal(content, es); err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	if es.Emotes == nil {
+		es.Emotes = map[string]*EmoteUsage{}
+	}
+
+	return nil
+}
+
+// SaveOnChange periodically persists the stats when they have changed, until
+// the context is cancelled
+func (es *EmoteStats) SaveOnChange(ctx context.Context, fileName string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		es.mu.Lock()
+		dirty := es.dirty
+		es.mu.Unlock()
+		if !dirty {
+			continue
+		}
+		if err := es.SaveToFile(fileName); err != nil {
+			log.Error().Err(err).Msg("failed to save emote stats")
+		}
+	}
+}
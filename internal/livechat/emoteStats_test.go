@@ -0,0 +1,69 @@
+package livechat
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEmoteStatsSession(t *testing.T) {
+	stats := NewEmoteStats(false)
+	live := time.Now().Add(-2 * time.Hour).UTC().Truncate(time.Second)
+	stats.StartSession(live)
+	if !stats.Session().Equal(live) {
+		t.Fatalf("expected the session to start at %s, got %s", live, stats.Session())
+	}
+
+	// the session survives restarts
+	fileName := filepath.Join(t.TempDir(), "stats.json")
+	if err := stats.SaveToFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewEmoteStats(false)
+	if err := loaded.LoadFromFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Session().Equal(live) {
+		t.Errorf("expected the loaded session to start at %s, got %s", live, loaded.Session())
+	}
+
+	// events without a start time start the session now
+	before := time.Now()
+	stats.StartSession(time.Time{})
+	if stats.Session().Before(before) {
+		t.Errorf("expected the session to start now, got %s", stats.Session())
+	}
+}
+
+func TestEmoteStatsSaveOnChange(t *testing.T) {
+	stats := NewEmoteStats(false)
+	fileName := filepath.Join(t.TempDir(), "stats.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		stats.SaveOnChange(ctx, fileName, time.Millisecond)
+		close(done)
+	}()
+
+	stats.Record(Message{Platform: Twitch, Emotes: []MessageEmote{{ID: "kappa", Name: "Kappa"}}})
+	deadline := time.Now().Add(time.Second)
+	for {
+		loaded := NewEmoteStats(false)
+		if err := loaded.LoadFromFile(fileName); err == nil && loaded.Emotes["kappa"] != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the changed stats to be saved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// cancelling stops the loop
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected SaveOnChange to return")
+	}
+}
@@ -0,0 +1,101 @@
+package livechat
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	ThemeDark  = "dark"
+	ThemeLight = "light"
+)
+
+type EmoteVariant struct {
+	Scale     string `json:"scale"`
+	Theme     string `json:"theme"`
+	MimeType  string `json:"mimetype"`
+	FilePath  string `json:"filepath"`
+	SourceURL string `json:"source_url"`
+}
+
+// FilePaths returns every distinct file on disk used by the emote
+func (e *Emote) FilePaths() []string {
+	paths := []string{e.FilePath}
+	seen := map[string]bool{e.FilePath: true}
+	for _, variant := range e.Variants {
+		if !seen[variant.FilePath] {
+			seen[variant.FilePath] = true
+			paths = append(paths, variant.FilePath)
+		}
+	}
+	return paths
+}
+
+// Variant selects the file closest to the requested scale and theme. Scales
+// may be given as "2", "2.0" or "2x", an empty scale or theme means no
+// preference. Requests that cannot be matched exactly fall back to the
+// smallest larger scale, then the largest available, preferring the requested
+// theme over the scale. Emotes without variants always return the default.
+func (e *Emote) Variant(scale string, theme string) EmoteVariant {
+	selected := EmoteVariant{
+		MimeType:  e.MimeType,
+		FilePath:  e.FilePath,
+		SourceURL: e.SourceURL,
+	}
+	if len(e.Variants) == 0 || (scale == "" && theme == "") {
+		return selected
+	}
+
+	// only consider the requested theme if it is available
+	candidates := []EmoteVariant{}
+	for _, variant := range e.Variants {
+		if theme == "" || variant.Theme == theme {
+			candidates = append(candidates, variant)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = e.Variants
+	}
+
+	// no scale preference, use the largest
+	wanted, ok := parseEmoteScale(scale)
+	if !ok {
+		wanted = -1
+	}
+
+	// pick the closest scale, rounding up
+	best := -1
+	bestScale := 0.0
+	for i, variant := range candidates {
+		variantScale, _ := parseEmoteScale(variant.Scale)
+		if best == -1 {
+			best, bestScale = i, variantScale
+			continue
+		}
+		switch {
+		case wanted < 0 || (bestScale < wanted && variantScale > bestScale):
+			// nothing large enough yet, or no preference: bigger is better
+			if variantScale > bestScale {
+				best, bestScale = i, variantScale
+			}
+		case variantScale >= wanted && variantScale < bestScale:
+			// smaller but still large enough
+			best, bestScale = i, variantScale
+		}
+	}
+
+	return candidates[best]
+}
+
+// parseEmoteScale converts a scale like "2", "2.0" or "2x" into a number
+func parseEmoteScale(scale string) (float64, bool) {
+	scale = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(scale)), "x")
+	if scale == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(scale, 64)
+	if err != nil || value <= 0 {
+		return 0, false
+	}
+	return value, true
+}
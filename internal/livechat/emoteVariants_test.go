@@ -0,0 +1,42 @@
+package livechat
+
+import "testing"
+
+func TestEmoteVariant(t *testing.T) {
+	variants := []EmoteVariant{
+		{Scale: "1.0", Theme: ThemeDark, FilePath: "dark_1"},
+		{Scale: "2.0", Theme: ThemeDark, FilePath: "dark_2"},
+		{Scale: "3.0", Theme: ThemeDark, FilePath: "dark_3"},
+		{Scale: "1.0", Theme: ThemeLight, FilePath: "light_1"},
+	}
+	emote := Emote{ID: "1", Name: "Kappa", FilePath: "default", Variants: variants}
+
+	tests := []struct {
+		name  string
+		emote Emote
+		scale string
+		theme string
+		want  string
+	}{
+		{"exact", emote, "2.0", ThemeDark, "dark_2"},
+		{"scale suffix", emote, "2x", ThemeDark, "dark_2"},
+		{"integer scale", emote, "3", ThemeDark, "dark_3"},
+		{"rounds up", emote, "1.5", ThemeDark, "dark_2"},
+		{"too large uses largest", emote, "4", ThemeDark, "dark_3"},
+		{"no scale uses largest", emote, "", ThemeDark, "dark_3"},
+		{"invalid scale uses largest", emote, "huge", ThemeDark, "dark_3"},
+		{"theme preferred over scale", emote, "3.0", ThemeLight, "light_1"},
+		{"unknown theme falls back", emote, "2.0", "sepia", "dark_2"},
+		{"no theme considers all", emote, "1.0", "", "dark_1"},
+		{"no preference", emote, "", "", "default"},
+		{"no variants", Emote{ID: "2", FilePath: "default"}, "2.0", ThemeDark, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.emote.Variant(tt.scale, tt.theme)
+			if got.FilePath != tt.want {
+				t.Errorf("Variant(%q, %q) = %q, want %q", tt.scale, tt.theme, got.FilePath, tt.want)
+			}
+		})
+	}
+}
@@ -1,79 +1,227 @@
 package livechat
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	EmoteCacheDir   = "./emotecache"
+	EmoteIndexFile  = "./emotecache/index.json"
+	emoteSniffBytes = 512
+)
+
+// emoteHTTPClient downloads emote images, a stalled CDN must not block a sync
+var emoteHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// supported emote image types and the file extension used on disk
+var emoteMimeTypes = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
 type Emote struct {
-	ID       string   `json:"id"`
-	Name     string   `json:"name"`
-	Platform Platform `json:"platform"`
-	Segment  string   `json:"segment"`
-	MimeType string   `json:"mimetype"`
-	FilePath string   `json:"filepath"`
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Platform  Platform `json:"platform"`
+	Segment   string   `json:"segment"`
+	MimeType  string   `json:"mimetype"`
+	FilePath  string   `json:"filepath"`
+	SourceURL string   `json:"source_url"`
+	Animated  bool     `json:"animated"`
+
+	// ZeroWidth emotes (e.g. 7TV overlays) are drawn over the previous emote
+	ZeroWidth bool `json:"zero_width"`
+
+	// Access is used to avoid matching emotes the sender can't use
+	Access EmoteAccess `json:"access"`
+
+	// Variants holds every scale and theme the provider supplies, the
+	// top level file is the preferred variant.
+	Variants []EmoteVariant `json:"variants,omitempty"`
+}
+
+type EmoteFilter struct {
+	Platform Platform
+	Segment  string
+	Prefix   string
+	Animated *bool
 }
 
-type EmoteCache []Emote
+func (ef *EmoteFilter) Matches(emote *Emote) bool {
+	if ef.Platform != "" && emote.Platform != ef.Platform {
+		return false
+	}
+	if ef.Segment != "" && emote.Segment != ef.Segment {
+		return false
+	}
+	if ef.Prefix != "" && !strings.HasPrefix(strings.ToLower(emote.Name), strings.ToLower(ef.Prefix)) {
+		return false
+	}
+	if ef.Animated != nil && emote.Animated != *ef.Animated {
+		return false
+	}
+	return true
+}
+
+// EmoteCache is the index of cached emotes, it is safe for concurrent use.
+// Emotes are returned as copies so later changes don't affect them.
+type EmoteCache struct {
+	mu     sync.RWMutex
+	emotes []Emote
+}
+
+func NewEmoteCache(emotes ...Emote) *EmoteCache {
+	return &EmoteCache{emotes: emotes}
+}
+
+// All returns a copy of every emote
+func (ec *EmoteCache) All() []Emote {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return slices.Clone(ec.emotes)
+}
+
+func (ec *EmoteCache) Len() int {
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	return len(ec.emotes)
+}
 
 func (ec *EmoteCache) FindByName(name string, platform Platform) *Emote {
-	for i := range *ec {
-		emote := &(*ec)[i]
-		if platform == "" && emote.Name == name {
-			return emote
-		}
-		if platform == emote.Platform && emote.Name == name {
-			return emote
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	for _, emote := range ec.emotes {
+		if (platform == "" || platform == emote.Platform) && emote.Name == name {
+			return &emote
 		}
 	}
 	return nil
 }
 
+// Filter returns the emotes matching the filter, sorted by name
+func (ec *EmoteCache) Filter(filter EmoteFilter) []Emote {
+	ec.mu.RLock()
+	emotes := []Emote{}
+	for i := range ec.emotes {
+		if filter.Matches(&ec.emotes[i]) {
+			emotes = append(emotes, ec.emotes[i])
+		}
+	}
+	ec.mu.RUnlock()
+
+	sort.SliceStable(emotes, func(i, j int) bool {
+		return strings.ToLower(emotes[i].Name) < strings.ToLower(emotes[j].Name)
+	})
+	return emotes
+}
+
 func (ec *EmoteCache) FindByID(id string) *Emote {
-	for i := range *ec {
-		emote := &(*ec)[i]
+	ec.mu.RLock()
+	defer ec.mu.RUnlock()
+	for _, emote := range ec.emotes {
 		if emote.ID == id {
-			return emote
+			return &emote
 		}
 	}
 	return nil
 }
 
-func (ec *EmoteCache) Update(platform Platform, segment string, name string, filepath string, mimetype string) {
-	for i := range *ec {
-		emote := &(*ec)[i]
-		if emote.Platform == platform && emote.Name == name {
-			emote.FilePath = filepath
-			emote.MimeType = mimetype
+// CachedVariant returns the indexed file downloaded from sourceURL if it is
+// still on disk, syncs use it to skip images that were already downloaded
+func (ec *EmoteCache) CachedVariant(sourceURL string) (EmoteVariant, bool) {
+	ec.mu.RLock()
+	var cached *EmoteVariant
+	for _, emote := range ec.emotes {
+		for _, variant := range emote.Variants {
+			if variant.SourceURL == sourceURL {
+				cached = &variant
+				break
+			}
+		}
+		if cached == nil && emote.SourceURL == sourceURL {
+			cached = &EmoteVariant{MimeType: emote.MimeType, FilePath: emote.FilePath, SourceURL: emote.SourceURL}
+		}
+		if cached != nil {
+			break
+		}
+	}
+	ec.mu.RUnlock()
+
+	if cached == nil || cached.FilePath == "" {
+		return EmoteVariant{}, false
+	}
+	if _, err := os.Stat(cached.FilePath); err != nil {
+		return EmoteVariant{}, false
+	}
+	return *cached, true
+}
+
+// Update stores the file details of an emote, matching on platform and name.
+// A new ID is generated if the emote is not yet in the cache.
+func (ec *EmoteCache) Update(newEmote Emote) {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	for i := range ec.emotes {
+		emote := &ec.emotes[i]
+		if emote.Platform == newEmote.Platform && emote.Name == newEmote.Name {
+			newEmote.ID = emote.ID
+			*emote = newEmote
 			return
 		}
 	}
 	// If not found, add new emote
-	newEmote := Emote{
-		ID:       uuid.New().String(),
-		Name:     name,
-		Platform: platform,
-		Segment:  segment,
-		FilePath: filepath,
-		MimeType: mimetype,
-	}
-	*ec = append(*ec, newEmote)
+	newEmote.ID = uuid.New().String()
+	ec.emotes = append(ec.emotes, newEmote)
 }
 
 func (ec *EmoteCache) Delete(id string) error {
-	for idx, emote := range *ec {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	return ec.delete(id)
+}
+
+// delete removes an emote and its files, must be called with the lock held
+func (ec *EmoteCache) delete(id string) error {
+	for idx, emote := range ec.emotes {
 		if emote.ID == id {
-			// Remove the file associated with the emote
-			if err := os.Remove(emote.FilePath); err != nil {
-				return err // Return error if the file couldn't be deleted
+			// files reused by another emote, e.g. a renamed one, are kept
+			shared := map[string]bool{}
+			for _, other := range ec.emotes {
+				if other.ID != id {
+					for _, path := range other.FilePaths() {
+						shared[path] = true
+					}
+				}
+			}
+
+			// Remove the files associated with the emote, they may already be gone
+			for _, path := range emote.FilePaths() {
+				if shared[path] {
+					continue
+				}
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return err // Return error if the file couldn't be deleted
+				}
 			}
 
 			// Remove the emote from the cache
-			*ec = append((*ec)[:idx], (*ec)[idx+1:]...)
+			ec.emotes = slices.Delete(ec.emotes, idx, idx+1)
 
 			// Return after the emote is found and removed
 			return nil
@@ -92,7 +240,9 @@ func (ec *EmoteCache) SaveToFile(fileName string) error {
 	}
 
 	// convert data into JSON
-	content, err := json.Marshal(ec)
+	ec.mu.RLock()
+	content, err := json.Marshal(ec.emotes)
+	ec.mu.RUnlock()
 	if err != nil {
 		return fmt.Errorf("failed to marshal EmoteCache to JSON: %w", err)
 	}
@@ -118,9 +268,85 @@ func (ec *EmoteCache) LoadFromFile(fileName string) error {
 	}
 
 	// Unmarshal the JSON content into the EmoteCache struct
-	if err := json.Unmarshal(content, ec); err != nil {
+	var emotes []Emote
+	if err := json.Unmarshal(content, &emotes); err != nil {
 		return fmt.Errorf("failed to unmarshal JSON: %w", err)
 	}
+	ec.mu.Lock()
+	ec.emotes = emotes
+	ec.mu.Unlock()
 
 	return nil
 }
+
+// DownloadEmote fetches an emote image and writes it to basePath/fileName, using
+// the detected content type for the file extension. It returns the written path
+// and the content type.
+func DownloadEmote(imgURL string, basePath string, fileName string) (string, string, error) {
+	// ensure dir exists
+	if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
+		return "", "", err
+	}
+
+	// fetch image from CDN
+	res, err := emoteHTTPClient.Get(imgURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return "", "", fmt.Errorf("failed to fetch emote image (%d)", res.StatusCode)
+	}
+
+	// Read the first 512 bytes to detect the content type
+	buffer := make([]byte, emoteSniffBytes)
+	n, err := io.ReadFull(res.Body, buffer)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", "", err
+	}
+	buffer = buffer[:n]
+	contentType := http.DetectContentType(buffer)
+	ext, ok := emoteMimeTypes[contentType]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported content type: %s", contentType)
+	}
+
+	// write to a temp file first so a failed download doesn't leave a partial image
+	filename := fmt.Sprintf("%s/%s.%s", basePath, fileName, ext)
+	file, err := os.CreateTemp(basePath, fileName+".*.tmp")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(file.Name())
+
+	// write the sniffed bytes followed by the rest of the body
+	_, err = io.Copy(file, io.MultiReader(bytes.NewReader(buffer), res.Body))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.Rename(file.Name(), filename); err != nil {
+		return "", "", err
+	}
+
+	return filename, contentType, nil
+}
+
+// detectFileMimeType sniffs the content type of a file on disk
+func detectFileMimeType(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buffer := make([]byte, emoteSniffBytes)
+	n, err := io.ReadFull(file, buffer)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return http.DetectContentType(buffer[:n]), nil
+}
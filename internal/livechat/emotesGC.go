@@ -0,0 +1,195 @@
+package livechat
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+type EmoteCacheReport struct {
+	OrphansRemoved []string                      `json:"orphans_removed"`
+	Redownloaded   []string                      `json:"redownloaded"`
+	MimeCorrected  []string                      `json:"mime_corrected"`
+	Removed        []string                      `json:"removed"`
+	DiskUsage      map[Platform]map[string]int64 `json:"disk_usage"`
+	TotalBytes     int64                         `json:"total_bytes"`
+}
+
+// GC reconciles the index against the files in cacheDir. Missing or invalid
+// files are re-downloaded from their source URL (or dropped from the index if
+// that fails), files on disk that no emote references are removed, and the
+// disk usage per platform and segment is reported.
+func (ec *EmoteCache) GC(cacheDir string, indexFile string) (*EmoteCacheReport, error) {
+	report := &EmoteCacheReport{
+		OrphansRemoved: []string{},
+		Redownloaded:   []string{},
+		MimeCorrected:  []string{},
+		Removed:        []string{},
+		DiskUsage:      map[Platform]map[string]int64{},
+	}
+
+	// verify a copy, chat keeps matching emotes while files are re-downloaded
+	original := ec.All()
+	verified := map[string]Emote{}
+	for _, emote := range original {
+		if verifyEmote(&emote, report) {
+			verified[emote.ID] = emote
+		}
+	}
+
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	// apply the results unless a sync replaced the emote in the meantime
+	for _, before := range original {
+		idx := slices.IndexFunc(ec.emotes, func(emote Emote) bool { return emote.ID == before.ID })
+		if idx == -1 || ec.emotes[idx].FilePath != before.FilePath || ec.emotes[idx].SourceURL != before.SourceURL {
+			continue
+		}
+		if emote, ok := verified[before.ID]; ok {
+			ec.emotes[idx] = emote
+			continue
+		}
+
+		// could not be restored, drop it from the index
+		log.Warn().Str("id", before.ID).Str("name", before.Name).Msg("removing unrecoverable emote from cache")
+		report.Removed = append(report.Removed, before.ID)
+		if err := ec.delete(before.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// collect referenced files
+	referenced := map[string]bool{
+		filepath.Clean(indexFile): true,
+	}
+	for _, emote := range ec.emotes {
+		for _, path := range emote.FilePaths() {
+			referenced[filepath.Clean(path)] = true
+		}
+	}
+
+	// remove orphaned files
+	err := filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		// downloads in progress are written to .tmp files
+		if d.IsDir() || referenced[filepath.Clean(path)] || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		report.OrphansRemoved = append(report.OrphansRemoved, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// disk usage per platform and segment
+	for _, emote := range ec.emotes {
+		if report.DiskUsage[emote.Platform] == nil {
+			report.DiskUsage[emote.Platform] = map[string]int64{}
+		}
+		for _, path := range emote.FilePaths() {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			report.DiskUsage[emote.Platform][emote.Segment] += info.Size()
+			report.TotalBytes += info.Size()
+		}
+	}
+
+	return report, nil
+}
+
+// verifyEmote checks the files of an emote exist and have a supported type
+// matching the index, re-downloading them when needed. Variants that cannot be
+// restored are dropped, and false is returned when the default file could not
+// be restored.
+func verifyEmote(emote *Emote, report *EmoteCacheReport) bool {
+	variants := []EmoteVariant{}
+	defaultVerified := false
+	for _, variant := range emote.Variants {
+		original := variant.FilePath
+		if !verifyEmoteFile(emote.ID, &variant.FilePath, &variant.MimeType, variant.SourceURL, report) {
+			continue
+		}
+		variants = append(variants, variant)
+
+		// the default file is one of the variants, which may have been renamed
+		if original == emote.FilePath {
+			emote.FilePath = variant.FilePath
+			emote.MimeType = variant.MimeType
+			defaultVerified = true
+		}
+	}
+	if emote.Variants != nil {
+		emote.Variants = variants
+	}
+
+	if defaultVerified {
+		return true
+	}
+	return verifyEmoteFile(emote.ID, &emote.FilePath, &emote.MimeType, emote.SourceURL, report)
+}
+
+// renameToMimeType gives a file the extension of its content type, the name a
+// fresh download would get
+func renameToMimeType(filePath *string, mimeType string) bool {
+	renamed := strings.TrimSuffix(*filePath, filepath.Ext(*filePath)) + "." + emoteMimeTypes[mimeType]
+	if renamed == *filePath {
+		return true
+	}
+	if err := os.Rename(*filePath, renamed); err != nil {
+		log.Error().Err(err).Str("path", *filePath).Msg("failed to rename emote file")
+		return false
+	}
+	*filePath = renamed
+	return true
+}
+
+// verifyEmoteFile checks a single emote file, updating the path and MIME type
+// if it had to be corrected or re-downloaded
+func verifyEmoteFile(id string, filePath *string, mimeType *string, sourceURL string, report *EmoteCacheReport) bool {
+	detected, err := detectFileMimeType(*filePath)
+	if err == nil {
+		if _, ok := emoteMimeTypes[detected]; ok {
+			if detected != *mimeType {
+				*mimeType = detected
+				report.MimeCorrected = append(report.MimeCorrected, *filePath)
+			}
+			return renameToMimeType(filePath, detected)
+		}
+	}
+
+	// re-download from the source
+	if sourceURL == "" {
+		return false
+	}
+	if err := os.Remove(*filePath); err != nil && !os.IsNotExist(err) {
+		log.Error().Err(err).Str("path", *filePath).Msg("failed to remove invalid emote file")
+	}
+	dir := filepath.Dir(*filePath)
+	name := strings.TrimSuffix(filepath.Base(*filePath), filepath.Ext(*filePath))
+	path, detected, err := DownloadEmote(sourceURL, dir, name)
+	if err != nil {
+		log.Error().Err(err).Str("id", id).Msg("failed to re-download emote")
+		return false
+	}
+	*filePath = path
+	*mimeType = detected
+	report.Redownloaded = append(report.Redownloaded, path)
+
+	return true
+}
@@ -0,0 +1,104 @@
+package livechat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// a 1x1 PNG
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func TestEmoteCacheGC(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(testPNG)
+	}))
+	defer srv.Close()
+
+	valid := filepath.Join(dir, "valid.png")
+	if err := os.WriteFile(valid, testPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	orphan := filepath.Join(dir, "orphan.png")
+	if err := os.WriteFile(orphan, testPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	misnamed := filepath.Join(dir, "misnamed.gif")
+	if err := os.WriteFile(misnamed, testPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewEmoteCache(
+		Emote{ID: "valid", Name: "Valid", Platform: Twitch, FilePath: valid, MimeType: "image/gif"},
+		Emote{ID: "misnamed", Name: "Misnamed", Platform: Twitch, FilePath: misnamed, MimeType: "image/gif", Variants: []EmoteVariant{
+			{Scale: "1x", FilePath: misnamed, MimeType: "image/gif"},
+		}},
+		Emote{ID: "redownload", Name: "Redownload", Platform: Twitch, FilePath: filepath.Join(dir, "redownload.png"), SourceURL: srv.URL + "/redownload"},
+		Emote{ID: "gone", Name: "Gone", Platform: Twitch, FilePath: filepath.Join(dir, "gone.png"), SourceURL: srv.URL + "/missing"},
+	)
+
+	// chat keeps matching while the cache is collected
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				cache.MatchMessage("Valid Redownload Gone", []Platform{Twitch}, nil)
+			}
+		}
+	}()
+	report, err := cache.GC(dir, filepath.Join(dir, "index.json"))
+	close(done)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Redownloaded) != 1 || len(report.MimeCorrected) != 2 || len(report.OrphansRemoved) != 1 || len(report.Removed) != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if cache.Len() != 3 || cache.FindByID("gone") != nil || cache.FindByID("valid").MimeType != "image/png" {
+		t.Errorf("unexpected cache %+v", cache.All())
+	}
+	// corrected files get the extension of their content type
+	renamed := cache.FindByID("misnamed")
+	if renamed.FilePath != filepath.Join(dir, "misnamed.png") || renamed.Variants[0].FilePath != renamed.FilePath || renamed.MimeType != "image/png" {
+		t.Errorf("expected the misnamed emote to be renamed, got %+v", renamed)
+	}
+	if _, err := os.Stat(renamed.FilePath); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("expected the orphan to be removed")
+	}
+}
+
+func TestDownloadEmoteFailure(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the connection is dropped after the headers and part of the body
+		w.Header().Set("Content-Length", "1000")
+		w.Write(testPNG)
+	}))
+	defer srv.Close()
+
+	if _, _, err := DownloadEmote(srv.URL, dir, "partial"); err == nil {
+		t.Fatal("expected an error")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected no files to be left behind, got %v", entries)
+	}
+}
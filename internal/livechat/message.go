@@ -5,12 +5,13 @@ import (
 )
 
 type User struct {
-	ID            string `json:"id"`
-	Name          string `json:"name"`
-	Broadcaster   bool   `json:"broadcaster"`
-	Moderator     bool   `json:"moderator"`
-	TwitchVIP     bool   `json:"twitch_vip"`
-	YouTubeMember bool   `json:"youtube_member"`
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	Broadcaster      bool   `json:"broadcaster"`
+	Moderator        bool   `json:"moderator"`
+	TwitchVIP        bool   `json:"twitch_vip"`
+	TwitchSubscriber bool   `json:"twitch_subscriber"`
+	YouTubeMember    bool   `json:"youtube_member"`
 }
 
 type Message struct {
@@ -24,6 +25,16 @@ type Message struct {
 }
 
 type MessageEmote struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Modifier  string `json:"modifier,omitempty"`
+	ZeroWidth bool   `json:"zero_width"`
+
+	// byte offsets into the message body, End is exclusive
+	Start int `json:"start"`
+	End   int `json:"end"`
+
+	// rune offsets into the message body, RuneEnd is exclusive
+	RuneStart int `json:"rune_start"`
+	RuneEnd   int `json:"rune_end"`
 }
@@ -0,0 +1,235 @@
+package seventv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nullvt/stream-admin/internal/livechat"
+	"github.com/rs/zerolog/log"
+)
+
+// APIBaseURL is the 7TV API, overridable to point at a stand-in server
+var APIBaseURL = "https://7tv.io/v3"
+
+const (
+	globalSegment  = "__global"
+	requestTimeout = 15 * time.Second
+
+	// an emote is zero-width if either the set entry or the emote is flagged
+	activeEmoteFlagZeroWidth = 1 << 0
+	emoteFlagZeroWidth       = 1 << 8
+
+	// the preferred scale is served by default
+	preferredScale = "2x"
+)
+
+// files in other formats can't be served to every browser
+var fileFormats = map[string]bool{
+	"WEBP": true,
+	"GIF":  true,
+	"PNG":  true,
+}
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+type EmoteSet struct {
+	ID     string        `json:"id"`
+	Emotes []ActiveEmote `json:"emotes"`
+}
+
+type ActiveEmote struct {
+	ID    string    `json:"id"`
+	Name  string    `json:"name"`
+	Flags int       `json:"flags"`
+	Data  EmoteData `json:"data"`
+}
+
+type EmoteData struct {
+	Animated bool      `json:"animated"`
+	Flags    int       `json:"flags"`
+	Host     EmoteHost `json:"host"`
+}
+
+type EmoteHost struct {
+	URL   string      `json:"url"`
+	Files []EmoteFile `json:"files"`
+}
+
+type EmoteFile struct {
+	Name   string `json:"name"`
+	Format string `json:"format"`
+}
+
+type UserConnection struct {
+	EmoteSet *EmoteSet `json:"emote_set"`
+}
+
+// ZeroWidth reports whether the emote is drawn over the previous one
+func (ae *ActiveEmote) ZeroWidth() bool {
+	return ae.Flags&activeEmoteFlagZeroWidth != 0 || ae.Data.Flags&emoteFlagZeroWidth != 0
+}
+
+func get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, APIBaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return &APIError{StatusCode: res.StatusCode}
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// APIError is returned for non-200 7TV responses
+type APIError struct {
+	StatusCode int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("7tv responded %d", e.StatusCode)
+}
+
+func GetGlobalEmoteSet(ctx context.Context) (*EmoteSet, error) {
+	var set EmoteSet
+	if err := get(ctx, "/emote-sets/global", &set); err != nil {
+		return nil, fmt.Errorf("failed to get 7TV global emotes: %w", err)
+	}
+	return &set, nil
+}
+
+// GetChannelEmoteSet returns the active emote set of a Twitch channel, or nil
+// if the channel doesn't use 7TV
+func GetChannelEmoteSet(ctx context.Context, twitchID string) (*EmoteSet, error) {
+	var connection UserConnection
+	err := get(ctx, "/users/twitch/"+twitchID, &connection)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get 7TV channel emotes: %w", err)
+	}
+	return connection.EmoteSet, nil
+}
+
+func CacheEmotes(emoteCache *livechat.EmoteCache, set *EmoteSet, segment string) {
+	basePath := livechat.EmoteCacheDir + "/7tv"
+
+	for _, activeEmote := range set.Emotes {
+		emote := livechat.Emote{
+			Name:      activeEmote.Name,
+			Platform:  livechat.SevenTV,
+			Segment:   segment,
+			Animated:  activeEmote.Data.Animated,
+			ZeroWidth: activeEmote.ZeroWidth(),
+			Variants:  []livechat.EmoteVariant{},
+		}
+
+		// host URLs are protocol relative, e.g. "//cdn.7tv.app/emote/{id}"
+		hostURL := activeEmote.Data.Host.URL
+		if strings.HasPrefix(hostURL, "//") {
+			hostURL = "https:" + hostURL
+		}
+
+		// fetch every scale in the first supported format
+		format := ""
+		for _, file := range activeEmote.Data.Host.Files {
+			if !fileFormats[file.Format] || (format != "" && file.Format != format) {
+				continue
+			}
+			format = file.Format
+
+			scale, _, _ := strings.Cut(file.Name, ".")
+			imgURL := hostURL + "/" + file.Name
+			// files downloaded by an earlier sync are reused
+			variant, ok := emoteCache.CachedVariant(imgURL)
+			if !ok {
+				fileName := fmt.Sprintf("%s_%s", activeEmote.ID, scale)
+				filename, contentType, err := livechat.DownloadEmote(imgURL, basePath, fileName)
+				if err != nil {
+					log.Warn().Err(err).Str("emote", activeEmote.Name).Str("scale", scale).Msg("failed to download 7TV emote variant")
+					continue
+				}
+				variant = livechat.EmoteVariant{
+					MimeType:  contentType,
+					FilePath:  filename,
+					SourceURL: imgURL,
+				}
+			}
+			variant.Scale = scale
+			emote.Variants = append(emote.Variants, variant)
+		}
+		if len(emote.Variants) == 0 {
+			log.Error().Str("emote", activeEmote.Name).Msg("failed to download any 7TV emote variant")
+			continue
+		}
+
+		// the preferred scale is served by default
+		variant := emote.Variant(preferredScale, "")
+		emote.FilePath = variant.FilePath
+		emote.MimeType = variant.MimeType
+		emote.SourceURL = variant.SourceURL
+
+		emoteCache.Update(emote)
+	}
+}
+
+// SyncEmotes caches the 7TV global emotes and the emotes of every channel,
+// dropping emotes that were removed from the sets
+func SyncEmotes(ctx context.Context, emoteCache *livechat.EmoteCache, channelIDs []string) error {
+	global, err := GetGlobalEmoteSet(ctx)
+	if err != nil {
+		return err
+	}
+	sets := map[string]*EmoteSet{globalSegment: global}
+	for _, channelID := range channelIDs {
+		set, err := GetChannelEmoteSet(ctx, channelID)
+		if err != nil {
+			return err
+		}
+		if set != nil {
+			sets[channelID] = set
+		}
+	}
+
+	// channel emotes take precedence over global emotes with the same name
+	CacheEmotes(emoteCache, global, globalSegment)
+	for _, channelID := range channelIDs {
+		if set := sets[channelID]; set != nil {
+			CacheEmotes(emoteCache, set, channelID)
+		}
+	}
+
+	// remove emotes no longer in their set
+	for _, cachedEmote := range emoteCache.All() {
+		if cachedEmote.Platform != livechat.SevenTV {
+			continue
+		}
+		keep := false
+		if set := sets[cachedEmote.Segment]; set != nil {
+			for _, emote := range set.Emotes {
+				if emote.Name == cachedEmote.Name {
+					keep = true
+					break
+				}
+			}
+		}
+		if !keep {
+			if err := emoteCache.Delete(cachedEmote.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
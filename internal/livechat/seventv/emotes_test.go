@@ -0,0 +1,119 @@
+package seventv_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nullvt/stream-admin/internal/livechat"
+	"github.com/nullvt/stream-admin/internal/livechat/seventv"
+)
+
+// a 1x1 GIF
+var testGIF = []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x01\x00\x00;")
+
+func newEmote(host string, id string, name string, flags int, dataFlags int) seventv.ActiveEmote {
+	return seventv.ActiveEmote{
+		ID:    id,
+		Name:  name,
+		Flags: flags,
+		Data: seventv.EmoteData{
+			Flags: dataFlags,
+			Host: seventv.EmoteHost{
+				URL: host + "/emote/" + id,
+				Files: []seventv.EmoteFile{
+					{Name: "1x.avif", Format: "AVIF"},
+					{Name: "1x.gif", Format: "GIF"},
+					{Name: "2x.gif", Format: "GIF"},
+				},
+			},
+		},
+	}
+}
+
+func TestSyncEmotes(t *testing.T) {
+	sets := map[string]any{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/emote/") {
+			w.Write(testGIF)
+			return
+		}
+		body, ok := sets[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer srv.Close()
+	baseURL := seventv.APIBaseURL
+	seventv.APIBaseURL = srv.URL
+	t.Cleanup(func() { seventv.APIBaseURL = baseURL })
+
+	// emotes are downloaded relative to the working directory
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	sets["/emote-sets/global"] = seventv.EmoteSet{Emotes: []seventv.ActiveEmote{
+		newEmote(srv.URL, "g1", "EZ", 0, 0),
+		newEmote(srv.URL, "g2", "RainTime", 0, 256),
+	}}
+	sets["/users/twitch/1001"] = seventv.UserConnection{EmoteSet: &seventv.EmoteSet{Emotes: []seventv.ActiveEmote{
+		newEmote(srv.URL, "c1", "catJAM", 0, 0),
+		newEmote(srv.URL, "c2", "PETPET", 1, 0),
+	}}}
+
+	// channels without 7TV are skipped
+	emotes := &livechat.EmoteCache{}
+	if err := seventv.SyncEmotes(context.Background(), emotes, []string{"1001", "1002"}); err != nil {
+		t.Fatal(err)
+	}
+	if emotes.Len() != 4 {
+		t.Fatalf("expected 4 emotes, got %d", emotes.Len())
+	}
+	for name, zeroWidth := range map[string]bool{"EZ": false, "RainTime": true, "catJAM": false, "PETPET": true} {
+		emote := emotes.FindByName(name, livechat.SevenTV)
+		if emote == nil || emote.ZeroWidth != zeroWidth {
+			t.Errorf("expected %s to have zero width %v, got %+v", name, zeroWidth, emote)
+		}
+	}
+
+	// only one supported format is downloaded, 2x is served by default
+	jam := emotes.FindByName("catJAM", livechat.SevenTV)
+	if jam.Segment != "1001" || len(jam.Variants) != 2 || jam.MimeType != "image/gif" || !strings.HasSuffix(jam.SourceURL, "/2x.gif") {
+		t.Fatalf("unexpected channel emote %+v", jam)
+	}
+
+	// overlays are flagged where they appear in Twitch chat
+	matches := emotes.MatchMessage("catJAM PETPET", []livechat.Platform{livechat.Twitch, livechat.SevenTV}, nil)
+	if len(matches) != 2 || matches[0].ZeroWidth || !matches[1].ZeroWidth {
+		t.Fatalf("unexpected matches %+v", matches)
+	}
+
+	// removed emotes are dropped on the next sync
+	sets["/users/twitch/1001"] = seventv.UserConnection{EmoteSet: &seventv.EmoteSet{Emotes: []seventv.ActiveEmote{
+		newEmote(srv.URL, "c1", "catJAM", 0, 0),
+	}}}
+	if err := seventv.SyncEmotes(context.Background(), emotes, []string{"1001"}); err != nil {
+		t.Fatal(err)
+	}
+	if emotes.FindByName("PETPET", livechat.SevenTV) != nil {
+		t.Error("expected the removed emote to be dropped")
+	}
+	if err := seventv.SyncEmotes(context.Background(), emotes, nil); err != nil {
+		t.Fatal(err)
+	}
+	if emotes.Len() != 2 {
+		t.Errorf("expected only the global emotes, got %d", emotes.Len())
+	}
+}
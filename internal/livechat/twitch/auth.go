@@ -1,6 +1,7 @@
 package twitch
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -20,33 +21,40 @@ func (ac *AuthConfig) Bearer() string {
 	return "Bearer " + ac.AuthToken
 }
 
-// generate a login URL to request an Oauth token
-func OAuthLogin(clientId string, redirectURI string, scopes []string) (string, error) {
+// generate a login URL to request an Oauth token. The implicit flow
+// ("token") is used without a client secret, otherwise the authorization code
+// flow ("code") which also returns a refresh token.
+func OAuthLogin(clientId string, redirectURI string, scopes []string, responseType string, state string) (string, error) {
 	if clientId == "" {
 		return "", errors.New("invalid ClientID")
 	}
 
 	queryParams := url.Values{}
-	queryParams.Add("response_type", "token")
+	queryParams.Add("response_type", responseType)
 	queryParams.Add("client_id", clientId)
 	queryParams.Add("redirect_uri", redirectURI)
 	queryParams.Add("scope", strings.Join(scopes, " "))
-
-	baseURL := url.URL{
-		Scheme:   "https",
-		Host:     "id.twitch.tv",
-		Path:     "/oauth2/authorize",
-		RawQuery: queryParams.Encode(),
+	if state != "" {
+		queryParams.Add("state", state)
 	}
 
-	return baseURL.String(), nil
+	return OAuthBaseURL + "/authorize?" + queryParams.Encode(), nil
 }
 
-// parse the auth token from the callback URL
-func OAuthCallback(callbackURL string) (string, error) {
+type OAuthCallbackParams struct {
+	AccessToken string
+	Code        string
+	State       string
+
+	// Scopes are only returned by the implicit flow
+	Scopes []string
+}
+
+// parse the auth token or code from the callback URL
+func OAuthCallback(callbackURL string) (*OAuthCallbackParams, error) {
 	parsedURL, err := url.Parse(callbackURL)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// get the params from the query... or the fragment because Twitch is bloody weird.
@@ -57,48 +65,89 @@ func OAuthCallback(callbackURL string) (string, error) {
 
 	// parse the query params
 	if rawParams == "" {
-		return "", errors.New("oauth callback contains no parameters")
+		return nil, errors.New("oauth callback contains no parameters")
 	}
 	params, err := url.ParseQuery(rawParams)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// validate the params
-	if params.Has("status") {
-		return "", fmt.Errorf("OAuth call back error: %s", params.Get("error"))
+	if params.Has("error") {
+		return nil, fmt.Errorf("OAuth call back error: %s", params.Get("error_description"))
 	}
-	if !params.Has("access_token") {
-		return "", errors.New("OAuth call back did not contain an access_token")
+	if !params.Has("access_token") && !params.Has("code") {
+		return nil, errors.New("OAuth call back did not contain an access_token or code")
 	}
 
-	return params.Get("access_token"), nil
+	return &OAuthCallbackParams{
+		AccessToken: params.Get("access_token"),
+		Code:        params.Get("code"),
+		State:       params.Get("state"),
+		Scopes:      strings.Fields(params.Get("scope")),
+	}, nil
+}
+
+// TokenValidation is the response of the validate endpoint
+type TokenValidation struct {
+	Valid     bool     `json:"valid"`
+	ClientID  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	UserID    string   `json:"user_id"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+// HasScope checks if the token was granted a scope
+func (tv *TokenValidation) HasScope(scope string) bool {
+	for _, granted := range tv.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
 }
 
-func OAuthValidateToken(token string) (bool, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", "https://id.twitch.tv/oauth2/validate", nil)
+// OAuthValidateToken introspects a token. An invalid or expired token is not
+// an error, it is reported as not valid.
+func OAuthValidateToken(token string) (*TokenValidation, error) {
+	client := HTTPClient
+	req, err := http.NewRequest("GET", OAuthBaseURL+"/validate", nil)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
 	// validate token
 	req.Header.Set("Authorization", "Bearer "+token)
 	res, err := client.Do(req)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	defer res.Body.Close()
 
-	// token is valid
-	if res.StatusCode == 200 {
-		return true, nil
+	// token is invalid or has expired
+	if res.StatusCode == http.StatusUnauthorized {
+		return &TokenValidation{Valid: false, Scopes: []string{}}, nil
 	}
 
-	// invalid token
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return false, err
+	// unexpected response
+	if res.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to validate Twitch token (%d): %s", res.StatusCode, body)
 	}
-	return false, errors.New(string(body))
+
+	// token is valid
+	validation := &TokenValidation{}
+	if err := json.NewDecoder(res.Body).Decode(validation); err != nil {
+		return nil, err
+	}
+	validation.Valid = true
+	if validation.Scopes == nil {
+		validation.Scopes = []string{}
+	}
+
+	return validation, nil
 }
@@ -0,0 +1,153 @@
+package twitch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type ChannelInformation struct {
+	BroadcasterID       string   `json:"broadcaster_id"`
+	BroadcasterLogin    string   `json:"broadcaster_login"`
+	BroadcasterName     string   `json:"broadcaster_name"`
+	BroadcasterLanguage string   `json:"broadcaster_language"`
+	Title               string   `json:"title"`
+	GameName            string   `json:"game_name"`
+	GameID              string   `json:"game_id"`
+	Tags                []string `json:"tags"`
+
+	// Delay is in seconds, only partners can set it
+	Delay int `json:"delay"`
+
+	// ContentClassificationLabels are the IDs of the enabled labels
+	ContentClassificationLabels []string `json:"content_classification_labels"`
+	IsBrandedContent            bool     `json:"is_branded_content"`
+}
+
+type ModifyChannelInformationRequest struct {
+	GameID string   `json:"game_id"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+
+	// empty fields are left as they are, only the listed labels are changed
+	BroadcasterLanguage         string                       `json:"broadcaster_language,omitempty"`
+	Delay                       *int                         `json:"delay,omitempty"`
+	ContentClassificationLabels []ContentClassificationLabel `json:"content_classification_labels,omitempty"`
+	IsBrandedContent            *bool                        `json:"is_branded_content,omitempty"`
+}
+
+type ContentClassificationLabel struct {
+	ID        string `json:"id"`
+	IsEnabled bool   `json:"is_enabled"`
+}
+
+type Category struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	BoxArtUrl string `json:"box_art_url"`
+}
+
+// Stream is a live stream returned by the streams endpoint
+type Stream struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Type      string    `json:"type"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// GetStreamStatus tells whether a broadcaster is live right now, for when the
+// stream.online event was missed, e.g. after a restart
+func (c *Client) GetStreamStatus(ctx context.Context, broadcasterID string) (StreamStatus, error) {
+	reqQuery := url.Values{}
+	reqQuery.Add("user_id", broadcasterID)
+
+	var resBody struct {
+		Data []Stream `json:"data"`
+	}
+	if err := c.Get(ctx, "/streams", reqQuery, &resBody); err != nil {
+		return StreamStatus{}, fmt.Errorf("failed to get Twitch stream status: %w", err)
+	}
+
+	status := StreamStatus{BroadcasterID: broadcasterID}
+	for _, stream := range resBody.Data {
+		if stream.Type == "live" {
+			status.Online = true
+			status.StartedAt = stream.StartedAt
+		}
+	}
+	return status, nil
+}
+
+func (c *Client) GetChannelInformation(ctx context.Context, broadcasterID string) (*ChannelInformation, error) {
+	// set query
+	reqQuery := url.Values{}
+	reqQuery.Add("broadcaster_id", broadcasterID)
+
+	// send req
+	var resBody struct {
+		Data []ChannelInformation `json:"data"`
+	}
+	if err := c.Get(ctx, "/channels", reqQuery, &resBody); err != nil {
+		return nil, fmt.Errorf("failed to get Twitch channel information: %w", err)
+	}
+	if len(resBody.Data) != 1 {
+		return nil, errors.New("unexpected number of results for Twitch channel information")
+	}
+
+	return &resBody.Data[0], nil
+}
+
+func (c *Client) ModifyChannelInformation(ctx context.Context, broadcasterID string, update ModifyChannelInformationRequest) error {
+	// set query
+	reqQuery := url.Values{}
+	reqQuery.Add("broadcaster_id", broadcasterID)
+
+	// send req
+	if err := c.Patch(ctx, "/channels", reqQuery, update); err != nil {
+		return fmt.Errorf("failed to update Twitch channel information: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) SearchCategories(ctx context.Context, query string, first int) ([]Category, error) {
+	// set query
+	reqQuery := url.Values{}
+	reqQuery.Add("query", query)
+	reqQuery.Add("first", strconv.Itoa(first)) // WTF Twitch
+
+	// send req
+	var resBody struct {
+		Data []Category `json:"data"`
+	}
+	if err := c.Get(ctx, "/search/categories", reqQuery, &resBody); err != nil {
+		return nil, fmt.Errorf("failed to search Twitch categories: %w", err)
+	}
+
+	return resBody.Data, nil
+}
+
+// GetGames looks up categories by ID or exact name, unknown ones are left out
+func (c *Client) GetGames(ctx context.Context, ids []string, names []string) ([]Category, error) {
+	// set query
+	reqQuery := url.Values{}
+	for _, id := range ids {
+		reqQuery.Add("id", id)
+	}
+	for _, name := range names {
+		reqQuery.Add("name", name)
+	}
+
+	// send req
+	var resBody struct {
+		Data []Category `json:"data"`
+	}
+	if err := c.Get(ctx, "/games", reqQuery, &resBody); err != nil {
+		return nil, fmt.Errorf("failed to get Twitch games: %w", err)
+	}
+
+	return resBody.Data, nil
+}
@@ -0,0 +1,287 @@
+package twitch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Twitch endpoints, overridable to point at a stand-in server
+var (
+	HelixBaseURL = "https://api.twitch.tv/helix"
+	OAuthBaseURL = "https://id.twitch.tv/oauth2"
+	EventSubURL  = "wss://eventsub.wss.twitch.tv/ws"
+	GQLURL       = "https://gql.twitch.tv/gql"
+)
+
+// ConfigureURLs overrides the Twitch endpoints, empty values keep the default
+func ConfigureURLs(helix string, oauth string, eventSub string, gql string) {
+	for target, value := range map[*string]string{
+		&HelixBaseURL: helix,
+		&OAuthBaseURL: oauth,
+		&EventSubURL:  eventSub,
+		&GQLURL:       gql,
+	} {
+		if value != "" {
+			*target = strings.TrimSuffix(value, "/")
+		}
+	}
+}
+
+const (
+	// defaultRequestTimeout bounds a single Helix request including retries
+	defaultRequestTimeout = 15 * time.Second
+
+	// maxPageSize is the largest "first" value Helix accepts
+	maxPageSize = 100
+)
+
+// APIError is the error body returned by Helix
+type APIError struct {
+	StatusCode int    `json:"status"`
+	ErrorName  string `json:"error"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("twitch responded %d", e.StatusCode)
+	}
+	return fmt.Sprintf("twitch responded %d: %s", e.StatusCode, e.Message)
+}
+
+// IsStatus checks if err is a Helix error with the given status code
+func IsStatus(err error, statusCode int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+// Pagination is the cursor of paginated Helix responses
+type Pagination struct {
+	Cursor string `json:"cursor"`
+}
+
+// Client wraps the Helix API for one set of credentials
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Auth       AuthConfig
+	Timeout    time.Duration
+}
+
+// NewClient creates a Helix client using the shared HTTP client, so tokens
+// are refreshed transparently
+func NewClient(auth AuthConfig) *Client {
+	return &Client{
+		BaseURL:    HelixBaseURL,
+		HTTPClient: HTTPClient,
+		Auth:       auth,
+		Timeout:    defaultRequestTimeout,
+	}
+}
+
+// Get sends a GET request and decodes the response into out
+func (c *Client) Get(ctx context.Context, path string, query url.Values, out any) error {
+	return c.Do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+func (c *Client) Post(ctx context.Context, path string, query url.Values, body any, out any) error {
+	return c.Do(ctx, http.MethodPost, path, query, body, out)
+}
+
+func (c *Client) Patch(ctx context.Context, path string, query url.Values, body any) error {
+	return c.Do(ctx, http.MethodPatch, path, query, body, nil)
+}
+
+func (c *Client) Delete(ctx context.Context, path string, query url.Values) error {
+	return c.Do(ctx, http.MethodDelete, path, query, nil, nil)
+}
+
+// Do sends a Helix request, waiting for the rate limit to reset when it runs
+// out. Non 2xx responses are returned as an *APIError.
+func (c *Client) Do(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	// marshal the body once so it can be resent
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	reqURL := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+	limiter := rateLimiterFor(c.Auth)
+
+	for attempt := 0; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			return err
+		}
+
+		// create http req
+		req, err := http.NewRequestWithContext(ctx, method, reqURL, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Client-Id", c.Auth.ClientID)
+		req.Header.Set("Authorization", c.Auth.Bearer())
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		// send req
+		res, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return err
+		}
+		limiter.update(res.Header)
+
+		// retry once the bucket refills
+		if res.StatusCode == http.StatusTooManyRequests && attempt == 0 {
+			res.Body.Close()
+			continue
+		}
+
+		defer res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return decodeAPIError(res)
+		}
+		if out == nil || res.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		return json.NewDecoder(res.Body).Decode(out)
+	}
+}
+
+// decodeAPIError reads the JSON error body, falling back to the raw body
+func decodeAPIError(res *http.Response) error {
+	apiErr := &APIError{StatusCode: res.StatusCode}
+	body, err := io.ReadAll(res.Body)
+	if err != nil || len(body) == 0 {
+		return apiErr
+	}
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	apiErr.StatusCode = res.StatusCode
+
+	return apiErr
+}
+
+// Paginate follows the cursor of a paginated Helix endpoint until limit items
+// are collected, a limit of 0 fetches every page
+func Paginate[T any](ctx context.Context, c *Client, path string, query url.Values, limit int) ([]T, error) {
+	pageQuery := url.Values{}
+	for key, values := range query {
+		pageQuery[key] = values
+	}
+
+	items := []T{}
+	for {
+		pageSize := maxPageSize
+		if limit > 0 && limit-len(items) < pageSize {
+			pageSize = limit - len(items)
+		}
+		pageQuery.Set("first", strconv.Itoa(pageSize))
+
+		var page struct {
+			Data       []T        `json:"data"`
+			Pagination Pagination `json:"pagination"`
+		}
+		if err := c.Get(ctx, path, pageQuery, &page); err != nil {
+			return nil, err
+		}
+		items = append(items, page.Data...)
+
+		if page.Pagination.Cursor == "" || len(page.Data) == 0 || (limit > 0 && len(items) >= limit) {
+			return items, nil
+		}
+		pageQuery.Set("after", page.Pagination.Cursor)
+	}
+}
+
+// rateLimiter tracks the Helix token bucket from the Ratelimit headers
+type rateLimiter struct {
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+}
+
+// buckets are per client ID and user token
+var (
+	rateLimiters   = map[string]*rateLimiter{}
+	rateLimitersMu sync.Mutex
+)
+
+func rateLimiterFor(auth AuthConfig) *rateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	key := auth.ClientID + ":" + auth.UserID
+	limiter, ok := rateLimiters[key]
+	if !ok {
+		limiter = &rateLimiter{remaining: -1}
+		rateLimiters[key] = limiter
+	}
+	return limiter
+}
+
+// wait blocks until the bucket has points left or the context is done
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	rl.mu.Lock()
+	delay := time.Duration(0)
+	if rl.remaining == 0 {
+		delay = time.Until(rl.reset)
+	}
+	rl.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		rl.mu.Lock()
+		if time.Now().After(rl.reset) {
+			rl.remaining = -1
+		}
+		rl.mu.Unlock()
+		return nil
+	}
+}
+
+func (rl *rateLimiter) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("Ratelimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("Ratelimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	rl.mu.Lock()
+	rl.remaining = remaining
+	rl.reset = time.Unix(reset, 0)
+	rl.mu.Unlock()
+}
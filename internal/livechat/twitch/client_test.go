@@ -0,0 +1,248 @@
+package twitch_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch/twitchtest"
+)
+
+const (
+	broadcasterID    = "1001"
+	broadcasterToken = "broadcaster-token"
+)
+
+// newTwitch starts a stand-in Twitch with a broadcaster granted every scope
+func newTwitch(t *testing.T) (*twitchtest.Server, twitch.AuthConfig) {
+	t.Helper()
+	srv := twitchtest.NewServer(t)
+	srv.Use()
+	srv.AddUser(twitch.User{ID: broadcasterID, Login: "streamer", DisplayName: "Streamer"}, broadcasterToken,
+		"user:read:chat", "moderator:manage:chat_messages", "moderator:manage:banned_users", "moderation:read", "channel:manage:broadcast")
+
+	return srv, twitch.AuthConfig{
+		ClientID:      twitchtest.ClientID,
+		AuthToken:     broadcasterToken,
+		UserID:        broadcasterID,
+		BroadcasterID: broadcasterID,
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	srv, auth := newTwitch(t)
+	srv.Fail("GET /helix/users", 400, "Invalid login names")
+
+	_, err := twitch.NewClient(auth).GetUsers(context.Background(), []string{"streamer"})
+	var apiErr *twitch.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if apiErr.StatusCode != 400 || apiErr.Message != "Invalid login names" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+	if !twitch.IsStatus(err, 400) {
+		t.Error("IsStatus should match the status code")
+	}
+}
+
+func TestClientUnauthorized(t *testing.T) {
+	_, auth := newTwitch(t)
+	auth.AuthToken = "unknown-token"
+
+	_, err := twitch.NewClient(auth).GetUsers(context.Background(), nil)
+	if !twitch.IsStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("expected 401, got %v", err)
+	}
+}
+
+func TestClientRetriesRateLimit(t *testing.T) {
+	srv, auth := newTwitch(t)
+	srv.Fail("GET /helix/users", http.StatusTooManyRequests, "Too Many Requests")
+
+	users, err := twitch.NewClient(auth).GetUsers(context.Background(), []string{"streamer"})
+	if err != nil {
+		t.Fatalf("expected the request to be retried, got %v", err)
+	}
+	if len(users) != 1 || users[0].ID != broadcasterID {
+		t.Errorf("unexpected users %+v", users)
+	}
+	if requests := srv.Requests("GET /helix/users"); len(requests) != 2 {
+		t.Errorf("expected 2 requests, got %d", len(requests))
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	srv, auth := newTwitch(t)
+	client := twitch.NewClient(auth)
+	for _, userID := range []string{"1", "2", "3", "4", "5"} {
+		if err := client.BanUser(context.Background(), twitch.BanUserRequest{UserID: userID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type bannedUser struct {
+		UserID string `json:"user_id"`
+	}
+	query := url.Values{"broadcaster_id": {broadcasterID}}
+
+	// every page
+	banned, err := twitch.Paginate[bannedUser](context.Background(), client, "/moderation/banned", query, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(banned) != 5 || banned[4].UserID != "5" {
+		t.Errorf("unexpected bans %+v", banned)
+	}
+
+	// stop at the limit
+	banned, err = twitch.Paginate[bannedUser](context.Background(), client, "/moderation/banned", query, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(banned) != 2 {
+		t.Errorf("expected 2 bans, got %d", len(banned))
+	}
+	if requests := srv.Requests("GET /helix/moderation/banned"); requests[len(requests)-1].Query.Get("first") != "2" {
+		t.Errorf("expected the page size to be capped by the limit")
+	}
+}
+
+func TestGetStreamStatus(t *testing.T) {
+	srv, auth := newTwitch(t)
+	client := twitch.NewClient(auth)
+
+	status, err := client.GetStreamStatus(context.Background(), broadcasterID)
+	if err != nil || status.Online {
+		t.Fatalf("expected the stream to be offline, got %+v %v", status, err)
+	}
+
+	startedAt := time.Date(2024, 5, 15, 18, 0, 0, 0, time.UTC)
+	srv.SetLive(broadcasterID, startedAt)
+	status, err = client.GetStreamStatus(context.Background(), broadcasterID)
+	if err != nil || !status.Online || !status.StartedAt.Equal(startedAt) {
+		t.Errorf("expected the stream to be live, got %+v %v", status, err)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	srv, auth := newTwitch(t)
+	srv.AddRefreshToken("refresh-token", broadcasterToken)
+	store := &memoryTokenStore{token: twitch.Token{AccessToken: broadcasterToken, RefreshToken: "refresh-token"}}
+
+	transport := twitch.HTTPClient.Transport
+	t.Cleanup(func() { twitch.HTTPClient.Transport = transport })
+	twitch.ConfigureAuth(twitchtest.ClientID, map[string]twitch.TokenStore{"broadcaster": store}, nil)
+
+	// the rejected token is refreshed and the request retried
+	srv.RevokeToken(broadcasterToken)
+	users, err := twitch.NewClient(auth).GetUsers(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("expected the token to be refreshed, got %v", err)
+	}
+	if len(users) != 1 || users[0].ID != broadcasterID {
+		t.Errorf("unexpected users %+v", users)
+	}
+	if store.token.AccessToken == broadcasterToken || store.token.RefreshToken == "refresh-token" {
+		t.Errorf("the refreshed token wasn't saved: %+v", store.token)
+	}
+}
+
+func TestTokenRefreshConcurrent(t *testing.T) {
+	srv, auth := newTwitch(t)
+	srv.AddRefreshToken("refresh-token", broadcasterToken)
+	store := &memoryTokenStore{token: twitch.Token{AccessToken: broadcasterToken, RefreshToken: "refresh-token"}}
+
+	transport := twitch.HTTPClient.Transport
+	t.Cleanup(func() { twitch.HTTPClient.Transport = transport })
+	twitch.ConfigureAuth(twitchtest.ClientID, map[string]twitch.TokenStore{"broadcaster": store}, nil)
+
+	// requests rejected at the same time share one refresh
+	srv.RevokeToken(broadcasterToken)
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := twitch.NewClient(auth).GetUsers(context.Background(), nil); err != nil {
+				t.Errorf("expected the token to be refreshed, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshes := len(srv.Requests("POST /oauth2/token")); refreshes != 1 {
+		t.Errorf("expected 1 refresh, got %d", refreshes)
+	}
+
+	// only the token replaced last is still accepted
+	refreshed := store.token
+	srv.AddRefreshToken(refreshed.RefreshToken, refreshed.AccessToken)
+	srv.RevokeToken(refreshed.AccessToken)
+	if _, err := twitch.NewClient(auth).GetUsers(context.Background(), nil); err != nil {
+		t.Fatalf("expected the token to be refreshed again, got %v", err)
+	}
+	if _, err := twitch.NewClient(auth).GetUsers(context.Background(), nil); err == nil {
+		t.Error("expected the token replaced before the last refresh to be rejected")
+	}
+	auth.AuthToken = refreshed.AccessToken
+	if _, err := twitch.NewClient(auth).GetUsers(context.Background(), nil); err != nil {
+		t.Errorf("expected the token replaced last to be accepted, got %v", err)
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	srv, auth := newTwitch(t)
+	store := &memoryTokenStore{token: twitch.Token{AccessToken: broadcasterToken}}
+
+	transport := twitch.HTTPClient.Transport
+	t.Cleanup(func() { twitch.HTTPClient.Transport = transport })
+	twitch.ConfigureAuth(twitchtest.ClientID, map[string]twitch.TokenStore{"broadcaster": store}, nil)
+
+	// tokens are loaded once
+	client := twitch.NewClient(auth)
+	for range 3 {
+		if _, err := client.GetUsers(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.loads != 1 {
+		t.Errorf("expected the token to be loaded once, got %d", store.loads)
+	}
+
+	// saved tokens are picked up after invalidating
+	srv.AddRefreshToken("refresh-token", broadcasterToken)
+	store.token.RefreshToken = "refresh-token"
+	twitch.InvalidateTokens("broadcaster")
+	srv.RevokeToken(broadcasterToken)
+	if _, err := client.GetUsers(context.Background(), nil); err != nil {
+		t.Fatalf("expected the reloaded token to be refreshed, got %v", err)
+	}
+	if store.loads != 2 {
+		t.Errorf("expected the token to be reloaded, got %d loads", store.loads)
+	}
+}
+
+type memoryTokenStore struct {
+	mu    sync.Mutex
+	token twitch.Token
+	loads int
+}
+
+func (ms *memoryTokenStore) LoadToken() (twitch.Token, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.loads++
+	return ms.token, nil
+}
+func (ms *memoryTokenStore) SaveToken(token twitch.Token) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.token = token
+	return nil
+}
+func (ms *memoryTokenStore) ClientSecret() (string, error) { return "secret", nil }
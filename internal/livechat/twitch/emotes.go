@@ -1,16 +1,12 @@
 package twitch
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
 	"net/url"
-	"os"
-	"strings"
 
 	"github.com/nullvt/stream-admin/internal/livechat"
+	"github.com/rs/zerolog/log"
 )
 
 type EmotesResponse interface {
@@ -20,13 +16,16 @@ type EmotesResponse interface {
 }
 
 type Emote struct {
-	Segment   string
-	ID        string
-	Name      string
-	Images    EmoteImages
-	Format    []string
-	Scale     []string
-	ThemeMode []string
+	Segment    string
+	ID         string
+	Name       string
+	Images     EmoteImages
+	Tier       string
+	EmoteType  string
+	EmoteSetID string
+	Format     []string
+	Scale      []string
+	ThemeMode  []string
 }
 
 type EmoteImages struct {
@@ -66,12 +65,15 @@ func (cer *ChannelEmotesResponse) GetEmotes() *[]Emote {
 
 	for _, emoteData := range cer.Data {
 		emotes = append(emotes, Emote{
-			ID:        emoteData.ID,
-			Name:      emoteData.Name,
-			Images:    emoteData.Images,
-			Format:    emoteData.Format,
-			Scale:     emoteData.Scale,
-			ThemeMode: emoteData.ThemeMode,
+			ID:         emoteData.ID,
+			Name:       emoteData.Name,
+			Images:     emoteData.Images,
+			Tier:       emoteData.Tier,
+			EmoteType:  emoteData.EmoteType,
+			EmoteSetID: emoteData.EmoteSetID,
+			Format:     emoteData.Format,
+			Scale:      emoteData.Scale,
+			ThemeMode:  emoteData.ThemeMode,
 		})
 	}
 
@@ -108,6 +110,8 @@ func (ger *GlobalEmotesResponse) GetEmotes() *[]Emote {
 			ID:        emoteData.ID,
 			Name:      emoteData.Name,
 			Images:    emoteData.Images,
+			EmoteType: livechat.EmoteTypeGlobal,
+			Format:    emoteData.Format,
 			Scale:     emoteData.Scale,
 			ThemeMode: emoteData.ThemeMode,
 		})
@@ -116,147 +120,110 @@ func (ger *GlobalEmotesResponse) GetEmotes() *[]Emote {
 	return &emotes
 }
 
-func ListChannelEmotes(auth AuthConfig, channelID string) (*ChannelEmotesResponse, error) {
-	// set URL and query
-	reqURL, _ := url.Parse("https://api.twitch.tv/helix/chat/emotes")
-	reqQuery := reqURL.Query()
+func (c *Client) ListChannelEmotes(ctx context.Context, channelID string) (*ChannelEmotesResponse, error) {
+	// set query
+	reqQuery := url.Values{}
 	reqQuery.Add("broadcaster_id", channelID)
-	reqURL.RawQuery = reqQuery.Encode()
-
-	// create http req
-	req, err := http.NewRequest("GET", reqURL.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Client-Id", auth.ClientID)
-	req.Header.Set("Authorization", auth.Bearer())
-	req.Header.Set("Content-Type", "application/json")
 
 	// send req
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	// check response code
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to list Twitch channel emotes (%d)", res.StatusCode)
-	}
-
-	// parse the response
 	var resBody ChannelEmotesResponse
-	if err := json.NewDecoder(res.Body).Decode(&resBody); err != nil {
-		return nil, err
+	if err := c.Get(ctx, "/chat/emotes", reqQuery, &resBody); err != nil {
+		return nil, fmt.Errorf("failed to list Twitch channel emotes: %w", err)
 	}
 	resBody.Segment = channelID
 
 	return &resBody, nil
 }
 
-func ListGlobalEmotes(auth AuthConfig) (*GlobalEmotesResponse, error) {
-	// create http req
-	req, err := http.NewRequest("GET", "https://api.twitch.tv/helix/chat/emotes/global", nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Client-Id", auth.ClientID)
-	req.Header.Set("Authorization", auth.Bearer())
-	req.Header.Set("Content-Type", "application/json")
-
+func (c *Client) ListGlobalEmotes(ctx context.Context) (*GlobalEmotesResponse, error) {
 	// send req
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	// check response code
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to list Twitch global emotes (%d)", res.StatusCode)
-	}
-
-	// parse the response
 	var resBody GlobalEmotesResponse
-	if err := json.NewDecoder(res.Body).Decode(&resBody); err != nil {
-		return nil, err
+	if err := c.Get(ctx, "/chat/emotes/global", nil, &resBody); err != nil {
+		return nil, fmt.Errorf("failed to list Twitch global emotes: %w", err)
 	}
 
 	return &resBody, nil
 }
 
 func CacheEmotes(emoteCache *livechat.EmoteCache, emoteReq EmotesResponse) error {
-	basePath := "./emotecache/twitch"
-
-	// ensure dir exists
-	if _, err := os.Stat(basePath); os.IsNotExist(err) {
-		err := os.MkdirAll(basePath, os.ModePerm)
-		if err != nil {
-			return err
-		}
-	}
+	basePath := livechat.EmoteCacheDir + "/twitch"
 
 	// add new emote
 	for _, emoteData := range *emoteReq.GetEmotes() {
-		// get image URL "https://static-cdn.jtvnw.net/emoticons/v2/{{id}}/{{format}}/{{theme_mode}}/{{scale}}"
-		imgUrl := replaceMultiple(emoteReq.GetTemplate(), map[string]string{
-			"{{id}}":         emoteData.ID,
-			"{{format}}":     getPreferredFormat(emoteData.Format),
-			"{{theme_mode}}": getPreferredThemeMode(emoteData.ThemeMode), // TODO: support lightmode
-			"{{scale}}":      getPreferredScale(emoteData.Scale),
-		})
-
-		// fetch image from CDN
-		res, err := http.Get(imgUrl)
-		if err != nil {
-			return err
+		format := getPreferredFormat(emoteData.Format)
+		preferredTheme := getPreferredThemeMode(emoteData.ThemeMode)
+		preferredScale := getPreferredScale(emoteData.Scale)
+		emote := livechat.Emote{
+			Name:     emoteData.Name,
+			Platform: livechat.Twitch,
+			Segment:  emoteReq.GetSegment(),
+			Animated: format == "animated",
+			Access: livechat.EmoteAccess{
+				Tier:       emoteData.Tier,
+				EmoteType:  emoteData.EmoteType,
+				EmoteSetID: emoteData.EmoteSetID,
+			},
+			Variants: []livechat.EmoteVariant{},
 		}
-		defer res.Body.Close()
 
-		// Read the first 512 bytes to detect the content type
-		buffer := make([]byte, 512)
-		_, err = res.Body.Read(buffer)
-		if err != nil && err != io.EOF {
-			panic(err)
-		}
-		contentType := http.DetectContentType(buffer)
-		var ext string
-		switch contentType {
-		case "image/jpeg":
-			ext = "jpg"
-		case "image/png":
-			ext = "png"
-		case "image/gif":
-			ext = "gif"
-		default:
-			// TODO: proper error handling
-			panic("Unsupported content type: " + contentType)
+		// fetch every theme and scale the emote is available in
+		for _, theme := range orDefault(emoteData.ThemeMode, preferredTheme) {
+			for _, scale := range orDefault(emoteData.Scale, preferredScale) {
+				// get image URL "https://static-cdn.jtvnw.net/emoticons/v2/{{id}}/{{format}}/{{theme_mode}}/{{scale}}"
+				imgUrl := replaceMultiple(emoteReq.GetTemplate(), map[string]string{
+					"{{id}}":         emoteData.ID,
+					"{{format}}":     format,
+					"{{theme_mode}}": theme,
+					"{{scale}}":      scale,
+				})
+
+				// fetch image from CDN and write it to disk, unless an earlier sync did
+				variant, ok := emoteCache.CachedVariant(imgUrl)
+				if !ok {
+					fileName := fmt.Sprintf("%s_%s_%s", emoteData.ID, getScaleMultiplier(scale), theme)
+					filename, contentType, err := livechat.DownloadEmote(imgUrl, basePath, fileName)
+					if err != nil {
+						// a missing variant is replaced by the closest one when served
+						log.Warn().Err(err).Str("emote", emoteData.Name).Str("scale", scale).Str("theme", theme).Msg("failed to download emote variant")
+						continue
+					}
+					variant = livechat.EmoteVariant{
+						MimeType:  contentType,
+						FilePath:  filename,
+						SourceURL: imgUrl,
+					}
+				}
+				variant.Scale = getScaleMultiplier(scale)
+				variant.Theme = theme
+				emote.Variants = append(emote.Variants, variant)
+
+				// the preferred variant is served by default
+				if theme == preferredTheme && scale == preferredScale {
+					emote.FilePath = variant.FilePath
+					emote.MimeType = variant.MimeType
+					emote.SourceURL = variant.SourceURL
+				}
+			}
 		}
 
-		// write image to disk
-		filename := fmt.Sprintf("%s/%s.%s", basePath, emoteData.ID, ext)
-		file, err := os.Create(fmt.Sprintf("%s/%s.%s", basePath, emoteData.ID, ext))
-		if err != nil {
-			return err
+		// keep the cached files if nothing could be downloaded
+		if len(emote.Variants) == 0 {
+			log.Error().Str("emote", emoteData.Name).Msg("failed to download any emote variant")
+			continue
 		}
-		defer file.Close()
-
-		// Reset the response body reader and copy the image data to the file
-		res.Body = io.NopCloser(io.MultiReader(strings.NewReader(string(buffer)), res.Body))
-		_, err = io.Copy(file, res.Body)
-		if err != nil {
-			return err
+		if emote.FilePath == "" {
+			fallback := emote.Variant(getScaleMultiplier(preferredScale), preferredTheme)
+			emote.FilePath = fallback.FilePath
+			emote.MimeType = fallback.MimeType
+			emote.SourceURL = fallback.SourceURL
 		}
 
 		// add emote to map
-		emoteCache.Update(livechat.Twitch, emoteReq.GetSegment(), emoteData.Name, filename, contentType)
+		emoteCache.Update(emote)
 	}
 
 	// remove old emotes
-	for idx := 0; idx < len(*emoteCache); {
-		cachedEmote := (*emoteCache)[idx]
+	for _, cachedEmote := range emoteCache.All() {
 		keep := true
 
 		// Check if the cached emote matches the platform and segment in emoteReq
@@ -273,20 +240,19 @@ func CacheEmotes(emoteCache *livechat.EmoteCache, emoteReq EmotesResponse) error
 		// delete the emote
 		if !keep {
 			if err := emoteCache.Delete(cachedEmote.ID); err != nil {
-				fmt.Printf("Error removing emote: %v\n", err)
+				log.Error().Err(err).Str("emote", cachedEmote.Name).Msg("failed to remove emote")
 			}
-			continue
-		} else {
-			idx++
 		}
 	}
 
 	return nil
 }
 
-func SyncEmotes(emoteCache *livechat.EmoteCache, auth AuthConfig, channelIDs []string) error {
+func SyncEmotes(ctx context.Context, emoteCache *livechat.EmoteCache, auth AuthConfig, channelIDs []string) error {
+	client := NewClient(auth)
+
 	// sync global emotes
-	globalEmotes, err := ListGlobalEmotes(auth)
+	globalEmotes, err := client.ListGlobalEmotes(ctx)
 	if err != nil {
 		return err
 	}
@@ -296,7 +262,7 @@ func SyncEmotes(emoteCache *livechat.EmoteCache, auth AuthConfig, channelIDs []s
 
 	// sync channel emotes
 	for _, channelID := range channelIDs {
-		channelEmotes, err := ListChannelEmotes(auth, channelID)
+		channelEmotes, err := client.ListChannelEmotes(ctx, channelID)
 		if err != nil {
 			return err
 		}
@@ -305,39 +271,28 @@ func SyncEmotes(emoteCache *livechat.EmoteCache, auth AuthConfig, channelIDs []s
 		}
 	}
 
-	log.Print(channelIDs)
-
 	// remove channels
-	for idx := 0; idx < len(*emoteCache); {
-		cachedEmote := (*emoteCache)[idx]
-
+	for _, cachedEmote := range emoteCache.All() {
 		// Only operate on Twitch platform emotes
-		if cachedEmote.Platform == livechat.Twitch {
-			keep := false
+		if cachedEmote.Platform != livechat.Twitch {
+			continue
+		}
 
-			// Check if the emote belongs to the global segment
-			if cachedEmote.Segment == globalEmotes.GetSegment() {
+		// Check if the emote belongs to the global segment or any channelID
+		keep := cachedEmote.Segment == globalEmotes.GetSegment()
+		for _, channelID := range channelIDs {
+			if cachedEmote.Segment == channelID {
 				keep = true
+				break
 			}
+		}
 
-			// If not global, check if the segment matches any channelID
-			for _, channelID := range channelIDs {
-				if cachedEmote.Segment == channelID {
-					keep = true
-					break
-				}
-			}
-
-			// If the emote should not be kept then delete it
-			if !keep {
-				if err := emoteCache.Delete(cachedEmote.ID); err != nil {
-					return err
-				}
-				continue
+		// If the emote should not be kept then delete it
+		if !keep {
+			if err := emoteCache.Delete(cachedEmote.ID); err != nil {
+				return err
 			}
 		}
-
-		idx++
 	}
 
 	return nil
@@ -0,0 +1,160 @@
+package twitch_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nullvt/stream-admin/internal/livechat"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch/twitchtest"
+)
+
+func TestSyncEmotes(t *testing.T) {
+	srv, auth := newTwitch(t)
+
+	// emotes are downloaded relative to the working directory
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	srv.SetGlobalEmotes(twitch.GlobalEmoteData{
+		ID:        "25",
+		Name:      "Kappa",
+		Format:    []string{"static"},
+		Scale:     []string{"1.0", "2.0"},
+		ThemeMode: []string{"light", "dark"},
+	})
+	srv.SetChannelEmotes(broadcasterID,
+		twitch.ChannelEmoteData{ID: "100", Name: "streamerHi", Tier: "1000", EmoteType: "subscriptions", EmoteSetID: "1", Format: []string{"static"}, Scale: []string{"1.0"}, ThemeMode: []string{"dark"}},
+		twitch.ChannelEmoteData{ID: "101", Name: "streamerBye", Tier: "1000", EmoteType: "subscriptions", EmoteSetID: "1", Format: []string{"static"}, Scale: []string{"1.0"}, ThemeMode: []string{"dark"}},
+	)
+
+	emotes := &livechat.EmoteCache{}
+	if err := twitch.SyncEmotes(context.Background(), emotes, auth, []string{broadcasterID}); err != nil {
+		t.Fatal(err)
+	}
+	if emotes.Len() != 3 {
+		t.Fatalf("expected 3 emotes, got %d", emotes.Len())
+	}
+
+	// every variant is downloaded
+	kappa := emotes.FindByName("Kappa", livechat.Twitch)
+	if kappa == nil || kappa.Segment != "__global" || len(kappa.Variants) != 4 {
+		t.Fatalf("unexpected global emote %+v", kappa)
+	}
+	for _, variant := range kappa.Variants {
+		if variant.MimeType != "image/png" {
+			t.Errorf("unexpected mime type %s", variant.MimeType)
+		}
+		if _, err := os.Stat(variant.FilePath); err != nil {
+			t.Errorf("variant wasn't written: %v", err)
+		}
+	}
+	hi := emotes.FindByName("streamerHi", livechat.Twitch)
+	if hi == nil || hi.Segment != broadcasterID || hi.Access.EmoteType != "subscriptions" {
+		t.Fatalf("unexpected channel emote %+v", hi)
+	}
+
+	// removed emotes and channels are dropped on the next sync
+	srv.SetChannelEmotes(broadcasterID, twitch.ChannelEmoteData{ID: "100", Name: "streamerHi", Format: []string{"static"}, Scale: []string{"1.0"}, ThemeMode: []string{"dark"}})
+	if err := twitch.SyncEmotes(context.Background(), emotes, auth, []string{broadcasterID}); err != nil {
+		t.Fatal(err)
+	}
+	if emotes.FindByName("streamerBye", livechat.Twitch) != nil {
+		t.Error("expected the removed emote to be dropped")
+	}
+	if emotes.FindByName("streamerHi", livechat.Twitch).ID != hi.ID {
+		t.Error("expected kept emotes to keep their ID")
+	}
+
+	// cached files aren't downloaded again, also when an emote is renamed
+	downloads := len(emoticonRequests(srv))
+	srv.SetChannelEmotes(broadcasterID, twitch.ChannelEmoteData{ID: "100", Name: "streamerHello", Format: []string{"static"}, Scale: []string{"1.0"}, ThemeMode: []string{"dark"}})
+	if err := twitch.SyncEmotes(context.Background(), emotes, auth, []string{broadcasterID}); err != nil {
+		t.Fatal(err)
+	}
+	if requests := emoticonRequests(srv); len(requests) != downloads {
+		t.Errorf("expected no downloads, got %+v", requests[downloads:])
+	}
+	hello := emotes.FindByName("streamerHello", livechat.Twitch)
+	if hello == nil || emotes.FindByName("streamerHi", livechat.Twitch) != nil {
+		t.Fatal("expected the emote to be renamed")
+	}
+	if _, err := os.Stat(hello.FilePath); err != nil {
+		t.Errorf("expected the renamed emote to keep its file: %v", err)
+	}
+	if err := twitch.SyncEmotes(context.Background(), emotes, auth, nil); err != nil {
+		t.Fatal(err)
+	}
+	if emotes.Len() != 1 {
+		t.Errorf("expected only the global emote, got %d", emotes.Len())
+	}
+}
+
+// emoticonRequests lists the emote images fetched from the CDN
+func emoticonRequests(srv *twitchtest.Server) []twitchtest.Request {
+	requests := []twitchtest.Request{}
+	for _, req := range srv.Requests("") {
+		if strings.HasPrefix(req.Path, "/emoticons/") {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+func TestSyncEmotesVariantError(t *testing.T) {
+	srv, auth := newTwitch(t)
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+
+	srv.SetGlobalEmotes(
+		twitch.GlobalEmoteData{ID: "25", Name: "Kappa", Format: []string{"static"}, Scale: []string{"1.0", "2.0"}, ThemeMode: []string{"dark"}},
+		twitch.GlobalEmoteData{ID: "26", Name: "Keepo", Format: []string{"static"}, Scale: []string{"1.0"}, ThemeMode: []string{"dark"}},
+		twitch.GlobalEmoteData{ID: "27", Name: "PogChamp", Format: []string{"static"}, Scale: []string{"1.0"}, ThemeMode: []string{"dark"}},
+	)
+	srv.Fail("GET /emoticons/v2/25/static/dark/1.0", 500, "Internal Server Error")
+	srv.Fail("GET /emoticons/v2/26/static/dark/1.0", 500, "Internal Server Error")
+
+	// failed variants are skipped without aborting the sync
+	emotes := &livechat.EmoteCache{}
+	if err := twitch.SyncEmotes(context.Background(), emotes, auth, nil); err != nil {
+		t.Fatal(err)
+	}
+	kappa := emotes.FindByName("Kappa", livechat.Twitch)
+	if kappa == nil || len(kappa.Variants) != 1 || kappa.Variants[0].Scale != "2x" {
+		t.Fatalf("expected only the 2.0 variant, got %+v", kappa)
+	}
+	if kappa.FilePath != kappa.Variants[0].FilePath {
+		t.Errorf("expected the default to fall back to the downloaded variant, got %s", kappa.FilePath)
+	}
+	if emotes.FindByName("Keepo", livechat.Twitch) != nil {
+		t.Error("expected the emote without variants to be skipped")
+	}
+	if emotes.FindByName("PogChamp", livechat.Twitch) == nil {
+		t.Error("expected the remaining emotes to be synced")
+	}
+}
+
+func TestSyncEmotesError(t *testing.T) {
+	srv, auth := newTwitch(t)
+	srv.Fail("GET /helix/chat/emotes/global", 500, "Internal Server Error")
+
+	err := twitch.SyncEmotes(context.Background(), &livechat.EmoteCache{}, auth, nil)
+	if !twitch.IsStatus(err, 500) {
+		t.Fatalf("expected the Helix error, got %v", err)
+	}
+}
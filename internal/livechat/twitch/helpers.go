@@ -2,6 +2,13 @@ package twitch
 
 import "strings"
 
+// Twitch scales map to the 1x, 2x and 4x image sizes
+var scaleMultipliers = map[string]string{
+	"1.0": "1x",
+	"2.0": "2x",
+	"3.0": "4x",
+}
+
 func replaceMultiple(str string, replacements map[string]string) string {
 	for old, new := range replacements {
 		str = strings.ReplaceAll(str, old, new)
@@ -38,3 +45,18 @@ func getPreferredScale(scales []string) string {
 	}
 	return "1.0"
 }
+
+func getScaleMultiplier(scale string) string {
+	if multiplier, ok := scaleMultipliers[scale]; ok {
+		return multiplier
+	}
+	return scale
+}
+
+// orDefault returns the values, or just the fallback if there are none
+func orDefault(values []string, fallback string) []string {
+	if len(values) == 0 {
+		return []string{fallback}
+	}
+	return values
+}
@@ -2,7 +2,7 @@ package twitch
 
 import (
 	"context"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/nullvt/stream-admin/internal/livechat"
@@ -10,84 +10,169 @@ import (
 	"golang.org/x/net/websocket"
 )
 
-func matchEmotes(emoteCache *livechat.EmoteCache, message string) []livechat.MessageEmote {
-	emotes := []livechat.MessageEmote{}
-	for _, word := range strings.Split(message, " ") {
-		emote := emoteCache.FindByName(word, livechat.Twitch)
-		if emote != nil {
-			emotes = append(emotes, livechat.MessageEmote{
-				Name: word,
-				ID:   emote.ID,
-			})
-		}
+// chatEmotePlatforms are the emotes rendered in Twitch chat, native emotes
+// take precedence over 7TV emotes with the same name
+var chatEmotePlatforms = []livechat.Platform{livechat.Twitch, livechat.SevenTV}
+
+func matchEmotes(emoteCache *livechat.EmoteCache, message string, sender livechat.User, channelID string) []livechat.MessageEmote {
+	return emoteCache.MatchMessage(message, chatEmotePlatforms, func(emote *livechat.Emote) bool {
+		return emote.UsableBy(sender, channelID)
+	})
+}
+
+// eventSubConn is the current EventSub connection, replaced on reconnects
+type eventSubConn struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (ec *eventSubConn) swap(conn *websocket.Conn) *websocket.Conn {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	old := ec.conn
+	ec.conn = conn
+	return old
+}
+
+func (ec *eventSubConn) close() {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if ec.conn != nil {
+		ec.conn.Close()
 	}
-	return emotes
 }
 
-func StartListener(ctx context.Context, msgChan chan livechat.Message, authConfig AuthConfig, emotesCache *livechat.EmoteCache) <-chan livechat.Message {
+// StartListener reads chat into msgChan until ctx is done. When set,
+// onStreamStatus is called as the broadcaster goes live or offline.
+func StartListener(ctx context.Context, msgChan chan livechat.Message, authConfig AuthConfig, emotesCache *livechat.EmoteCache, onStreamStatus func(StreamStatus)) <-chan livechat.Message {
 	go func() {
 		defer close(msgChan)
 		var sessionID string
 		var subscriptions map[string]string = map[string]string{}
+		reconnecting := false
 
 		// connect to twitch
-		url := "wss://eventsub.wss.twitch.tv/ws"
-		conn, err := websocket.Dial(url, "", "http://localhost/")
+		conn, err := websocket.Dial(EventSubURL, "", "http://localhost/")
 		if err != nil {
 			log.Error().Err(err).Msg("failed to dial Twitch WebSocket")
 			return
 		}
-		defer conn.Close()
+		current := &eventSubConn{conn: conn}
+		defer current.close()
+
+		// unblock the receive when cancelled
+		go func() {
+			<-ctx.Done()
+			current.close()
+		}()
 
 		// handle message type
 		for {
-			select {
-			case <-ctx.Done():
-				return
-			default:
-				var message string
-				if err := websocket.Message.Receive(conn, &message); err != nil {
+			var message string
+			if err := websocket.Message.Receive(conn, &message); err != nil {
+				if ctx.Err() == nil {
 					log.Error().Err(err).Msg("error receiving TwitchWS message")
-					return
 				}
-				log.Debug().Any("websocket msg", message).Msg("Twitch WS Message received")
+				return
+			}
+			log.Debug().Any("websocket msg", message).Msg("Twitch WS Message received")
 
-				// parse the message
-				parsedMsg, err := parseTwitchWebsocketMessage([]byte(message))
-				if err != nil || parsedMsg == nil {
-					log.Error().Err(err).Msg("failed to parse TwitchWS message")
-					return
+			// parse the message
+			parsedMsg, err := parseTwitchWebsocketMessage([]byte(message))
+			if err != nil || parsedMsg == nil {
+				log.Error().Err(err).Msg("failed to parse TwitchWS message")
+				continue
+			}
+
+			// handle welcome message, subscriptions carry over to a reconnected session
+			if parsedMsg.SessionWelcome != nil {
+				sessionID = parsedMsg.SessionWelcome.Payload.Session.ID
+				if reconnecting {
+					reconnecting = false
+					continue
+				}
+				client := NewClient(authConfig)
+				chatSubType := "channel.chat.message"
+				subscriptionID, err := client.Subscribe(ctx, sessionID, chatSubType)
+				if err != nil {
+					log.Error().Err(err).Msg("failed to subscribe to chat messages")
 				}
+				subscriptions[chatSubType] = subscriptionID
 
-				// handle welcome message
-				if parsedMsg.SessionWelcome != nil {
-					sessionID = parsedMsg.SessionWelcome.Payload.Session.ID
-					chatSubType := "channel.chat.message"
-					subscriptionID, err := Subscribe(authConfig, sessionID, chatSubType)
-					if err != nil {
-						log.Error().Err(err).Msg("failed to subscribe to chat messages")
+				// stream status only needs the broadcaster
+				if onStreamStatus != nil {
+					for _, statusSubType := range []string{"stream.online", "stream.offline"} {
+						subscriptionID, err := client.SubscribeCondition(ctx, sessionID, statusSubType, SubscriptionRequestCondition{
+							BroadcasterUserID: authConfig.BroadcasterID,
+						})
+						if err != nil {
+							log.Error().Err(err).Str("type", statusSubType).Msg("failed to subscribe to stream status")
+						}
+						subscriptions[statusSubType] = subscriptionID
 					}
-					subscriptions[chatSubType] = subscriptionID
 				}
+			}
 
-				// handle chat message
-				if parsedMsg.Chat != nil {
-					msgChan <- livechat.Message{
-						Platform:    "twitch",
-						ID:          parsedMsg.Chat.Payload.Event.MessageID,
-						Body:        parsedMsg.Chat.Payload.Event.Message.Text,
-						Emotes:      matchEmotes(emotesCache, parsedMsg.Chat.Payload.Event.Message.Text),
-						ReceivedAt:  time.Now().UTC(),
-						PublishedAt: parsedMsg.Chat.Metadata.MessageTimestamp,
-						Sender: livechat.User{
-							ID:            parsedMsg.Chat.Payload.Event.ChatterUserID,
-							Name:          parsedMsg.Chat.Payload.Event.ChatterUserName,
-							Broadcaster:   parsedMsg.Chat.HasBadge("broadcaster"),
-							Moderator:     parsedMsg.Chat.HasBadge("moderator"),
-							TwitchVIP:     parsedMsg.Chat.HasBadge("vip"),
-							YouTubeMember: false,
-						},
-					}
+			// move to the new connection, which welcomes us without resubscribing
+			if parsedMsg.SessionReconnect != nil && parsedMsg.SessionReconnect.Payload.Session.ReconnectURL != nil {
+				newConn, err := websocket.Dial(*parsedMsg.SessionReconnect.Payload.Session.ReconnectURL, "", "http://localhost/")
+				if err != nil {
+					log.Error().Err(err).Msg("failed to reconnect to Twitch WebSocket")
+					return
+				}
+				current.swap(newConn).Close()
+				conn = newConn
+				reconnecting = true
+				log.Info().Str("session", sessionID).Msg("reconnected to Twitch WebSocket")
+			}
+
+			// a revoked subscription won't deliver events anymore
+			if parsedMsg.Revocation != nil {
+				subscription := parsedMsg.Revocation.Payload.Subscription
+				log.Warn().Str("type", subscription.Type).Str("status", subscription.Status).Msg("Twitch revoked an EventSub subscription")
+				if subscriptions[subscription.Type] == subscription.ID {
+					delete(subscriptions, subscription.Type)
+				}
+			}
+
+			// handle the stream going live or offline
+			if parsedMsg.StreamStatus != nil && onStreamStatus != nil {
+				event := parsedMsg.StreamStatus.Payload.Event
+				status := StreamStatus{
+					BroadcasterID: event.BroadcasterUserID,
+					Online:        parsedMsg.StreamStatus.Payload.Subscription.Type == "stream.online",
+				}
+				if event.StartedAt != nil {
+					status.StartedAt = *event.StartedAt
+				}
+				onStreamStatus(status)
+			}
+
+			// handle chat message
+			if parsedMsg.Chat != nil {
+				event := parsedMsg.Chat.Payload.Event
+				sender := livechat.User{
+					ID:               event.ChatterUserID,
+					Name:             event.ChatterUserName,
+					Broadcaster:      parsedMsg.Chat.HasBadge("broadcaster"),
+					Moderator:        parsedMsg.Chat.HasBadge("moderator"),
+					TwitchVIP:        parsedMsg.Chat.HasBadge("vip"),
+					TwitchSubscriber: parsedMsg.Chat.HasBadge("subscriber") || parsedMsg.Chat.HasBadge("founder"),
+					YouTubeMember:    false,
+				}
+				msg := livechat.Message{
+					Platform:    "twitch",
+					ID:          event.MessageID,
+					Body:        event.Message.Text,
+					Emotes:      matchEmotes(emotesCache, event.Message.Text, sender, event.BroadcasterUserID),
+					ReceivedAt:  time.Now().UTC(),
+					PublishedAt: parsedMsg.Chat.Metadata.MessageTimestamp,
+					Sender:      sender,
+				}
+				select {
+				case msgChan <- msg:
+				case <-ctx.Done():
+					return
 				}
 			}
 		}
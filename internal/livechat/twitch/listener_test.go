@@ -0,0 +1,185 @@
+package twitch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nullvt/stream-admin/internal/livechat"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/nullvt/stream-admin/internal/livechat/twitch/twitchtest"
+)
+
+const waitTimeout = 5 * time.Second
+
+func receive(t *testing.T, msgChan <-chan livechat.Message) livechat.Message {
+	t.Helper()
+	select {
+	case msg, ok := <-msgChan:
+		if !ok {
+			t.Fatal("message channel closed")
+		}
+		return msg
+	case <-time.After(waitTimeout):
+		t.Fatal("no chat message received")
+		return livechat.Message{}
+	}
+}
+
+// waitFor polls until cond holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListener(t *testing.T) {
+	srv, auth := newTwitch(t)
+	emotes := livechat.NewEmoteCache(livechat.Emote{ID: "kappa", Name: "Kappa", Platform: livechat.Twitch, Segment: "__global"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgChan := twitch.StartListener(ctx, make(chan livechat.Message), auth, emotes, nil)
+
+	// the welcome subscribes to chat
+	session := srv.NextSession(waitTimeout)
+	if err := session.SendWelcome(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the chat subscription", func() bool { return len(srv.Subscriptions()) == 1 })
+	subscription := srv.Subscriptions()[0]
+	if subscription.Type != "channel.chat.message" || subscription.Transport.SessionID != session.ID {
+		t.Errorf("unexpected subscription %+v", subscription)
+	}
+
+	// keepalives are ignored, notifications delivered
+	if err := session.SendKeepalive(); err != nil {
+		t.Fatal(err)
+	}
+	err := session.SendChatMessage(twitchtest.ChatEvent{
+		BroadcasterID: broadcasterID,
+		ChatterID:     "2002",
+		ChatterName:   "viewer",
+		MessageID:     "m1",
+		Text:          "hello Kappa",
+		Badges:        []string{"subscriber"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := receive(t, msgChan)
+	if msg.ID != "m1" || msg.Body != "hello Kappa" || msg.Sender.Name != "viewer" || !msg.Sender.TwitchSubscriber {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if len(msg.Emotes) != 1 || msg.Emotes[0].ID != "kappa" || msg.Emotes[0].Start != 6 {
+		t.Errorf("unexpected emotes %+v", msg.Emotes)
+	}
+
+	// reconnects move to a new session keeping the subscription
+	if err := session.SendReconnect(); err != nil {
+		t.Fatal(err)
+	}
+	reconnected := srv.NextSession(waitTimeout)
+	if err := reconnected.SendWelcome(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-session.Done():
+	case <-time.After(waitTimeout):
+		t.Fatal("the old connection wasn't closed")
+	}
+	reconnected.SendChatMessage(twitchtest.ChatEvent{BroadcasterID: broadcasterID, ChatterID: "2002", ChatterName: "viewer", MessageID: "m2", Text: "still here"})
+	if msg := receive(t, msgChan); msg.ID != "m2" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if subscriptions := srv.Subscriptions(); len(subscriptions) != 1 {
+		t.Errorf("expected no resubscription after reconnecting, got %d subscriptions", len(subscriptions))
+	}
+
+	// a revocation doesn't stop the listener
+	if err := reconnected.SendRevocation(subscription, "authorization_revoked"); err != nil {
+		t.Fatal(err)
+	}
+	reconnected.SendChatMessage(twitchtest.ChatEvent{BroadcasterID: broadcasterID, ChatterID: "2002", ChatterName: "viewer", MessageID: "m3", Text: "after revocation"})
+	if msg := receive(t, msgChan); msg.ID != "m3" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	// cancelling closes the connection and the channel
+	cancel()
+	select {
+	case <-reconnected.Done():
+	case <-time.After(waitTimeout):
+		t.Fatal("the connection wasn't closed")
+	}
+	select {
+	case _, ok := <-msgChan:
+		if ok {
+			t.Error("expected the channel to be closed")
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("the channel wasn't closed")
+	}
+}
+
+func TestListenerSubscribeFailure(t *testing.T) {
+	srv, auth := newTwitch(t)
+	srv.Fail("POST /helix/eventsub/subscriptions", 403, "subscription missing proper authorization")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgChan := twitch.StartListener(ctx, make(chan livechat.Message), auth, &livechat.EmoteCache{}, nil)
+
+	// the listener keeps running, still delivering what Twitch sends
+	session := srv.NextSession(waitTimeout)
+	session.SendWelcome()
+	session.SendChatMessage(twitchtest.ChatEvent{BroadcasterID: broadcasterID, ChatterID: "2002", ChatterName: "viewer", MessageID: "m1", Text: "hi"})
+	if msg := receive(t, msgChan); msg.ID != "m1" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if subscriptions := srv.Subscriptions(); len(subscriptions) != 0 {
+		t.Errorf("expected no subscription, got %+v", subscriptions)
+	}
+}
+
+func TestListenerStreamStatus(t *testing.T) {
+	srv, auth := newTwitch(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statuses := make(chan twitch.StreamStatus, 2)
+	twitch.StartListener(ctx, make(chan livechat.Message), auth, &livechat.EmoteCache{}, func(status twitch.StreamStatus) {
+		statuses <- status
+	})
+
+	session := srv.NextSession(waitTimeout)
+	session.SendWelcome()
+	waitFor(t, "the stream subscriptions", func() bool { return len(srv.Subscriptions()) == 3 })
+	for _, subscription := range srv.Subscriptions()[1:] {
+		if subscription.Condition.BroadcasterUserID != broadcasterID || subscription.Condition.UserID != "" {
+			t.Errorf("unexpected condition %+v", subscription.Condition)
+		}
+	}
+
+	startedAt := time.Now().UTC().Truncate(time.Second)
+	session.SendStreamOnline(broadcasterID, startedAt)
+	session.SendStreamOffline(broadcasterID)
+	for _, online := range []bool{true, false} {
+		select {
+		case status := <-statuses:
+			if status.Online != online || status.BroadcasterID != broadcasterID {
+				t.Errorf("unexpected status %+v", status)
+			}
+			if online && !status.StartedAt.Equal(startedAt) {
+				t.Errorf("expected the stream to start at %s, got %s", startedAt, status.StartedAt)
+			}
+		case <-time.After(waitTimeout):
+			t.Fatal("no stream status received")
+		}
+	}
+}
@@ -1,9 +1,9 @@
 package twitch
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"time"
 )
@@ -41,6 +41,22 @@ type KeepAliveMessage struct {
 	Payload  struct{} `json:"payload"`
 }
 
+// SessionReconnectMessage asks the client to move to a new connection.
+type SessionReconnectMessage struct {
+	Metadata Metadata `json:"metadata"`
+	Payload  struct {
+		Session Session `json:"session"`
+	} `json:"payload"`
+}
+
+// RevocationMessage tells the client a subscription was removed.
+type RevocationMessage struct {
+	Metadata Metadata `json:"metadata"`
+	Payload  struct {
+		Subscription Subscription `json:"subscription"`
+	} `json:"payload"`
+}
+
 // ChatMessage represents a chat message from the Twitch WebSocket.
 type ChatMessage struct {
 	Metadata Metadata `json:"metadata"`
@@ -79,6 +95,30 @@ type ChatMessage struct {
 	} `json:"payload"`
 }
 
+// StreamStatusMessage is a stream.online or stream.offline notification,
+// StartedAt is only set when going online.
+type StreamStatusMessage struct {
+	Metadata Metadata `json:"metadata"`
+	Payload  struct {
+		Subscription Subscription `json:"subscription"`
+		Event        struct {
+			ID                   string     `json:"id"`
+			BroadcasterUserID    string     `json:"broadcaster_user_id"`
+			BroadcasterUserLogin string     `json:"broadcaster_user_login"`
+			BroadcasterUserName  string     `json:"broadcaster_user_name"`
+			Type                 string     `json:"type"`
+			StartedAt            *time.Time `json:"started_at,omitempty"`
+		} `json:"event"`
+	} `json:"payload"`
+}
+
+// StreamStatus tells whether the broadcaster went live or offline
+type StreamStatus struct {
+	BroadcasterID string
+	Online        bool
+	StartedAt     time.Time
+}
+
 func (cm *ChatMessage) HasBadge(name string) bool {
 	for _, badge := range cm.Payload.Event.Badges {
 		if badge.SetID == name {
@@ -91,9 +131,12 @@ func (cm *ChatMessage) HasBadge(name string) bool {
 
 // TwitchWebsocketMessage represents a union of possible messages received from the Twitch WebSocket.
 type TwitchWebsocketMessage struct {
-	SessionWelcome *SessionWelcomeMessage
-	KeepAlive      *KeepAliveMessage
-	Chat           *ChatMessage
+	SessionWelcome   *SessionWelcomeMessage
+	SessionReconnect *SessionReconnectMessage
+	KeepAlive        *KeepAliveMessage
+	Revocation       *RevocationMessage
+	Chat             *ChatMessage
+	StreamStatus     *StreamStatusMessage
 }
 
 func parseTwitchWebsocketMessage(rawJSON []byte) (*TwitchWebsocketMessage, error) {
@@ -123,14 +166,39 @@ func parseTwitchWebsocketMessage(rawJSON []byte) (*TwitchWebsocketMessage, error
 		}
 		msg.KeepAlive = &keepAliveMsg
 
+	case "session_reconnect":
+		var reconnectMsg SessionReconnectMessage
+		if err := json.Unmarshal(rawJSON, &reconnectMsg); err != nil {
+			return nil, err
+		}
+		msg.SessionReconnect = &reconnectMsg
+
+	case "revocation":
+		var revocationMsg RevocationMessage
+		if err := json.Unmarshal(rawJSON, &revocationMsg); err != nil {
+			return nil, err
+		}
+		msg.Revocation = &revocationMsg
+
 	case "notification":
-		if base.Metadata.SubscriptionType != nil && *base.Metadata.SubscriptionType == "channel.chat.message" {
+		if base.Metadata.SubscriptionType == nil {
+			break
+		}
+		switch *base.Metadata.SubscriptionType {
+		case "channel.chat.message":
 			var chatMsg ChatMessage
 			if err := json.Unmarshal(rawJSON, &chatMsg); err != nil {
 				return nil, err
 			}
 			msg.Chat = &chatMsg
+		case "stream.online", "stream.offline":
+			var statusMsg StreamStatusMessage
+			if err := json.Unmarshal(rawJSON, &statusMsg); err != nil {
+				return nil, err
+			}
+			msg.StreamStatus = &statusMsg
 		}
+
 	default:
 		return nil, fmt.Errorf("unknown message type: %s", base.Metadata.MessageType)
 	}
@@ -138,35 +206,16 @@ func parseTwitchWebsocketMessage(rawJSON []byte) (*TwitchWebsocketMessage, error
 	return msg, nil
 }
 
-func DeleteMessage(auth AuthConfig, messageID string) error {
-	// set URL and query
-	reqURL, _ := url.Parse("https://api.twitch.tv/helix/moderation/chat")
-	reqQuery := reqURL.Query()
-	reqQuery.Add("broadcaster_id", auth.BroadcasterID)
-	reqQuery.Add("moderator_id", auth.UserID)
+func (c *Client) DeleteMessage(ctx context.Context, messageID string) error {
+	// set query
+	reqQuery := url.Values{}
+	reqQuery.Add("broadcaster_id", c.Auth.BroadcasterID)
+	reqQuery.Add("moderator_id", c.Auth.UserID)
 	reqQuery.Add("message_id", messageID)
-	reqURL.RawQuery = reqQuery.Encode()
-
-	// create http req
-	req, err := http.NewRequest("DELETE", reqURL.String(), nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Client-Id", auth.ClientID)
-	req.Header.Set("Authorization", auth.Bearer())
-	req.Header.Set("Content-Type", "application/json")
 
 	// send req
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer res.Body.Close()
-
-	// check response code
-	if res.StatusCode != 204 {
-		return fmt.Errorf("failed to delete Twitch chat message (%d)", res.StatusCode)
+	if err := c.Delete(ctx, "/moderation/chat", reqQuery); err != nil {
+		return fmt.Errorf("failed to delete Twitch chat message: %w", err)
 	}
 
 	return nil
@@ -0,0 +1,31 @@
+package twitch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+type BanUserRequest struct {
+	UserID   string  `json:"user_id"`
+	Duration *uint   `json:"duration,omitempty"`
+	Reason   *string `json:"reason,omitempty"`
+}
+
+// BanUser bans or, with a duration, times out a user in the broadcaster's chat
+func (c *Client) BanUser(ctx context.Context, ban BanUserRequest) error {
+	// set query
+	reqQuery := url.Values{}
+	reqQuery.Add("broadcaster_id", c.Auth.BroadcasterID)
+	reqQuery.Add("moderator_id", c.Auth.UserID)
+
+	// send req
+	body := struct {
+		Data BanUserRequest `json:"data"`
+	}{Data: ban}
+	if err := c.Post(ctx, "/moderation/bans", reqQuery, body, nil); err != nil {
+		return fmt.Errorf("failed to ban Twitch user: %w", err)
+	}
+
+	return nil
+}
@@ -1,11 +1,9 @@
 package twitch
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"net/http"
 )
 
 type SubscriptionRequest struct {
@@ -16,8 +14,8 @@ type SubscriptionRequest struct {
 }
 
 type SubscriptionRequestCondition struct {
-	UserID            string `json:"user_id"`
-	BroadcasterUserID string `json:"broadcaster_user_id"`
+	UserID            string `json:"user_id,omitempty"`
+	BroadcasterUserID string `json:"broadcaster_user_id,omitempty"`
 }
 
 type SubscriptionRequestTransport struct {
@@ -47,55 +45,35 @@ type EventSubSubscriptionsResponse struct {
 	Data []Subscription `json:"data"`
 }
 
-func Subscribe(authConfig AuthConfig, sessionID string, subType string) (string, error) {
-	// create and marshal request body
-	body, err := json.Marshal(SubscriptionRequest{
-		Type:    subType,
-		Version: "1",
-		Condition: SubscriptionRequestCondition{
-			UserID:            authConfig.UserID,
-			BroadcasterUserID: authConfig.BroadcasterID,
-		},
+// Subscribe subscribes to chat events of the broadcaster read as the user
+func (c *Client) Subscribe(ctx context.Context, sessionID string, subType string) (string, error) {
+	return c.SubscribeCondition(ctx, sessionID, subType, SubscriptionRequestCondition{
+		UserID:            c.Auth.UserID,
+		BroadcasterUserID: c.Auth.BroadcasterID,
+	})
+}
+
+// SubscribeCondition subscribes to an event type, stream events only take the
+// broadcaster as a condition
+func (c *Client) SubscribeCondition(ctx context.Context, sessionID string, subType string, condition SubscriptionRequestCondition) (string, error) {
+	// send req
+	var resBody EventSubSubscriptionsResponse
+	err := c.Post(ctx, "/eventsub/subscriptions", nil, SubscriptionRequest{
+		Type:      subType,
+		Version:   "1",
+		Condition: condition,
 		Transport: SubscriptionRequestTransport{
 			Method:    "websocket",
 			SessionID: sessionID,
 		},
-	})
-	if err != nil {
-		return "", err
-	}
-
-	// create http req
-	req, err := http.NewRequest("POST", "https://api.twitch.tv/helix/eventsub/subscriptions", bytes.NewBuffer(body))
+	}, &resBody)
 	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Authorization", authConfig.Bearer())
-	req.Header.Set("Client-Id", authConfig.ClientID)
-	req.Header.Set("Content-Type", "application/json")
-
-	// send req
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer res.Body.Close()
-
-	// check response code
-	if res.StatusCode != 202 {
-		return "", fmt.Errorf("failed to subscribe to chat events (%d)", res.StatusCode)
-	}
-
-	// parse the response
-	var resBody EventSubSubscriptionsResponse
-	if err := json.NewDecoder(res.Body).Decode(&resBody); err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to subscribe to %s events: %w", subType, err)
 	}
 
 	// find correct subscription and return the ID
 	for _, sub := range resBody.Data {
-		if sub.Transport.Method == "websocket" && sub.Transport.SessionID == sessionID && sub.Condition.UserID == authConfig.UserID && sub.Condition.BroadcasterUserID == authConfig.BroadcasterID {
+		if sub.Type == subType && sub.Transport.Method == "websocket" && sub.Transport.SessionID == sessionID && sub.Condition.UserID == condition.UserID && sub.Condition.BroadcasterUserID == condition.BroadcasterUserID {
 			return sub.ID, nil
 		}
 	}
@@ -0,0 +1,320 @@
+package twitch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokens are refreshed this long before they expire
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	Scopes       []string
+}
+
+// Expiring reports whether the token should be refreshed before use
+func (t *Token) Expiring() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().Add(tokenRefreshMargin).After(t.ExpiresAt)
+}
+
+// TokenStore persists the tokens used by the shared HTTP client
+type TokenStore interface {
+	LoadToken() (Token, error)
+	SaveToken(token Token) error
+	ClientSecret() (string, error)
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int      `json:"expires_in"`
+	Scope        []string `json:"scope"`
+	TokenType    string   `json:"token_type"`
+}
+
+// requestToken posts to the OAuth token endpoint
+func requestToken(form url.Values) (Token, error) {
+	res, err := HTTPClient.PostForm(OAuthBaseURL+"/token", form)
+	if err != nil {
+		return Token{}, err
+	}
+	defer res.Body.Close()
+
+	// check response code
+	if res.StatusCode != 200 {
+		body, _ := io.ReadAll(res.Body)
+		return Token{}, fmt.Errorf("failed to get Twitch OAuth token (%d): %s", res.StatusCode, string(body))
+	}
+
+	// parse the response
+	var resBody oauthTokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&resBody); err != nil {
+		return Token{}, err
+	}
+
+	token := Token{
+		AccessToken:  resBody.AccessToken,
+		RefreshToken: resBody.RefreshToken,
+		Scopes:       resBody.Scope,
+	}
+	if resBody.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(resBody.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+// ExchangeCode swaps an authorization code for an access and refresh token
+func ExchangeCode(clientID string, clientSecret string, code string, redirectURI string) (Token, error) {
+	return requestToken(url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+		"redirect_uri":  {redirectURI},
+	})
+}
+
+// RefreshToken gets a new access token using a refresh token
+func RefreshToken(clientID string, clientSecret string, refreshToken string) (Token, error) {
+	return requestToken(url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+// AuthTransport adds the current access token to Helix requests, refreshing
+// it before it expires or when Twitch rejects it. The identity of a request is
+// found by matching its bearer token against each store. Tokens are cached
+// until they are invalidated, loading them may be slow depending on the
+// secrets backend.
+type AuthTransport struct {
+	Base            http.RoundTripper
+	ClientID        string
+	Stores          map[string]TokenStore
+	OnRefreshFailed func(identity string, err error)
+
+	// mu guards the refreshes in progress and the access token each identity
+	// had before its last refresh, requests built before the refresh still use
+	// it. Older tokens aren't kept, clients get the current token when created.
+	mu         sync.Mutex
+	replaced   map[string]string
+	refreshing map[string]*tokenRefresh
+
+	tokensMu sync.Mutex
+	tokens   map[string]Token
+}
+
+// tokenRefresh is a refresh in progress, concurrent requests of the same
+// identity wait for it instead of refreshing again
+type tokenRefresh struct {
+	done  chan struct{}
+	token Token
+	err   error
+}
+
+// HTTPClient is shared by every Twitch API call
+var HTTPClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// ConfigureAuth enables transparent token refreshing on HTTPClient
+func ConfigureAuth(clientID string, stores map[string]TokenStore, onRefreshFailed func(identity string, err error)) {
+	HTTPClient.Transport = &AuthTransport{
+		Base:            http.DefaultTransport,
+		ClientID:        clientID,
+		Stores:          stores,
+		OnRefreshFailed: onRefreshFailed,
+		replaced:        map[string]string{},
+		refreshing:      map[string]*tokenRefresh{},
+		tokens:          map[string]Token{},
+	}
+}
+
+// InvalidateTokens drops the cached token of an identity from HTTPClient,
+// it has to be called whenever a token is saved outside of the transport
+func InvalidateTokens(identity string) {
+	if transport, ok := HTTPClient.Transport.(*AuthTransport); ok {
+		transport.Invalidate(identity)
+	}
+}
+
+// Invalidate drops the cached token of an identity
+func (t *AuthTransport) Invalidate(identity string) {
+	t.tokensMu.Lock()
+	defer t.tokensMu.Unlock()
+	delete(t.tokens, identity)
+}
+
+// loadToken returns the cached token of an identity, loading it on first use
+func (t *AuthTransport) loadToken(identity string) (Token, error) {
+	t.tokensMu.Lock()
+	defer t.tokensMu.Unlock()
+	if token, ok := t.tokens[identity]; ok {
+		return token, nil
+	}
+	token, err := t.Stores[identity].LoadToken()
+	if err != nil {
+		return Token{}, err
+	}
+	t.tokens[identity] = token
+	return token, nil
+}
+
+// saveToken persists a refreshed token and updates the cache. The store may
+// invalidate the cache itself so the lock isn't held while saving.
+func (t *AuthTransport) saveToken(identity string, token Token) error {
+	if err := t.Stores[identity].SaveToken(token); err != nil {
+		t.Invalidate(identity)
+		return err
+	}
+	t.tokensMu.Lock()
+	defer t.tokensMu.Unlock()
+	t.tokens[identity] = token
+	return nil
+}
+
+// findIdentity returns the identity a bearer token belongs to
+func (t *AuthTransport) findIdentity(accessToken string) (string, Token, bool) {
+	for identity := range t.Stores {
+		token, err := t.loadToken(identity)
+		if err != nil || token.AccessToken == "" {
+			continue
+		}
+		t.mu.Lock()
+		replaced := t.replaced[identity]
+		t.mu.Unlock()
+		if token.AccessToken == accessToken || replaced == accessToken {
+			return identity, token, true
+		}
+	}
+	return "", Token{}, false
+}
+
+func (t *AuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// only Helix requests use our tokens
+	bearer, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !isHelixRequest(req) || !ok {
+		return t.Base.RoundTrip(req)
+	}
+	identity, token, ok := t.findIdentity(bearer)
+	if !ok {
+		return t.Base.RoundTrip(req)
+	}
+
+	// refresh before expiry
+	var err error
+	if token.Expiring() && token.RefreshToken != "" {
+		if token, err = t.refresh(identity, token.AccessToken); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := t.Base.RoundTrip(withToken(req, token.AccessToken))
+	if err != nil || res.StatusCode != http.StatusUnauthorized || token.RefreshToken == "" {
+		return res, err
+	}
+
+	// the token was rejected, refresh and retry once
+	if req.Body != nil && req.GetBody == nil {
+		return res, nil
+	}
+	res.Body.Close()
+	if token, err = t.refresh(identity, token.AccessToken); err != nil {
+		return nil, err
+	}
+	retry := withToken(req, token.AccessToken)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.Base.RoundTrip(retry)
+}
+
+// refresh replaces the token of an identity, unless another request already
+// refreshed it. The lock isn't held while Twitch is asked, requests of other
+// identities carry on.
+func (t *AuthTransport) refresh(identity string, staleAccessToken string) (Token, error) {
+	t.mu.Lock()
+	call, inProgress := t.refreshing[identity]
+	if !inProgress {
+		call = &tokenRefresh{done: make(chan struct{})}
+		t.refreshing[identity] = call
+	}
+	t.mu.Unlock()
+	if inProgress {
+		<-call.done
+		return call.token, call.err
+	}
+
+	call.token, call.err = t.refreshStale(identity, staleAccessToken)
+	t.mu.Lock()
+	delete(t.refreshing, identity)
+	if call.err == nil && call.token.AccessToken != staleAccessToken {
+		t.replaced[identity] = staleAccessToken
+	}
+	t.mu.Unlock()
+	close(call.done)
+
+	return call.token, call.err
+}
+
+// refreshStale refreshes the token of an identity if it is still the stale one
+func (t *AuthTransport) refreshStale(identity string, staleAccessToken string) (Token, error) {
+	store := t.Stores[identity]
+	token, err := t.loadToken(identity)
+	if err != nil {
+		return Token{}, err
+	}
+	if token.AccessToken != staleAccessToken {
+		return token, nil
+	}
+
+	clientSecret, err := store.ClientSecret()
+	if err == nil && clientSecret == "" {
+		err = errors.New("no client secret configured")
+	}
+	if err == nil {
+		token, err = RefreshToken(t.ClientID, clientSecret, token.RefreshToken)
+	}
+	if err == nil {
+		err = t.saveToken(identity, token)
+	}
+	if err != nil {
+		if t.OnRefreshFailed != nil {
+			t.OnRefreshFailed(identity, err)
+		}
+		return Token{}, fmt.Errorf("failed to refresh Twitch token: %w", err)
+	}
+
+	return token, nil
+}
+
+// isHelixRequest checks if a request is sent to the Helix API
+func isHelixRequest(req *http.Request) bool {
+	helixURL, err := url.Parse(HelixBaseURL)
+	return err == nil && req.URL.Host == helixURL.Host
+}
+
+// withToken clones a request with a different access token
+func withToken(req *http.Request, accessToken string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+accessToken)
+	return clone
+}
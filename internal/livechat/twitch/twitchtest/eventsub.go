@@ -0,0 +1,164 @@
+package twitchtest
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"golang.org/x/net/websocket"
+)
+
+// Session is one EventSub websocket connection, the test decides which
+// messages it receives
+type Session struct {
+	ID string
+
+	server *Server
+	conn   *websocket.Conn
+	mu     sync.Mutex
+	done   chan struct{}
+}
+
+// ChatEvent is the part of a channel.chat.message event tests care about
+type ChatEvent struct {
+	BroadcasterID string
+	ChatterID     string
+	ChatterName   string
+	MessageID     string
+	Text          string
+	Badges        []string
+}
+
+// handleEventSub serves a websocket until the client or the test closes it
+func (s *Server) handleEventSub(conn *websocket.Conn) {
+	s.mu.Lock()
+	session := &Session{
+		ID:     "session-" + s.newID(),
+		server: s,
+		conn:   conn,
+		done:   make(chan struct{}),
+	}
+	s.liveSessions[session.ID] = session
+	s.mu.Unlock()
+
+	s.sessions <- session
+
+	// clients never send anything, reading only detects the disconnect
+	for {
+		var message string
+		if err := websocket.Message.Receive(conn, &message); err != nil {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.liveSessions, session.ID)
+	s.mu.Unlock()
+	close(session.done)
+}
+
+// Done is closed once the connection is gone
+func (ss *Session) Done() <-chan struct{} {
+	return ss.done
+}
+
+func (ss *Session) Close() {
+	ss.conn.Close()
+}
+
+func (ss *Session) send(messageType string, subscriptionType string, payload any) error {
+	metadata := twitch.Metadata{
+		MessageID:        "msg-" + ss.server.nextMessageID(),
+		MessageType:      messageType,
+		MessageTimestamp: time.Now().UTC(),
+	}
+	if subscriptionType != "" {
+		version := "1"
+		metadata.SubscriptionType = &subscriptionType
+		metadata.SubscriptionVersion = &version
+	}
+	raw, err := json.Marshal(map[string]any{"metadata": metadata, "payload": payload})
+	if err != nil {
+		return err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return websocket.Message.Send(ss.conn, string(raw))
+}
+
+func (ss *Session) session(status string, reconnectURL *string) twitch.Session {
+	return twitch.Session{
+		ID:                      ss.ID,
+		Status:                  status,
+		ConnectedAt:             time.Now().UTC().Format(time.RFC3339Nano),
+		KeepaliveTimeoutSeconds: 10,
+		ReconnectURL:            reconnectURL,
+	}
+}
+
+func (ss *Session) SendWelcome() error {
+	return ss.send("session_welcome", "", map[string]any{"session": ss.session("connected", nil)})
+}
+
+func (ss *Session) SendKeepalive() error {
+	return ss.send("session_keepalive", "", map[string]any{})
+}
+
+// SendReconnect asks the client to move to a new connection on this server
+func (ss *Session) SendReconnect() error {
+	reconnectURL := ss.server.EventSubURL()
+	return ss.send("session_reconnect", "", map[string]any{"session": ss.session("reconnecting", &reconnectURL)})
+}
+
+// SendRevocation tells the client a subscription was removed
+func (ss *Session) SendRevocation(subscription twitch.Subscription, status string) error {
+	subscription.Status = status
+	return ss.send("revocation", subscription.Type, map[string]any{"subscription": subscription})
+}
+
+// SendNotification sends an arbitrary event for a subscription type
+func (ss *Session) SendNotification(subscriptionType string, event any) error {
+	subscription := twitch.Subscription{Type: subscriptionType, Version: "1", Status: "enabled"}
+	subscription.Transport.Method = "websocket"
+	subscription.Transport.SessionID = ss.ID
+	return ss.send("notification", subscriptionType, map[string]any{"subscription": subscription, "event": event})
+}
+
+func (ss *Session) SendChatMessage(chat ChatEvent) error {
+	badges := []map[string]string{}
+	for _, badge := range chat.Badges {
+		badges = append(badges, map[string]string{"set_id": badge, "id": "1", "info": ""})
+	}
+
+	return ss.SendNotification("channel.chat.message", map[string]any{
+		"broadcaster_user_id": chat.BroadcasterID,
+		"chatter_user_id":     chat.ChatterID,
+		"chatter_user_login":  chat.ChatterName,
+		"chatter_user_name":   chat.ChatterName,
+		"message_id":          chat.MessageID,
+		"message": map[string]any{
+			"text":      chat.Text,
+			"fragments": []map[string]any{{"type": "text", "text": chat.Text}},
+		},
+		"badges":       badges,
+		"message_type": "text",
+	})
+}
+
+// SendStreamOnline tells the client the broadcaster went live
+func (ss *Session) SendStreamOnline(broadcasterID string, startedAt time.Time) error {
+	return ss.SendNotification("stream.online", map[string]any{
+		"id":                  "stream-" + ss.server.nextMessageID(),
+		"broadcaster_user_id": broadcasterID,
+		"type":                "live",
+		"started_at":          startedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (ss *Session) SendStreamOffline(broadcasterID string) error {
+	return ss.SendNotification("stream.offline", map[string]any{
+		"broadcaster_user_id": broadcasterID,
+	})
+}
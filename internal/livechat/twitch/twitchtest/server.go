@@ -0,0 +1,758 @@
+// Package twitchtest provides a local stand-in for Twitch to run integration
+// tests offline. It serves the Helix endpoints used by stream-admin, the OAuth
+// validate and token endpoints, GQL chat settings, emote images and an
+// EventSub websocket whose messages are scripted by the test.
+package twitchtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"golang.org/x/net/websocket"
+)
+
+const ClientID = "twitchtest-client-id"
+
+// Token is an access token known to the server
+type Token struct {
+	UserID string
+	Login  string
+	Scopes []string
+}
+
+// Ban is a ban received by the moderation endpoint
+type Ban struct {
+	BroadcasterID string
+	ModeratorID   string
+	twitch.BanUserRequest
+}
+
+// DeletedMessage is a chat message removed by the moderation endpoint
+type DeletedMessage struct {
+	BroadcasterID string
+	ModeratorID   string
+	MessageID     string
+}
+
+// Request is a request received by the server
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   []byte
+}
+
+type failure struct {
+	status  int
+	message string
+}
+
+// Server is a fake Twitch, every method is safe to call from tests while
+// requests are being served
+type Server struct {
+	*httptest.Server
+	t testing.TB
+
+	mu              sync.Mutex
+	tokens          map[string]Token
+	refreshTokens   map[string]Token
+	users           []twitch.User
+	channels        map[string]twitch.ChannelInformation
+	streams         map[string]twitch.Stream
+	categories      []twitch.Category
+	globalEmotes    []twitch.GlobalEmoteData
+	channelEmotes   map[string][]twitch.ChannelEmoteData
+	subscriptions   []twitch.Subscription
+	bans            []Ban
+	deletedMessages []DeletedMessage
+	chatSettings    map[string]bool
+	failures        map[string][]failure
+	requests        []Request
+	liveSessions    map[string]*Session
+	nextID          int
+
+	sessions chan *Session
+}
+
+// NewServer starts a fake Twitch which is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		t:             t,
+		tokens:        map[string]Token{},
+		refreshTokens: map[string]Token{},
+		channels:      map[string]twitch.ChannelInformation{},
+		streams:       map[string]twitch.Stream{},
+		channelEmotes: map[string][]twitch.ChannelEmoteData{},
+		chatSettings:  map[string]bool{},
+		failures:      map[string][]failure{},
+		liveSessions:  map[string]*Session{},
+		sessions:      make(chan *Session, 16),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /helix/users", s.handleUsers)
+	mux.HandleFunc("POST /helix/eventsub/subscriptions", s.handleSubscribe)
+	mux.HandleFunc("GET /helix/chat/emotes", s.handleChannelEmotes)
+	mux.HandleFunc("GET /helix/chat/emotes/global", s.handleGlobalEmotes)
+	mux.HandleFunc("DELETE /helix/moderation/chat", s.handleDeleteMessage)
+	mux.HandleFunc("POST /helix/moderation/bans", s.handleBan)
+	mux.HandleFunc("GET /helix/moderation/banned", s.handleBanned)
+	mux.HandleFunc("GET /helix/channels", s.handleGetChannel)
+	mux.HandleFunc("PATCH /helix/channels", s.handleModifyChannel)
+	mux.HandleFunc("GET /helix/streams", s.handleStreams)
+	mux.HandleFunc("GET /helix/search/categories", s.handleSearchCategories)
+	mux.HandleFunc("GET /helix/games", s.handleGames)
+	mux.HandleFunc("GET /oauth2/validate", s.handleValidate)
+	mux.HandleFunc("POST /oauth2/token", s.handleToken)
+	mux.HandleFunc("POST /gql", s.handleGQL)
+	mux.HandleFunc("GET /emoticons/v2/", s.handleEmoteImage)
+	mux.Handle("GET /ws", websocket.Handler(s.handleEventSub))
+
+	s.Server = httptest.NewServer(s.record(mux))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *Server) HelixURL() string    { return s.URL + "/helix" }
+func (s *Server) OAuthURL() string    { return s.URL + "/oauth2" }
+func (s *Server) GQLURL() string      { return s.URL + "/gql" }
+func (s *Server) EventSubURL() string { return "ws" + strings.TrimPrefix(s.URL, "http") + "/ws" }
+
+// Use points the twitch package at the server until the test ends
+func (s *Server) Use() {
+	helix, oauth, eventSub, gql := twitch.HelixBaseURL, twitch.OAuthBaseURL, twitch.EventSubURL, twitch.GQLURL
+	twitch.ConfigureURLs(s.HelixURL(), s.OAuthURL(), s.EventSubURL(), s.GQLURL())
+	s.t.Cleanup(func() {
+		twitch.HelixBaseURL, twitch.OAuthBaseURL, twitch.EventSubURL, twitch.GQLURL = helix, oauth, eventSub, gql
+	})
+}
+
+// AddUser registers a user and an access token owned by them
+func (s *Server) AddUser(user twitch.User, accessToken string, scopes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = append(s.users, user)
+	if accessToken != "" {
+		s.tokens[accessToken] = Token{UserID: user.ID, Login: user.Login, Scopes: scopes}
+	}
+}
+
+// AddRefreshToken issues a refresh token for the owner of an access token,
+// it keeps working after the access token is revoked
+func (s *Server) AddRefreshToken(refreshToken string, accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens[refreshToken] = s.tokens[accessToken]
+}
+
+// RevokeToken makes an access token invalid
+func (s *Server) RevokeToken(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, accessToken)
+}
+
+func (s *Server) SetChannel(info twitch.ChannelInformation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels[info.BroadcasterID] = info
+}
+
+// SetLive makes a broadcaster live since startedAt, or offline if it is zero
+func (s *Server) SetLive(broadcasterID string, startedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if startedAt.IsZero() {
+		delete(s.streams, broadcasterID)
+		return
+	}
+	s.nextID++
+	s.streams[broadcasterID] = twitch.Stream{ID: strconv.Itoa(s.nextID), UserID: broadcasterID, Type: "live", StartedAt: startedAt}
+}
+
+func (s *Server) Channel(broadcasterID string) twitch.ChannelInformation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channels[broadcasterID]
+}
+
+func (s *Server) AddCategory(category twitch.Category) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.categories = append(s.categories, category)
+}
+
+func (s *Server) SetGlobalEmotes(emotes ...twitch.GlobalEmoteData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.globalEmotes = emotes
+}
+
+func (s *Server) SetChannelEmotes(broadcasterID string, emotes ...twitch.ChannelEmoteData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channelEmotes[broadcasterID] = emotes
+}
+
+// Fail makes the next request to an endpoint, e.g. "PATCH /helix/channels",
+// fail with a Helix error body
+func (s *Server) Fail(endpoint string, status int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], failure{status: status, message: message})
+}
+
+func (s *Server) Subscriptions() []twitch.Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.subscriptions)
+}
+
+func (s *Server) Bans() []Ban {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.bans)
+}
+
+func (s *Server) DeletedMessages() []DeletedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.deletedMessages)
+}
+
+// HideLinks returns the link filtering state set through GQL
+func (s *Server) HideLinks(broadcasterID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.chatSettings[broadcasterID]
+}
+
+// Requests returns every request received, optionally only for one endpoint
+func (s *Server) Requests(endpoint string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := []Request{}
+	for _, req := range s.requests {
+		if endpoint == "" || req.Method+" "+req.Path == endpoint {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// NextSession waits for a client to connect to the EventSub websocket
+func (s *Server) NextSession(timeout time.Duration) *Session {
+	s.t.Helper()
+	select {
+	case session := <-s.sessions:
+		return session
+	case <-time.After(timeout):
+		s.t.Fatalf("no EventSub connection within %s", timeout)
+		return nil
+	}
+}
+
+// record logs requests and serves scripted failures
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Body: body})
+		endpoint := r.Method + " " + r.URL.Path
+		var fail *failure
+		if pending := s.failures[endpoint]; len(pending) > 0 {
+			fail = &pending[0]
+			s.failures[endpoint] = pending[1:]
+		}
+		s.mu.Unlock()
+
+		// Helix reports the token bucket on every response
+		w.Header().Set("Ratelimit-Limit", "800")
+		w.Header().Set("Ratelimit-Remaining", "799")
+		w.Header().Set("Ratelimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+		if fail != nil {
+			if fail.status == http.StatusTooManyRequests {
+				w.Header().Set("Ratelimit-Remaining", "0")
+				w.Header().Set("Ratelimit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+			}
+			writeError(w, fail.status, fail.message)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, twitch.APIError{
+		StatusCode: status,
+		ErrorName:  http.StatusText(status),
+		Message:    message,
+	})
+}
+
+// authorize checks the bearer token and that it was granted the scope
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, scope string) (Token, bool) {
+	accessToken, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	token, ok := s.tokens[accessToken]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid OAuth token")
+		return Token{}, false
+	}
+	if r.Header.Get("Client-Id") == "" {
+		writeError(w, http.StatusUnauthorized, "Client ID is missing")
+		return Token{}, false
+	}
+	if scope != "" && !slices.Contains(token.Scopes, scope) {
+		writeError(w, http.StatusUnauthorized, "Missing scope: "+scope)
+		return Token{}, false
+	}
+	return token, true
+}
+
+// newID must be called with the lock held
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("%d", s.nextID)
+}
+
+func (s *Server) nextMessageID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.newID()
+}
+
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.authorize(w, r, "")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	logins := r.URL.Query()["login"]
+	ids := r.URL.Query()["id"]
+	users := []twitch.User{}
+	for _, user := range s.users {
+		if (len(logins) == 0 && len(ids) == 0 && user.ID == token.UserID) || slices.Contains(logins, user.Login) || slices.Contains(ids, user.ID) {
+			users = append(users, user)
+		}
+	}
+	writeJSON(w, 200, twitch.UsersResponse{Data: users})
+}
+
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.authorize(w, r, "")
+	if !ok {
+		return
+	}
+	var body twitch.SubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, 400, "invalid body")
+		return
+	}
+
+	// chat is read as a user, stream events need no authorization
+	if body.Type == "channel.chat.message" {
+		s.mu.Lock()
+		scopes := s.tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")].Scopes
+		s.mu.Unlock()
+		if !slices.Contains(scopes, "user:read:chat") {
+			writeError(w, 403, "subscription missing proper authorization")
+			return
+		}
+		if body.Condition.UserID != token.UserID {
+			writeError(w, 403, "user_id must match the token")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.liveSessions[body.Transport.SessionID]; !ok {
+		writeError(w, 400, "websocket transport session does not exist or has already disconnected")
+		return
+	}
+	subscription := twitch.Subscription{
+		ID:        "sub-" + s.newID(),
+		Status:    "enabled",
+		Type:      body.Type,
+		Version:   body.Version,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	subscription.Condition.UserID = body.Condition.UserID
+	subscription.Condition.BroadcasterUserID = body.Condition.BroadcasterUserID
+	subscription.Transport.Method = body.Transport.Method
+	subscription.Transport.SessionID = body.Transport.SessionID
+	s.subscriptions = append(s.subscriptions, subscription)
+
+	writeJSON(w, 202, twitch.EventSubSubscriptionsResponse{Data: []twitch.Subscription{subscription}})
+}
+
+func (s *Server) emoteTemplate() string {
+	return s.URL + "/emoticons/v2/{{id}}/{{format}}/{{theme_mode}}/{{scale}}"
+}
+
+func (s *Server) handleChannelEmotes(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, ""); !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	emotes := s.channelEmotes[r.URL.Query().Get("broadcaster_id")]
+	if emotes == nil {
+		emotes = []twitch.ChannelEmoteData{}
+	}
+	writeJSON(w, 200, twitch.ChannelEmotesResponse{Data: emotes, Template: s.emoteTemplate()})
+}
+
+func (s *Server) handleGlobalEmotes(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, ""); !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	emotes := s.globalEmotes
+	if emotes == nil {
+		emotes = []twitch.GlobalEmoteData{}
+	}
+	writeJSON(w, 200, twitch.GlobalEmotesResponse{Data: emotes, Template: s.emoteTemplate()})
+}
+
+// emotePNG is a 1x1 image served for every emote
+var emotePNG = func() []byte {
+	buffer := &bytes.Buffer{}
+	png.Encode(buffer, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	return buffer.Bytes()
+}()
+
+func (s *Server) handleEmoteImage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(emotePNG)
+}
+
+func (s *Server) handleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.authorize(w, r, "moderator:manage:chat_messages")
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("moderator_id") != token.UserID {
+		writeError(w, 403, "moderator_id must match the token")
+		return
+	}
+
+	s.mu.Lock()
+	s.deletedMessages = append(s.deletedMessages, DeletedMessage{
+		BroadcasterID: query.Get("broadcaster_id"),
+		ModeratorID:   query.Get("moderator_id"),
+		MessageID:     query.Get("message_id"),
+	})
+	s.mu.Unlock()
+	w.WriteHeader(204)
+}
+
+func (s *Server) handleBan(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.authorize(w, r, "moderator:manage:banned_users")
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("moderator_id") != token.UserID {
+		writeError(w, 403, "moderator_id must match the token")
+		return
+	}
+	var body struct {
+		Data twitch.BanUserRequest `json:"data"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Data.UserID == "" {
+		writeError(w, 400, "Missing required parameter \"data.user_id\"")
+		return
+	}
+
+	s.mu.Lock()
+	s.bans = append(s.bans, Ban{
+		BroadcasterID:  query.Get("broadcaster_id"),
+		ModeratorID:    query.Get("moderator_id"),
+		BanUserRequest: body.Data,
+	})
+	s.mu.Unlock()
+	writeJSON(w, 200, map[string]any{"data": []map[string]string{{
+		"broadcaster_id": query.Get("broadcaster_id"),
+		"moderator_id":   query.Get("moderator_id"),
+		"user_id":        body.Data.UserID,
+	}}})
+}
+
+// handleBanned lists bans page by page, the cursor is the next index
+func (s *Server) handleBanned(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, "moderation:read"); !ok {
+		return
+	}
+	query := r.URL.Query()
+	first, err := strconv.Atoi(query.Get("first"))
+	if err != nil || first < 1 || first > 100 {
+		first = 20
+	}
+	start, _ := strconv.Atoi(query.Get("after"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page := []map[string]string{}
+	cursor := ""
+	for idx := start; idx < len(s.bans); idx++ {
+		if len(page) == first {
+			cursor = strconv.Itoa(idx)
+			break
+		}
+		if s.bans[idx].BroadcasterID == query.Get("broadcaster_id") {
+			page = append(page, map[string]string{"user_id": s.bans[idx].UserID})
+		}
+	}
+	writeJSON(w, 200, map[string]any{
+		"data":       page,
+		"pagination": twitch.Pagination{Cursor: cursor},
+	})
+}
+
+func (s *Server) handleGetChannel(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, ""); !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channels := []twitch.ChannelInformation{}
+	for _, broadcasterID := range r.URL.Query()["broadcaster_id"] {
+		if channel, ok := s.channels[broadcasterID]; ok {
+			channels = append(channels, channel)
+		}
+	}
+	writeJSON(w, 200, map[string]any{"data": channels})
+}
+
+func (s *Server) handleStreams(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, ""); !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	streams := []twitch.Stream{}
+	for _, userID := range r.URL.Query()["user_id"] {
+		if stream, ok := s.streams[userID]; ok {
+			streams = append(streams, stream)
+		}
+	}
+	writeJSON(w, 200, map[string]any{"data": streams})
+}
+
+// handleModifyChannel merges the body into the stored channel, so fields
+// added to the request later are applied without changes here
+func (s *Server) handleModifyChannel(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.authorize(w, r, "channel:manage:broadcast")
+	if !ok {
+		return
+	}
+	broadcasterID := r.URL.Query().Get("broadcaster_id")
+	if broadcasterID != token.UserID {
+		writeError(w, 401, "The ID in broadcaster_id must match the user ID found in the request's OAuth token.")
+		return
+	}
+	var update map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, 400, "invalid body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channel := s.channels[broadcasterID]
+	channel.BroadcasterID = broadcasterID
+
+	// labels are sent as changes but read back as the enabled IDs
+	if raw, ok := update["content_classification_labels"]; ok {
+		delete(update, "content_classification_labels")
+		var labels []twitch.ContentClassificationLabel
+		encoded, _ := json.Marshal(raw)
+		json.Unmarshal(encoded, &labels)
+		for _, label := range labels {
+			channel.ContentClassificationLabels = slices.DeleteFunc(channel.ContentClassificationLabels, func(id string) bool { return id == label.ID })
+			if label.IsEnabled {
+				channel.ContentClassificationLabels = append(channel.ContentClassificationLabels, label.ID)
+			}
+		}
+	}
+
+	current := map[string]any{}
+	raw, _ := json.Marshal(channel)
+	json.Unmarshal(raw, &current)
+	for key, value := range update {
+		current[key] = value
+	}
+
+	// resolve the category name like Twitch does
+	if gameID, ok := update["game_id"].(string); ok {
+		current["game_name"] = ""
+		for _, category := range s.categories {
+			if category.ID == gameID {
+				current["game_name"] = category.Name
+			}
+		}
+	}
+	raw, _ = json.Marshal(current)
+	channel = twitch.ChannelInformation{}
+	json.Unmarshal(raw, &channel)
+	s.channels[broadcasterID] = channel
+
+	w.WriteHeader(204)
+}
+
+func (s *Server) handleSearchCategories(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, ""); !ok {
+		return
+	}
+	query := strings.ToLower(r.URL.Query().Get("query"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	categories := []twitch.Category{}
+	for _, category := range s.categories {
+		if strings.Contains(strings.ToLower(category.Name), query) {
+			categories = append(categories, category)
+		}
+	}
+	writeJSON(w, 200, map[string]any{"data": categories})
+}
+
+func (s *Server) handleGames(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, ""); !ok {
+		return
+	}
+	ids, names := r.URL.Query()["id"], r.URL.Query()["name"]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	categories := []twitch.Category{}
+	for _, category := range s.categories {
+		if slices.Contains(ids, category.ID) || slices.Contains(names, category.Name) {
+			categories = append(categories, category)
+		}
+	}
+	writeJSON(w, 200, map[string]any{"data": categories})
+}
+
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	accessToken, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	token, ok := s.tokens[accessToken]
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, 401, map[string]any{"status": 401, "message": "invalid access token"})
+		return
+	}
+
+	writeJSON(w, 200, twitch.TokenValidation{
+		ClientID:  ClientID,
+		Login:     token.Login,
+		UserID:    token.UserID,
+		Scopes:    token.Scopes,
+		ExpiresIn: 3600,
+	})
+}
+
+// handleToken implements the refresh token grant
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" {
+		writeJSON(w, 400, map[string]any{"status": 400, "message": "unsupported grant type"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshToken := r.PostForm.Get("refresh_token")
+	token, ok := s.refreshTokens[refreshToken]
+	if !ok {
+		writeJSON(w, 400, map[string]any{"status": 400, "message": "Invalid refresh token"})
+		return
+	}
+
+	// refresh tokens are single use
+	accessToken := "refreshed-" + s.newID()
+	newRefreshToken := "refresh-" + s.newID()
+	delete(s.refreshTokens, refreshToken)
+	s.tokens[accessToken] = token
+	s.refreshTokens[newRefreshToken] = token
+
+	writeJSON(w, 200, map[string]any{
+		"access_token":  accessToken,
+		"refresh_token": newRefreshToken,
+		"expires_in":    3600,
+		"scope":         token.Scopes,
+		"token_type":    "bearer",
+	})
+}
+
+// handleGQL supports the UpdateChatSettings operation
+func (s *Server) handleGQL(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, ""); !ok {
+		return
+	}
+	var operations []struct {
+		OperationName string `json:"operationName"`
+		Variables     struct {
+			Input struct {
+				ChannelID string `json:"channelID"`
+				HideLinks bool   `json:"hideLinks"`
+			} `json:"input"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&operations); err != nil || len(operations) != 1 || operations[0].OperationName != "UpdateChatSettings" {
+		writeError(w, 400, "unsupported operation")
+		return
+	}
+	input := operations[0].Variables.Input
+
+	s.mu.Lock()
+	s.chatSettings[input.ChannelID] = input.HideLinks
+	s.mu.Unlock()
+
+	// the GQL endpoint answers a batch with a single object
+	writeJSON(w, 200, map[string]any{
+		"data": map[string]any{
+			"updateChatSettings": map[string]any{
+				"chatSettings": map[string]any{"hideLinks": input.HideLinks},
+			},
+		},
+	})
+}
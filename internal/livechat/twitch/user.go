@@ -1,9 +1,9 @@
 package twitch
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"net/http"
 	"net/url"
 )
 
@@ -19,46 +19,32 @@ type UsersResponse struct {
 	Data []User `json:"data"`
 }
 
-func GetUsers(auth AuthConfig, userNames []string) ([]User, error) {
-	// set userName
+// GetUsersByID looks up users by ID, unknown IDs are left out
+func (c *Client) GetUsersByID(ctx context.Context, userIDs []string) ([]User, error) {
 	queryParams := url.Values{}
-	if len(userNames) >= 1 {
-		for _, userName := range userNames {
-			queryParams.Add("login", userName)
-		}
-	}
-
-	baseURL := url.URL{
-		Scheme:   "https",
-		Host:     "api.twitch.tv",
-		Path:     "/helix/users",
-		RawQuery: queryParams.Encode(),
+	for _, userID := range userIDs {
+		queryParams.Add("id", userID)
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", baseURL.String(), nil)
-	if err != nil {
+	var usersResponse UsersResponse
+	if err := c.Get(ctx, "/users", queryParams, &usersResponse); err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", auth.Bearer())
-	req.Header.Set("Client-Id", auth.ClientID)
 
-	// send request
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
+	return usersResponse.Data, nil
+}
 
-	// check if the response status is not 200 OK
-	if res.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to fetch current user: status code " + res.Status)
+// GetUsers looks up users by login, without logins the owner of the token
+func (c *Client) GetUsers(ctx context.Context, userNames []string) ([]User, error) {
+	// set userName
+	queryParams := url.Values{}
+	for _, userName := range userNames {
+		queryParams.Add("login", userName)
 	}
 
-	// decode the response body
+	// send request
 	var usersResponse UsersResponse
-	err = json.NewDecoder(res.Body).Decode(&usersResponse)
-	if err != nil {
+	if err := c.Get(ctx, "/users", queryParams, &usersResponse); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,181 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// commandKeyPlaceholder is replaced by the secret's key in command arguments
+	commandKeyPlaceholder = "{key}"
+
+	// failed lookups are retried after this long, the failure may be
+	// transient, e.g. a locked password manager
+	commandMissTTL = 30 * time.Second
+)
+
+// commandTimeout stops commands that hang or wait for input, e.g. a password
+// prompt nobody will answer
+var commandTimeout = 10 * time.Second
+
+// commandMiss remembers a failed lookup, err is set if the command didn't
+// finish and is returned until the lookup is retried
+type commandMiss struct {
+	at  time.Time
+	err error
+}
+
+// commandStore reads secrets by running an external command, e.g. a password
+// manager CLI, which prints the secret to stdout. An optional set command
+// receives the new value on stdin, without one changes are kept in memory.
+// Values are cached as Get is called for every API request. Commands run
+// without the lock held so a slow lookup doesn't block cached reads.
+type commandStore struct {
+	getCommand []string
+	setCommand []string
+
+	cache  Secrets
+	misses map[string]commandMiss
+	mu     sync.Mutex
+
+	// setMu keeps changes in order
+	setMu sync.Mutex
+}
+
+func newCommandStore(getCommand []string, setCommand []string) (*commandStore, error) {
+	if len(getCommand) == 0 {
+		return nil, errors.New("secrets.command must be set to use the command backend")
+	}
+	return &commandStore{
+		getCommand: getCommand,
+		setCommand: setCommand,
+		cache:      make(Secrets),
+		misses:     map[string]commandMiss{},
+	}, nil
+}
+
+// command builds the command for a key, it is killed when ctx is done
+func (cs *commandStore) command(ctx context.Context, args []string, key string) *exec.Cmd {
+	expanded := make([]string, len(args))
+	for idx, arg := range args {
+		expanded[idx] = strings.ReplaceAll(arg, commandKeyPlaceholder, key)
+	}
+	cmd := exec.CommandContext(ctx, expanded[0], expanded[1:]...)
+	cmd.Env = append(cmd.Environ(), "STREAM_ADMIN_SECRET_KEY="+key)
+	// children left behind by a killed shell may keep the output open
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+// timeoutError replaces the error of a command that was killed for taking too long
+func timeoutError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("secrets command timed out after %s", commandTimeout)
+	}
+	return err
+}
+
+func (cs *commandStore) Get(key string) (string, error) {
+	cs.mu.Lock()
+	value, cached := cs.cache[key]
+	miss, missed := cs.misses[key]
+	cs.mu.Unlock()
+	if cached {
+		return value, nil
+	}
+	if missed && time.Since(miss.at) < commandMissTTL {
+		return "", miss.err
+	}
+
+	// a failing command is treated as the secret not existing
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	cmd := cs.command(ctx, cs.getCommand, key)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case ctx.Err() != nil:
+			err = timeoutError(ctx, err)
+			log.Error().Err(err).Str("key", key).Msg("secrets command didn't finish")
+		case !errors.As(err, &exitErr):
+			return "", err
+		default:
+			log.Debug().Str("key", key).Str("stderr", stderr.String()).Msg("secrets command failed, treating the secret as unset")
+			err = nil
+		}
+		cs.mu.Lock()
+		cs.misses[key] = commandMiss{at: time.Now(), err: err}
+		cs.mu.Unlock()
+		return "", err
+	}
+
+	value = strings.TrimRight(string(output), "\r\n")
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	// a value set while the command ran is newer
+	if _, ok := cs.cache[key]; !ok {
+		cs.cache[key] = value
+	}
+	delete(cs.misses, key)
+	return value, nil
+}
+
+func (cs *commandStore) Set(key string, value string) error {
+	cs.setMu.Lock()
+	defer cs.setMu.Unlock()
+
+	if len(cs.setCommand) == 0 {
+		log.Warn().Str("key", key).Msg("secrets.setCommand isn't set, the change is kept in memory only")
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+		cmd := cs.command(ctx, cs.setCommand, key)
+		cmd.Stdin = strings.NewReader(value)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			err = timeoutError(ctx, err)
+			log.Error().Err(err).Str("key", key).Str("output", string(output)).Msg("secrets set command failed")
+			return err
+		}
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.cache[key] = value
+	delete(cs.misses, key)
+	return nil
+}
+
+// All fetches the known secrets as the command can't list them
+func (cs *commandStore) All() (Secrets, error) {
+	secrets := make(Secrets)
+	for _, key := range knownKeys {
+		value, err := cs.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			secrets[key] = value
+		}
+	}
+	return secrets, nil
+}
+
+func (cs *commandStore) Clear() error {
+	return errors.New("secrets stored by an external command must be removed with that tool")
+}
+
+// Persistent is false unless a set command writes changes back
+func (cs *commandStore) Persistent() bool {
+	return len(cs.setCommand) > 0
+}
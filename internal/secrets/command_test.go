@@ -0,0 +1,74 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandStoreMiss(t *testing.T) {
+	// the command fails until the unlock file exists, like a locked password manager
+	unlock := filepath.Join(t.TempDir(), "unlocked")
+	store, err := newCommandStore([]string{"sh", "-c", `test -f "$0" && echo token`, unlock}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := store.Get("twitch_token")
+	if err != nil || value != "" {
+		t.Fatalf("expected the failed lookup to be unset, got %q %v", value, err)
+	}
+
+	// failures are only remembered briefly
+	if err := os.WriteFile(unlock, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := store.Get("twitch_token"); value != "" {
+		t.Errorf("expected the failure to be cached for a while, got %q", value)
+	}
+	store.misses["twitch_token"] = commandMiss{at: time.Now().Add(-commandMissTTL)}
+	if value, err := store.Get("twitch_token"); err != nil || value != "token" {
+		t.Errorf("expected the lookup to be retried, got %q %v", value, err)
+	}
+}
+
+func TestCommandStoreTimeout(t *testing.T) {
+	timeout := commandTimeout
+	commandTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { commandTimeout = timeout })
+
+	// the command hangs for the first key, like a password prompt
+	store, err := newCommandStore([]string{"sh", "-c", `test "$0" = twitch_token && sleep 10; echo value`, "{key}"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("twitch_client_id", "cached"); err != nil {
+		t.Fatal(err)
+	}
+
+	// other secrets can be read while the command hangs
+	done := make(chan error)
+	go func() {
+		_, err := store.Get("twitch_token")
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if value, err := store.Get("twitch_client_id"); err != nil || value != "cached" {
+		t.Errorf("expected the cached value, got %q %v", value, err)
+	}
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("expected a timeout error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the command wasn't stopped")
+	}
+
+	// the timeout is remembered like a failed lookup
+	if _, err := store.Get("twitch_token"); err == nil {
+		t.Error("expected the timeout to be remembered")
+	}
+}
@@ -0,0 +1,186 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/nullvt/stream-admin/internal/config"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PassphraseEnv holds the passphrase for the encrypted secrets file, used
+// when no key file is configured
+const PassphraseEnv = "STREAM_ADMIN_SECRETS_PASSPHRASE"
+
+// scrypt cost parameters, stored in the file so they can be raised later
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// encryptedFile is the on-disk format of the encrypted secrets file
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// the derived key is cached as scrypt is deliberately slow
+var derivedKey struct {
+	mu     sync.Mutex
+	secret []byte
+	salt   []byte
+	key    []byte
+}
+
+// keyMaterial reads the key file, generating it on first use, or falls back
+// to the passphrase environment variable. A missing key file is only generated
+// while there are no encrypted secrets, a new key couldn't decrypt them.
+func keyMaterial() ([]byte, error) {
+	keyFile := config.Cfg.Secrets.KeyFile
+	if keyFile == "" {
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("encrypted secrets need secrets.keyFile or %s to be set", PassphraseEnv)
+		}
+		return []byte(passphrase), nil
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err == nil {
+		return bytes.TrimSpace(key), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if _, err := os.Stat(encryptedSecretsFile); err == nil {
+		return nil, fmt.Errorf("secrets key file %s is missing but %s exists, restore the key file", keyFile, encryptedSecretsFile)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// generate a new key file
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return nil, err
+	}
+	key = []byte(hex.EncodeToString(buffer))
+	if err := writeFileAtomic(keyFile, key); err != nil {
+		return nil, fmt.Errorf("failed to create secrets key file: %w", err)
+	}
+	return key, nil
+}
+
+func deriveKey(salt []byte, n int, r int, p int) ([]byte, error) {
+	secret, err := keyMaterial()
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKey.mu.Lock()
+	defer derivedKey.mu.Unlock()
+	if bytes.Equal(derivedKey.secret, secret) && bytes.Equal(derivedKey.salt, salt) {
+		return derivedKey.key, nil
+	}
+
+	key, err := scrypt.Key(secret, salt, n, r, p, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	derivedKey.secret = secret
+	derivedKey.salt = salt
+	derivedKey.key = key
+
+	return key, nil
+}
+
+// encrypt seals the plaintext with AES-256-GCM, reusing the salt of the
+// cached key so the KDF only runs once per process
+func encrypt(plaintext []byte) ([]byte, error) {
+	derivedKey.mu.Lock()
+	salt := derivedKey.salt
+	derivedKey.mu.Unlock()
+	if salt == nil {
+		salt = make([]byte, saltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+	}
+	key, err := deriveKey(salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	file := encryptedFile{
+		Version:    1,
+		KDF:        "scrypt",
+		N:          scryptN,
+		R:          scryptR,
+		P:          scryptP,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	}
+
+	return json.Marshal(file)
+}
+
+func decrypt(content []byte) ([]byte, error) {
+	var file encryptedFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+	if file.Version != 1 || file.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported secrets file version %d (%s)", file.Version, file.KDF)
+	}
+
+	key, err := deriveKey(file.Salt, file.N, file.R, file.P)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid nonce in secrets file")
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt secrets, wrong passphrase or key file?")
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
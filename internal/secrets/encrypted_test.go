@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/nullvt/stream-admin/internal/config"
+)
+
+func TestEncryptedKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+	keyFile := filepath.Join(dir, "secrets.key")
+	config.Cfg.Secrets.KeyFile = keyFile
+	t.Cleanup(func() { config.Cfg.Secrets.KeyFile = "" })
+
+	// the key is generated on first use, concurrent use shares the derived key
+	content, err := encrypt([]byte(`{"twitch_token":"token"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := decrypt(content); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := encrypt([]byte(`{}`)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := writeFileAtomic(encryptedSecretsFile, content); err != nil {
+		t.Fatal(err)
+	}
+
+	// a missing key file must not be replaced while secrets exist
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyMaterial(); err == nil {
+		t.Fatal("expected an error for the missing key file")
+	}
+	if _, err := os.Stat(keyFile); !os.IsNotExist(err) {
+		t.Errorf("expected no key file to be generated, got %v", err)
+	}
+}
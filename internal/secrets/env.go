@@ -0,0 +1,75 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// EnvPrefix is prepended to the upper cased key, e.g. twitch_token is read
+// from STREAM_ADMIN_SECRET_TWITCH_TOKEN
+const EnvPrefix = "STREAM_ADMIN_SECRET_"
+
+// envStore reads secrets from environment variables. Those can't be written,
+// so changes like refreshed tokens only live in memory until restarted.
+type envStore struct {
+	overrides Secrets
+	mu        sync.Mutex
+}
+
+func newEnvStore() *envStore {
+	return &envStore{overrides: make(Secrets)}
+}
+
+func envKey(key string) string {
+	return EnvPrefix + strings.ToUpper(key)
+}
+
+func (es *envStore) Get(key string) (string, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if value, ok := es.overrides[key]; ok {
+		return value, nil
+	}
+	return os.Getenv(envKey(key)), nil
+}
+
+func (es *envStore) Set(key string, value string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	log.Warn().Str("key", key).Msg("secrets are read from the environment, the change is kept in memory only")
+	es.overrides[key] = value
+	return nil
+}
+
+func (es *envStore) All() (Secrets, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	secrets := make(Secrets)
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if key, ok := strings.CutPrefix(name, EnvPrefix); ok && value != "" {
+			secrets[strings.ToLower(key)] = value
+		}
+	}
+	for key, value := range es.overrides {
+		secrets[key] = value
+	}
+
+	return secrets, nil
+}
+
+func (es *envStore) Clear() error {
+	return errors.New("secrets in environment variables can't be removed")
+}
+
+// Persistent is false as changes are lost on restart
+func (es *envStore) Persistent() bool {
+	return false
+}
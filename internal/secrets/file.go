@@ -0,0 +1,146 @@
+package secrets
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+const secretsFile = "secrets.json"
+const encryptedSecretsFile = "secrets.json.enc"
+
+// fileStore keeps the secrets in a JSON file, optionally encrypted at rest
+type fileStore struct {
+	fileName  string
+	encrypted bool
+
+	mu sync.Mutex
+}
+
+// LoadSecrets loads the secrets from the file, creating a new map if the file doesn't exist
+func (fs *fileStore) loadSecrets() (Secrets, error) {
+	content, err := os.ReadFile(fs.fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(Secrets), nil // Create a new Secrets map if the file doesn't exist
+		}
+		log.Error().Err(err).Msg("Failed to open secrets file")
+		return nil, err
+	}
+	if fs.encrypted {
+		if content, err = decrypt(content); err != nil {
+			log.Error().Err(err).Msg("Failed to decrypt secrets file")
+			return nil, err
+		}
+	}
+
+	var secrets Secrets
+	if err := json.Unmarshal(content, &secrets); err != nil {
+		log.Error().Err(err).Msg("Failed to decode secrets file")
+		return nil, err
+	}
+	if secrets == nil {
+		secrets = make(Secrets)
+	}
+
+	return secrets, nil
+}
+
+// SaveSecrets saves the secrets map to the file
+func (fs *fileStore) saveSecrets(secrets Secrets) error {
+	content, err := json.Marshal(secrets)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode secrets to file")
+		return err
+	}
+	if fs.encrypted {
+		if content, err = encrypt(content); err != nil {
+			log.Error().Err(err).Msg("Failed to encrypt secrets")
+			return err
+		}
+	}
+	if err := writeFileAtomic(fs.fileName, content); err != nil {
+		log.Error().Err(err).Msg("Failed to write secrets file")
+		return err
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file readable only by the owner and
+// renames it over the original, so a crash never leaves a truncated file
+func writeFileAtomic(fileName string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fileName)
+}
+
+func (fs *fileStore) Set(key string, value string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Load existing secrets
+	secrets, err := fs.loadSecrets()
+	if err != nil {
+		return err
+	}
+
+	// Set the new key-value pair
+	secrets[key] = value
+
+	// Save the updated secrets
+	return fs.saveSecrets(secrets)
+}
+
+func (fs *fileStore) Get(key string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Load existing secrets
+	secrets, err := fs.loadSecrets()
+	if err != nil {
+		return "", err
+	}
+
+	return secrets[key], nil // an empty string if the key is not found
+}
+
+func (fs *fileStore) All() (Secrets, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.loadSecrets()
+}
+
+func (fs *fileStore) Clear() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := os.Remove(fs.fileName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
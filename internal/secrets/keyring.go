@@ -0,0 +1,117 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+)
+
+const keyringService = "nullvt_stream_admin"
+
+// the keyring can't list its entries, so the stored keys are tracked in an
+// index entry
+const keyringIndexKey = "__index"
+
+// keyringStore keeps the secrets in the OS keyring
+type keyringStore struct {
+	mu sync.Mutex
+}
+
+func keyringGet(key string) (string, error) {
+	value, err := keyring.Get(keyringService, key)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", nil
+	}
+	return value, err
+}
+
+// keyringIndex returns the keys stored in the keyring
+func keyringIndex() ([]string, error) {
+	rawIndex, err := keyringGet(keyringIndexKey)
+	if err != nil {
+		return nil, err
+	}
+	index := []string{}
+	if rawIndex != "" {
+		if err := json.Unmarshal([]byte(rawIndex), &index); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+func (ks *keyringStore) Get(key string) (string, error) {
+	return keyringGet(key)
+}
+
+// Set stores a secret and adds it to the index
+func (ks *keyringStore) Set(key string, value string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if err := keyring.Set(keyringService, key, value); err != nil {
+		return err
+	}
+
+	index, err := keyringIndex()
+	if err != nil {
+		return err
+	}
+	for _, indexed := range index {
+		if indexed == key {
+			return nil
+		}
+	}
+	rawIndex, err := json.Marshal(append(index, key))
+	if err != nil {
+		return err
+	}
+	return keyring.Set(keyringService, keyringIndexKey, string(rawIndex))
+}
+
+// All returns the indexed secrets, plus the known ones stored before the
+// index existed
+func (ks *keyringStore) All() (Secrets, error) {
+	index, err := keyringIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make(Secrets)
+	for _, key := range append(append([]string{}, knownKeys...), index...) {
+		if _, loaded := secrets[key]; loaded {
+			continue
+		}
+		value, err := keyringGet(key)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			secrets[key] = value
+		}
+	}
+
+	return secrets, nil
+}
+
+// Clear removes every indexed secret and the index itself
+func (ks *keyringStore) Clear() error {
+	secrets, err := ks.All()
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for key := range secrets {
+		if err := keyring.Delete(keyringService, key); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return err
+		}
+	}
+	if err := keyring.Delete(keyringService, keyringIndexKey); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return err
+	}
+	return nil
+}
@@ -1,115 +1,136 @@
 package secrets
 
 import (
-	"encoding/json"
-	"os"
+	"fmt"
 	"sync"
 
 	"github.com/nullvt/stream-admin/internal/config"
-	"github.com/rs/zerolog/log"
-	"github.com/zalando/go-keyring"
 )
 
 type Secrets map[string]string
 
-const keyringService = "nullvt_stream_admin"
-const secretsFile = "secrets.json"
+// SecretStore is a backend holding the secrets
+type SecretStore interface {
+	Get(key string) (string, error)
+	Set(key string, value string) error
 
-var mu sync.Mutex
+	// All returns every secret the store knows about, used for migrations
+	All() (Secrets, error)
 
-// LoadSecrets loads the secrets from the file, creating a new map if the file doesn't exist
-func loadSecrets() (Secrets, error) {
-	var secrets Secrets
+	// Clear removes every secret from the store
+	Clear() error
+}
 
-	file, err := os.Open(secretsFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			secrets = make(Secrets) // Create a new Secrets map if the file doesn't exist
-			return secrets, nil
-		}
-		log.Error().Err(err).Msg("Failed to open secrets file")
-		return nil, err
-	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			log.Error().Err(closeErr).Msg("Failed to close secrets file")
-		}
-	}()
+// Backend is where secrets are stored
+type Backend string
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&secrets); err != nil {
-		log.Error().Err(err).Msg("Failed to decode secrets file")
-		return nil, err
-	}
+const (
+	BackendPlaintext Backend = "plaintext"
+	BackendEncrypted Backend = "encrypted"
+	BackendKeyring   Backend = "keyring"
+	BackendEnv       Backend = "env"
+	BackendCommand   Backend = "command"
+)
 
-	return secrets, nil
+var Backends = []Backend{BackendPlaintext, BackendEncrypted, BackendKeyring, BackendEnv, BackendCommand}
+
+// secrets known to exist, used by stores which can't list their contents
+var knownKeys = []string{
+	"admin_token",
+	"twitch_token",
+	"twitch_user",
+	"twitch_refresh_token",
+	"twitch_token_expiry",
+	"twitch_token_scopes",
+	"twitch_client_secret",
+	"twitch_bot_token",
+	"twitch_bot_user",
+	"twitch_bot_refresh_token",
+	"twitch_bot_token_expiry",
+	"twitch_bot_token_scopes",
 }
 
-// SaveSecrets saves the secrets map to the file
-func saveSecrets(secrets Secrets) error {
-	file, err := os.Create(secretsFile)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create secrets file")
-		return err
-	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			log.Error().Err(closeErr).Msg("Failed to close secrets file after writing")
-		}
-	}()
+var (
+	store        SecretStore
+	storeBackend Backend
+	storeMu      sync.Mutex
+)
 
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(secrets); err != nil {
-		log.Error().Err(err).Msg("Failed to encode secrets to file")
-		return err
+// ValidBackend checks if a backend is known
+func ValidBackend(backend Backend) bool {
+	for _, known := range Backends {
+		if backend == known {
+			return true
+		}
 	}
-
-	return nil
+	return false
 }
 
-func Set(key string, value string) error {
+// ActiveBackend returns the backend selected by the config, falling back to
+// the older keyring and encrypted switches
+func ActiveBackend() Backend {
+	if config.Cfg.Secrets.Backend != "" {
+		return Backend(config.Cfg.Secrets.Backend)
+	}
 	if config.Cfg.Server.Keyring {
-		return keyring.Set(keyringService, key, value)
+		return BackendKeyring
 	}
+	if config.Cfg.Secrets.Encrypted {
+		return BackendEncrypted
+	}
+	return BackendPlaintext
+}
+
+// Open creates the store for a backend
+func Open(backend Backend) (SecretStore, error) {
+	switch backend {
+	case BackendPlaintext:
+		return &fileStore{fileName: secretsFile}, nil
+	case BackendEncrypted:
+		return &fileStore{fileName: encryptedSecretsFile, encrypted: true}, nil
+	case BackendKeyring:
+		return &keyringStore{}, nil
+	case BackendEnv:
+		return newEnvStore(), nil
+	case BackendCommand:
+		return newCommandStore(config.Cfg.Secrets.Command, config.Cfg.Secrets.SetCommand)
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q", backend)
+	}
+}
 
-	mu.Lock()
-	defer mu.Unlock()
+// activeStore returns the store of the configured backend, reopening it if
+// the config changed
+func activeStore() (SecretStore, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
 
-	// Load existing secrets
-	secrets, err := loadSecrets()
+	backend := ActiveBackend()
+	if store != nil && storeBackend == backend {
+		return store, nil
+	}
+	newStore, err := Open(backend)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	store = newStore
+	storeBackend = backend
 
-	// Set the new key-value pair
-	secrets[key] = value
+	return store, nil
+}
 
-	// Save the updated secrets
-	if err := saveSecrets(secrets); err != nil {
+func Set(key string, value string) error {
+	store, err := activeStore()
+	if err != nil {
 		return err
 	}
-
-	return nil
+	return store.Set(key, value)
 }
 
 func Get(key string) (string, error) {
-	if config.Cfg.Server.Keyring {
-		return keyring.Get(keyringService, key)
-	}
-
-	mu.Lock()
-	defer mu.Unlock()
-
-	// Load existing secrets
-	secrets, err := loadSecrets()
+	store, err := activeStore()
 	if err != nil {
 		return "", err
 	}
-
-	value, exists := secrets[key]
-	if !exists {
-		return "", nil // Return an empty string if the key is not found
-	}
-
-	return value, nil
+	return store.Get(key)
 }
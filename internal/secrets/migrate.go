@@ -0,0 +1,62 @@
+package secrets
+
+import "fmt"
+
+// persistentStore is implemented by stores which may only keep changes in
+// memory
+type persistentStore interface {
+	Persistent() bool
+}
+
+// Migrate copies every secret from one backend to another, keeping secrets
+// already in the target unless the source has them too. The copy is read back
+// before the source is removed, so no token is lost if anything fails.
+func Migrate(from Backend, to Backend, removeSource bool) (int, error) {
+	if from == to {
+		return 0, fmt.Errorf("source and target backend are both %s", from)
+	}
+	source, err := Open(from)
+	if err != nil {
+		return 0, err
+	}
+	target, err := Open(to)
+	if err != nil {
+		return 0, err
+	}
+	if persistent, ok := target.(persistentStore); ok && !persistent.Persistent() {
+		return 0, fmt.Errorf("the %s backend can't be written to", to)
+	}
+
+	secrets, err := source.All()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load %s secrets: %w", from, err)
+	}
+	for key, value := range secrets {
+		if err := target.Set(key, value); err != nil {
+			return 0, fmt.Errorf("failed to save %s secrets: %w", to, err)
+		}
+	}
+
+	// verify the copy before touching the source, reopening the target so
+	// nothing is served from a cache
+	if target, err = Open(to); err != nil {
+		return 0, err
+	}
+	for key, value := range secrets {
+		written, err := target.Get(key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to verify %s secrets: %w", to, err)
+		}
+		if written != value {
+			return 0, fmt.Errorf("secret %q did not migrate, the source was kept", key)
+		}
+	}
+
+	if removeSource {
+		if err := source.Clear(); err != nil {
+			return len(secrets), fmt.Errorf("secrets migrated but the source could not be removed: %w", err)
+		}
+	}
+
+	return len(secrets), nil
+}
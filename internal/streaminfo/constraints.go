@@ -0,0 +1,64 @@
+package streaminfo
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxTitleLength is the longest title Twitch accepts, in characters
+	MaxTitleLength = 140
+
+	MaxTags      = 10
+	MaxTagLength = 25
+
+	// MaxDelay is the longest stream delay, in seconds
+	MaxDelay = 900
+)
+
+// ContentClassificationLabels are the labels a broadcaster can set,
+// MatureGame is set by Twitch from the category
+var ContentClassificationLabels = []string{
+	"DebatedSocialIssuesAndPolitics",
+	"DrugsIntoxication",
+	"Gambling",
+	"ProfanityVulgarity",
+	"SexualThemes",
+	"ViolentGraphic",
+}
+
+// IsContentClassificationLabel checks if a label can be set by the broadcaster
+func IsContentClassificationLabel(id string) bool {
+	return slices.Contains(ContentClassificationLabels, id)
+}
+
+// ValidateTag checks a tag against the rules of Twitch: up to 25 letters or
+// digits, no spaces or special characters
+func ValidateTag(tag string) error {
+	if tag == "" {
+		return errors.New("tag can't be empty")
+	}
+	if length := utf8.RuneCountInString(tag); length > MaxTagLength {
+		return fmt.Errorf("tag is %d characters, Twitch allows %d", length, MaxTagLength)
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return fmt.Errorf("tag can only contain letters and digits, found %q", r)
+		}
+	}
+	return nil
+}
+
+// ValidateLanguage checks a broadcaster language, an ISO 639-1 code or "other"
+func ValidateLanguage(language string) error {
+	if language == "other" {
+		return nil
+	}
+	if len(language) != 2 || !unicode.IsLower(rune(language[0])) || !unicode.IsLower(rune(language[1])) {
+		return fmt.Errorf("language must be a two letter ISO 639-1 code or \"other\", got %q", language)
+	}
+	return nil
+}
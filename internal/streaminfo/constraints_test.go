@@ -0,0 +1,29 @@
+package streaminfo
+
+import "testing"
+
+func TestValidateTag(t *testing.T) {
+	for _, tag := range []string{"English", "Deutsch", "日本語", "VTuber", "100Percent"} {
+		if err := ValidateTag(tag); err != nil {
+			t.Errorf("%q: %v", tag, err)
+		}
+	}
+	for _, tag := range []string{"", "two words", "no-dashes", "emoji🎮", "ThisTagIsWayTooLongForTwitch"} {
+		if err := ValidateTag(tag); err == nil {
+			t.Errorf("%q: expected an error", tag)
+		}
+	}
+}
+
+func TestValidateLanguage(t *testing.T) {
+	for _, language := range []string{"en", "de", "other"} {
+		if err := ValidateLanguage(language); err != nil {
+			t.Errorf("%q: %v", language, err)
+		}
+	}
+	for _, language := range []string{"EN", "english", "e", "é1"} {
+		if err := ValidateLanguage(language); err == nil {
+			t.Errorf("%q: expected an error", language)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package streaminfo
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nullvt/stream-admin/internal/livechat/twitch"
+	"github.com/rs/zerolog/log"
+)
+
+const historyFile = "stream-info-history.jsonl"
+
+// HistoryEntry is a change of the channel information, Before and After are
+// read from Twitch around it
+type HistoryEntry struct {
+	ID     string                     `json:"id"`
+	Time   time.Time                  `json:"time"`
+	Actor  string                     `json:"actor"`
+	Action string                     `json:"action"`
+	Target string                     `json:"target,omitempty"`
+	Before twitch.ChannelInformation  `json:"before"`
+	After  *twitch.ChannelInformation `json:"after"`
+}
+
+var historyMu sync.Mutex
+
+// AppendHistory writes an entry to the end of the history
+func AppendHistory(entry HistoryEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	file, err := os.OpenFile(historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// History returns up to limit entries, newest first, all of them if limit
+// is 0
+func History(limit int) ([]HistoryEntry, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	entries := []HistoryEntry{}
+	file, err := os.Open(historyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Warn().Err(err).Msg("skipping malformed stream info history entry")
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// newest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
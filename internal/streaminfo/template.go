@@ -0,0 +1,145 @@
+// Package streaminfo renders and checks stream info before it is sent to
+// Twitch.
+package streaminfo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TemplateData holds the values available to {{placeholders}}
+type TemplateData struct {
+	Now time.Time
+
+	// StreamCount is the number of streams so far, Online tells whether the
+	// current one is counted already
+	StreamCount int
+	Online      bool
+
+	// Variables are user-defined, Challenges map a name to its start date
+	Variables  map[string]string
+	Challenges map[string]string
+}
+
+// Builtins are the variables provided without configuration
+var Builtins = []string{"date", "time", "weekday", "stream", "day"}
+
+// IsBuiltin checks if a variable name is reserved
+func IsBuiltin(name string) bool {
+	for _, builtin := range Builtins {
+		if strings.EqualFold(name, builtin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render replaces {{name}} and {{name:argument}} placeholders:
+//
+//	{{date}}, {{date:Jan 2}}  the current date, formatted with a Go layout
+//	{{time}}, {{time:3PM}}    the current time
+//	{{weekday}}               e.g. Monday
+//	{{stream}}                the number of the current or next stream
+//	{{day:name}}              the day number of a challenge, starting at 1
+//	{{name}}                  a user-defined variable
+func Render(text string, data TemplateData) (string, error) {
+	var out strings.Builder
+	for {
+		start := strings.Index(text, "{{")
+		if start == -1 {
+			out.WriteString(text)
+			return out.String(), nil
+		}
+		end := strings.Index(text[start:], "}}")
+		if end == -1 {
+			return "", fmt.Errorf("unclosed {{ in %q", text)
+		}
+		end += start
+
+		value, err := resolve(strings.TrimSpace(text[start+2:end]), data)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(text[:start])
+		out.WriteString(value)
+		text = text[end+2:]
+	}
+}
+
+func resolve(placeholder string, data TemplateData) (string, error) {
+	name, argument, hasArgument := strings.Cut(placeholder, ":")
+	name = strings.ToLower(strings.TrimSpace(name))
+	argument = strings.TrimSpace(argument)
+	now := data.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	switch name {
+	case "":
+		return "", fmt.Errorf("empty placeholder {{%s}}", placeholder)
+	case "date":
+		if !hasArgument {
+			argument = "2006-01-02"
+		}
+		return now.Format(argument), nil
+	case "time":
+		if !hasArgument {
+			argument = "15:04"
+		}
+		return now.Format(argument), nil
+	case "weekday":
+		return now.Weekday().String(), nil
+	case "stream":
+		count := data.StreamCount
+		if !data.Online {
+			count++
+		}
+		return strconv.Itoa(count), nil
+	case "day":
+		return challengeDay(argument, data.Challenges, now)
+	}
+
+	// viper lower cases config keys, so lookups are case-insensitive
+	for key, value := range data.Variables {
+		if strings.EqualFold(key, name) {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("unknown variable %q", name)
+}
+
+// challengeDay counts calendar days since a challenge started, the start
+// date being day 1
+func challengeDay(name string, challenges map[string]string, now time.Time) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("{{day}} needs a challenge name, e.g. {{day:marathon}}")
+	}
+	var startDate string
+	found := false
+	for key, value := range challenges {
+		if strings.EqualFold(key, name) {
+			startDate, found = value, true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("unknown challenge %q", name)
+	}
+	start, err := time.ParseInLocation("2006-01-02", startDate, now.Location())
+	if err != nil {
+		return "", fmt.Errorf("challenge %q has an invalid start date %q", name, startDate)
+	}
+
+	// compare dates in UTC so DST changes don't shift the count
+	from := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return strconv.Itoa(int(to.Sub(from).Hours()/24) + 1), nil
+}
+
+// TitleLength counts characters the way Twitch limits titles
+func TitleLength(title string) int {
+	return utf8.RuneCountInString(title)
+}
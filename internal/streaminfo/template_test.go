@@ -0,0 +1,51 @@
+package streaminfo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	data := TemplateData{
+		Now:         time.Date(2024, 5, 15, 18, 30, 0, 0, time.UTC),
+		StreamCount: 41,
+		Variables:   map[string]string{"game": "Elden Ring"},
+		Challenges:  map[string]string{"marathon": "2024-05-01"},
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"no placeholders", "no placeholders"},
+		{"{{game}} day {{day:marathon}}", "Elden Ring day 15"},
+		{"{{ GAME }}", "Elden Ring"},
+		{"stream #{{stream}} on {{date}}", "stream #42 on 2024-05-15"},
+		{"{{date:Jan 2}} {{time}} {{weekday}}", "May 15 18:30 Wednesday"},
+		{"{{time:3PM}}", "6PM"},
+	}
+	for _, tt := range tests {
+		got, err := Render(tt.text, data)
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	// the stream counts once live
+	data.Online = true
+	if got, _ := Render("{{stream}}", data); got != "41" {
+		t.Errorf("expected the current stream, got %s", got)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	data := TemplateData{Challenges: map[string]string{"broken": "yesterday"}}
+	for _, text := range []string{"{{missing}}", "{{day}}", "{{day:unknown}}", "{{day:broken}}", "open {{date", "{{}}"} {
+		if _, err := Render(text, data); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/nullvt/stream-admin/internal/config"
 	"github.com/nullvt/stream-admin/internal/helpers"
 	"github.com/nullvt/stream-admin/internal/livechat"
+	"github.com/nullvt/stream-admin/internal/livechat/seventv"
 	"github.com/nullvt/stream-admin/internal/livechat/twitch"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -29,37 +30,90 @@ func main() {
 		os.Exit(1)
 	}
 
+	// run subcommands instead of the server
+	if len(os.Args) > 1 && os.Args[1] == "secrets" {
+		os.Exit(runSecretsCommand(os.Args[2:]))
+	}
+
 	// Open channel for sub process comms
 	msgChan := make(chan livechat.Message)
+	chatChan := make(chan livechat.Message)
 
 	// load emotes
 	emc := &livechat.EmoteCache{}
-	emotesIndexFile := "./emotecache/index.json"
-	if err := emc.LoadFromFile(emotesIndexFile); err != nil {
+	if err := emc.LoadFromFile(livechat.EmoteIndexFile); err != nil {
 		log.Error().Err(err).Msg("failed to load emotes")
 	}
 
+	// load emote stats, chat messages are counted before reaching the API
+	emoteStats := livechat.NewEmoteStats(config.Cfg.EmoteStats.PerChatter)
+	if err := emoteStats.LoadFromFile(livechat.EmoteStatsFile); err != nil {
+		log.Warn().Err(err).Msg("failed to load emote stats")
+	}
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	go emoteStats.Tee(chatChan, msgChan)
+	go emoteStats.SaveOnChange(statsCtx, livechat.EmoteStatsFile, time.Minute)
+
+	// point at other Twitch endpoints, e.g. a local stand-in
+	twitch.ConfigureURLs(config.Cfg.Twitch.HelixURL, config.Cfg.Twitch.OAuthURL, config.Cfg.Twitch.EventSubURL, config.Cfg.Twitch.GQLURL)
+
 	// Start API server
-	server, err := api.Start(msgChan, emc)
+	server, err := api.Start(msgChan, emc, emoteStats)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to start API server")
 		os.Exit(1)
 	}
 
-	// Start chat listeners
+	// refresh Twitch tokens transparently, telling the UI if that fails
+	twitch.ConfigureAuth(config.Cfg.Twitch.ClientID, helpers.TwitchTokenStores(), func(identity string, err error) {
+		log.Error().Err(err).Str("identity", identity).Msg("failed to refresh Twitch token")
+		api.BroadcastEvent(api.AuthStateEvent{
+			Type:     "auth_state",
+			Platform: livechat.Twitch,
+			Identity: identity,
+			Valid:    false,
+			Error:    err.Error(),
+		})
+	})
+
+	// Start chat listeners, reading chat as the bot when it is connected
 	twitchAuth, err := helpers.GetTwitchAuth()
 	if err != nil {
 		os.Exit(1)
 	}
-	twitch.StartListener(context.TODO(), msgChan, twitchAuth, emc)
+	botAuth, err := helpers.GetTwitchAuthFor(helpers.TwitchBot)
+	if err != nil {
+		os.Exit(1)
+	}
+	twitch.StartListener(context.TODO(), chatChan, botAuth, emc, func(status twitch.StreamStatus) {
+		api.HandleStreamStatus(status)
+
+		// emote stats are counted per stream session
+		if status.Online {
+			emoteStats.StartSession(status.StartedAt)
+		}
+	})
+
+	// the stream may already be live, e.g. after a restart
+	if status, err := twitch.NewClient(twitchAuth).GetStreamStatus(context.TODO(), twitchAuth.BroadcasterID); err != nil {
+		log.Error().Err(err).Msg("failed to get the stream status")
+	} else if status.Online {
+		api.ResumeStreamStatus(status)
+		if emoteStats.Session().Before(status.StartedAt) {
+			emoteStats.StartSession(status.StartedAt)
+		}
+	}
 
 	// sync emotes
 	// TODO: setup proper background task processing
 	emotesChannels := helpers.MapKeys(config.Cfg.EmotesWhitelist)
-	if err := twitch.SyncEmotes(emc, twitchAuth, emotesChannels); err != nil {
+	if err := twitch.SyncEmotes(context.TODO(), emc, twitchAuth, emotesChannels); err != nil {
 		log.Error().Err(err).Msg("Failed to sync Twitch Emotes")
 	}
-	emc.SaveToFile(emotesIndexFile)
+	if err := seventv.SyncEmotes(context.TODO(), emc, emotesChannels); err != nil {
+		log.Error().Err(err).Msg("Failed to sync 7TV Emotes")
+	}
+	emc.SaveToFile(livechat.EmoteIndexFile)
 
 	// Graceful shutdown on SIGINT and SIGTERM
 	quit := make(chan os.Signal, 1)
@@ -70,6 +124,11 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	stopStats()
+	if err := emoteStats.SaveToFile(livechat.EmoteStatsFile); err != nil {
+		log.Error().Err(err).Msg("failed to save emote stats")
+	}
+
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatal().Err(err).Msg("Failed to gracefully shut down server")
 	} else {
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nullvt/stream-admin/internal/config"
+	"github.com/nullvt/stream-admin/internal/secrets"
+	"github.com/rs/zerolog/log"
+)
+
+// runSecretsCommand handles "stream-admin secrets migrate", moving secrets
+// between backends and selecting the target backend in the config
+func runSecretsCommand(args []string) int {
+	if len(args) == 0 || args[0] != "migrate" {
+		fmt.Fprintln(os.Stderr, "usage: stream-admin secrets migrate -to plaintext|encrypted|keyring|command [-from backend] [-remove-source]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("secrets migrate", flag.ContinueOnError)
+	from := flags.String("from", string(secrets.ActiveBackend()), "backend to migrate from, defaults to the configured one")
+	to := flags.String("to", "", "backend to migrate to")
+	removeSource := flags.Bool("remove-source", false, "remove the secrets from the source backend once migrated")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if !secrets.ValidBackend(secrets.Backend(*from)) || !secrets.ValidBackend(secrets.Backend(*to)) {
+		fmt.Fprintln(os.Stderr, "backends must be one of plaintext, encrypted, keyring, env or command")
+		return 2
+	}
+
+	count, err := secrets.Migrate(secrets.Backend(*from), secrets.Backend(*to), *removeSource)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to migrate secrets")
+		return 1
+	}
+	log.Info().Int("count", count).Str("from", *from).Str("to", *to).Msg("migrated secrets")
+
+	// use the new backend from now on
+	if err := config.SetConfigValue("secrets.backend", *to); err != nil {
+		return 1
+	}
+
+	return 0
+}